@@ -5,19 +5,32 @@ import (
 	"fmt"
 	"log"
 	"myGreenMarket/app/echo-server/router"
+	"myGreenMarket/business/alert"
+	"myGreenMarket/business/cart"
 	"myGreenMarket/business/category"
+	"myGreenMarket/business/inventory"
+	"myGreenMarket/business/markdown"
 	"myGreenMarket/business/orders"
 	"myGreenMarket/business/payments"
+	"myGreenMarket/business/pricing"
 	"myGreenMarket/business/product"
+	"myGreenMarket/business/search"
+	"myGreenMarket/business/subscription"
 	userService "myGreenMarket/business/user"
+	"myGreenMarket/business/wallet"
+	"myGreenMarket/domain"
+	"myGreenMarket/internal/fakegateway"
 	"myGreenMarket/internal/middleware"
+	"myGreenMarket/internal/repository/banktransfer"
 	"myGreenMarket/internal/repository/notification"
 	psqlRepo "myGreenMarket/internal/repository/postgres"
+	"myGreenMarket/internal/repository/stubdisbursement"
 	"myGreenMarket/internal/repository/xendit"
 	"myGreenMarket/internal/rest"
 	"myGreenMarket/pkg/config"
 	"myGreenMarket/pkg/database"
 	"myGreenMarket/pkg/logger"
+	"myGreenMarket/pkg/scheduler"
 	"net/http"
 	"os"
 	"os/signal"
@@ -56,14 +69,47 @@ func main() {
 		},
 	)
 
-	xenditRepo := xendit.NewXenditRepository(
-		xendit.XenditConfig{
-			XenditApi:          cfg.Xendit.XenditSecretKey,
-			XenditUrl:          cfg.Xendit.XenditUrl,
-			SuccessRedirectUrl: cfg.Xendit.RedirectUrl,
-			FailureRedirectUrl: cfg.Xendit.RedirectUrl,
-		},
-	)
+	// Init payment gateway
+	var paymentGateway payments.PaymentGateway
+	switch cfg.Payment.Gateway {
+	case "bank_transfer":
+		paymentGateway = banktransfer.NewBankTransferGateway(
+			banktransfer.BankTransferConfig{
+				BankName:          cfg.Payment.BankName,
+				BankAccountNumber: cfg.Payment.BankAccountNumber,
+				BankAccountName:   cfg.Payment.BankAccountName,
+			},
+		)
+	default:
+		paymentGateway = xendit.NewXenditRepository(
+			xendit.XenditConfig{
+				XenditApi:          cfg.Xendit.XenditSecretKey,
+				XenditUrl:          cfg.Xendit.XenditUrl,
+				SuccessRedirectUrl: cfg.Xendit.RedirectUrl,
+				FailureRedirectUrl: cfg.Xendit.RedirectUrl,
+				Timeout:            cfg.Xendit.Timeout,
+				MaxRetries:         cfg.Xendit.MaxRetries,
+			},
+		)
+	}
+	logger.Info("Payment gateway selected", "gateway", paymentGateway.Name())
+
+	// Init disbursement gateway
+	var disbursementGateway wallet.DisbursementGateway
+	switch cfg.Withdrawal.Gateway {
+	case "stub":
+		disbursementGateway = stubdisbursement.NewStubDisbursementGateway()
+	default:
+		disbursementGateway = xendit.NewXenditRepository(
+			xendit.XenditConfig{
+				XenditApi:  cfg.Xendit.XenditSecretKey,
+				XenditUrl:  cfg.Xendit.XenditUrl,
+				Timeout:    cfg.Xendit.Timeout,
+				MaxRetries: cfg.Xendit.MaxRetries,
+			},
+		)
+	}
+	logger.Info("Disbursement gateway selected", "gateway", disbursementGateway.Name())
 
 	// Init validate
 	validate := validator.New()
@@ -74,13 +120,36 @@ func main() {
 	productsRepo := psqlRepo.NewProductRepository(db)
 	paymentsRepo := psqlRepo.NewPaymentsRepository(db)
 	categoryRepo := psqlRepo.NewCategoryRepository(db)
+	cartRepo := psqlRepo.NewCartRepository(db)
+	stockRepo := psqlRepo.NewStockRepository(db)
+	txManager := psqlRepo.NewTransactionManager(db)
+	walletRepo := psqlRepo.NewWalletRepository(db)
+	webhookEventRepo := psqlRepo.NewWebhookEventRepository(db)
+	reconciliationRepo := psqlRepo.NewReconciliationRepository(db)
+	bankAccountRepo := psqlRepo.NewBankAccountRepository(db)
+	withdrawalRepo := psqlRepo.NewWithdrawalRepository(db)
+	promotionRepo := psqlRepo.NewPromotionRepository(db)
+	markdownRepo := psqlRepo.NewMarkdownRepository(db)
+	stockBatchRepo := psqlRepo.NewStockBatchRepository(db)
+	movementRepo := psqlRepo.NewInventoryMovementRepository(db)
+	alertRepo := psqlRepo.NewAlertRepository(db)
+	subscriptionRepo := psqlRepo.NewStockSubscriptionRepository(db)
+	suggestionRepo := psqlRepo.NewSuggestionRepository(db)
 
 	// Init service
 	userService := userService.NewUserService(userRepo, validate, mailjetEmail, cfg.App.AppEmailVerificationKey, cfg.App.AppDeploymentUrl)
-	ordersService := orders.NewOrdersService(ordersRepo, productsRepo)
-	paymentsService := payments.NewPaymentsService(paymentsRepo, xenditRepo, userRepo, ordersRepo, productsRepo)
-	productService := product.NewProductService(productsRepo)
+	pricingService := pricing.NewPricingService(promotionRepo, productsRepo, cartRepo)
+	paymentsService := payments.NewPaymentsService(paymentsRepo, paymentGateway, userRepo, ordersRepo, productsRepo, stockRepo, walletRepo, webhookEventRepo, reconciliationRepo, txManager)
+	ordersService := orders.NewOrdersService(ordersRepo, productsRepo, cartRepo, stockRepo, pricingService, paymentsService, txManager)
+	productService := product.NewProductService(productsRepo, categoryRepo)
 	categoryService := category.NewCategoryService(categoryRepo)
+	cartService := cart.NewCartService(cartRepo, productsRepo, pricingService)
+	markdownService := markdown.NewMarkdownService(markdownRepo, txManager)
+	inventoryService := inventory.NewInventoryService(stockBatchRepo, stockRepo, movementRepo, productsRepo)
+	alertService := alert.NewAlertService(alertRepo, stockBatchRepo, productsRepo, userRepo, mailjetEmail, txManager)
+	subscriptionService := subscription.NewSubscriptionService(subscriptionRepo, productsRepo, mailjetEmail)
+	searchService := search.NewSearchService(suggestionRepo)
+	walletService := wallet.NewWalletService(walletRepo, userRepo, bankAccountRepo, withdrawalRepo, disbursementGateway, txManager, domain.IDR(cfg.Withdrawal.ApprovalThreshold))
 
 	// Init handler
 	userHandler := rest.NewUserHandler(userService)
@@ -89,6 +158,14 @@ func main() {
 	paymentsHandler := rest.NewPaymentsHandler(paymentsService)
 	webhookHandler := rest.NewWebhookController(paymentsService)
 	categoryHandler := rest.NewCategoryHandler(categoryService)
+	cartHandler := rest.NewCartHandler(cartService)
+	walletHandler := rest.NewWalletHandler(walletService)
+	pricingHandler := rest.NewPricingHandler(pricingService)
+	markdownHandler := rest.NewMarkdownHandler(markdownService)
+	inventoryHandler := rest.NewInventoryHandler(inventoryService)
+	alertHandler := rest.NewAlertHandler(alertService)
+	subscriptionHandler := rest.NewSubscriptionHandler(subscriptionService)
+	searchHandler := rest.NewSearchHandler(searchService)
 
 	// Init echo
 	e := echo.New()
@@ -98,6 +175,9 @@ func main() {
 	// HTTP error handler
 	e.HTTPErrorHandler = middleware.ErrorHandler
 
+	// Client IPs, the webhook allowlist relies on them not being spoofable
+	e.IPExtractor = middleware.ClientIPExtractor(cfg.Server.TrustedProxies)
+
 	// Global middleware
 	e.Use(echomiddleware.Recover())
 	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
@@ -109,18 +189,43 @@ func main() {
 	// Auth middleware
 	authRequired := middleware.AuthMiddleware()
 	adminOnly := middleware.AdminOnly()
+	webhookAuth := middleware.XenditCallbackAuth(cfg.Xendit.CallbackToken, cfg.Xendit.WebhookAllowedIPs)
 
 	// authRequired := middleware.AuthMiddleware()
 	// Setup routes
 	api := e.Group("/api/v1")
 	router.SetupUserRoutes(api, userHandler)
 	router.SetupProductRoutes(api, productHandler, authRequired, adminOnly)
+	router.SetSubscriptionRoutes(api, subscriptionHandler, authRequired)
+	router.SetSearchRoutes(api, searchHandler, authRequired, adminOnly)
+	router.SetMarkdownAdminRoutes(api, markdownHandler, authRequired, adminOnly)
+	router.SetInventoryAdminRoutes(api, inventoryHandler, authRequired, adminOnly)
+	router.SetAlertAdminRoutes(api, alertHandler, authRequired, adminOnly)
 	router.SetOrdersRoutes(api, ordersHandler)
+	router.SetCartRoutes(api, cartHandler)
+	router.SetPricingRoutes(api, pricingHandler)
+	router.SetPromotionAdminRoutes(api, pricingHandler, authRequired, adminOnly)
+	router.SetWalletRoutes(api, walletHandler)
+	router.SetWithdrawalAdminRoutes(api, walletHandler, authRequired, adminOnly)
 	router.SetPaymentsRoutes(api, paymentsHandler)
-	router.SetWebhookHandler(api, webhookHandler)
+	router.SetPaymentsAdminRoutes(api, paymentsHandler, authRequired, adminOnly)
+	router.SetWebhookHandler(api, webhookHandler, webhookAuth)
+	router.SetDisbursementWebhookHandler(api, walletHandler, webhookAuth)
+	router.SetWebhookAdminRoutes(api, webhookHandler, authRequired, adminOnly)
 	router.SetupCategoryRoutes(api, categoryHandler)
-	router.SetPaymentsRoutes(api, paymentsHandler)
-	router.SetWebhookHandler(api, webhookHandler)
+
+	// Dev mode gateway simulator, set XENDIT_URL to <APP_DEPLOYMENT_URL>/fake/v2/invoices
+	// and MAILJET_BASE_URL to <APP_DEPLOYMENT_URL>/fake to use it
+	if cfg.App.FakeGateways && cfg.App.Environment != "production" {
+		simulator := fakegateway.New(fakegateway.Config{
+			BaseURL:                 cfg.App.AppDeploymentUrl + "/fake",
+			CallbackURL:             cfg.App.AppDeploymentUrl + "/api/v1/webhook/handler",
+			DisbursementCallbackURL: cfg.App.AppDeploymentUrl + "/api/v1/webhook/disbursement",
+			CallbackToken:           cfg.Xendit.CallbackToken,
+		})
+		simulator.Register(e.Group("/fake"))
+		logger.Info("Fake gateways mounted", "base_url", cfg.App.AppDeploymentUrl+"/fake")
+	}
 
 	// Goroutine server
 	go func() {
@@ -131,6 +236,32 @@ func main() {
 		}
 	}()
 
+	// Background jobs
+	jobs := scheduler.New()
+	jobs.Every("reconcile-payments", cfg.Scheduler.ReconcileInterval, func(ctx context.Context) error {
+		return paymentsService.ReconcileScheduled(ctx, cfg.Scheduler.ReconcileAfter)
+	})
+	// Gateway refunds are sent again or checked on the same schedule
+	jobs.Every("sync-refunds", cfg.Scheduler.ReconcileInterval, func(ctx context.Context) error {
+		return paymentsService.SyncRefunds(ctx, cfg.Scheduler.ReconcileAfter)
+	})
+	jobs.Every("expire-payments", cfg.Scheduler.ExpiryInterval, paymentsService.ExpireOverduePayments)
+	jobs.Every("expire-orders", cfg.Scheduler.ExpiryInterval, func(ctx context.Context) error {
+		return ordersService.ExpireStaleOrders(ctx, cfg.Scheduler.PendingOrderTTL)
+	})
+	jobs.Every("apply-markdowns", cfg.Scheduler.MarkdownInterval, markdownService.ApplyMarkdowns)
+	jobs.Every("evaluate-stock-alerts", cfg.Scheduler.AlertInterval, func(ctx context.Context) error {
+		return alertService.EvaluateAlerts(ctx, cfg.Scheduler.ExpiringAlertWindow)
+	})
+	jobs.Every("notify-back-in-stock", cfg.Scheduler.BackInStockInterval, func(ctx context.Context) error {
+		return subscriptionService.NotifyRestocked(ctx, cfg.Scheduler.BackInStockSendLimit)
+	})
+	// Payouts that never got a callback are checked on the reconciliation schedule
+	jobs.Every("sync-withdrawals", cfg.Scheduler.ReconcileInterval, func(ctx context.Context) error {
+		return walletService.SyncWithdrawals(ctx, cfg.Scheduler.ReconcileAfter)
+	})
+	jobs.Start()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -146,5 +277,10 @@ func main() {
 		logger.Error("Server shutdown error", "error", err)
 	}
 
+	// Stop background jobs, a running job is given the rest of the timeout to finish
+	if err := jobs.Stop(ctx); err != nil {
+		logger.Error("Scheduler shutdown error", "error", err)
+	}
+
 	logger.Info("Server stopped")
 }
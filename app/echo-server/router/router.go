@@ -26,30 +26,130 @@ func SetupProductRoutes(api *echo.Group, handler *rest.ProductHandler, authRequi
 
 }
 
+func SetSearchRoutes(api *echo.Group, searchHandler *rest.SearchHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	api.GET("/products/suggest", searchHandler.Suggest, authRequired)
+
+	search := api.Group("/admin/search", authRequired, adminOnly)
+	search.GET("/misses", searchHandler.GetMisses)
+}
+
+func SetSubscriptionRoutes(api *echo.Group, subscriptionHandler *rest.SubscriptionHandler, authRequired echo.MiddlewareFunc) {
+	products := api.Group("/products")
+	products.POST("/:id/notify-me", subscriptionHandler.NotifyMe, authRequired)
+}
+
+func SetMarkdownAdminRoutes(api *echo.Group, markdownHandler *rest.MarkdownHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	markdowns := api.Group("/admin/markdowns", authRequired, adminOnly)
+	markdowns.GET("/rules", markdownHandler.GetRules)
+	markdowns.POST("/rules", markdownHandler.CreateRule)
+	markdowns.DELETE("/rules/:id", markdownHandler.DeleteRule)
+	markdowns.GET("/preview", markdownHandler.PreviewMarkdowns)
+}
+
+func SetInventoryAdminRoutes(api *echo.Group, inventoryHandler *rest.InventoryHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	products := api.Group("/admin/products", authRequired, adminOnly)
+	products.GET("/:id/batches", inventoryHandler.GetBatches)
+	products.POST("/:id/batches", inventoryHandler.ReceiveBatch)
+	products.PATCH("/:id/batches/:batch_id", inventoryHandler.AdjustBatch)
+
+	stockAdjustments := api.Group("/products", authRequired, adminOnly)
+	stockAdjustments.POST("/:id/stock-adjustments", inventoryHandler.AdjustStock)
+	stockAdjustments.GET("/:id/movements", inventoryHandler.GetMovements)
+
+	stock := api.Group("/admin/stock", authRequired, adminOnly)
+	stock.GET("/expiring", inventoryHandler.GetExpiringStock)
+}
+
+func SetAlertAdminRoutes(api *echo.Group, alertHandler *rest.AlertHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	alerts := api.Group("/admin/alerts", authRequired, adminOnly)
+	alerts.GET("", alertHandler.GetAlerts)
+}
+
 func SetOrdersRoutes(api *echo.Group, ordersHandler *rest.OrdersHandler) {
 	orders := api.Group("/orders", middleware.AuthMiddleware())
 	orders.POST("", ordersHandler.CreateOrderItem)
+	orders.POST("/checkout", ordersHandler.Checkout)
 	orders.GET("", ordersHandler.GetAllOrders)
 	orders.GET("/:id", ordersHandler.GetOrderByID)
+	orders.GET("/:id/history", ordersHandler.GetOrderHistory)
 	orders.PUT("/:id", ordersHandler.UpdateOrder)
-	orders.DELETE("/:id", ordersHandler.DeleteOrder)
+	orders.PATCH("/:id/status", ordersHandler.UpdateOrderStatus, middleware.AdminOnly())
+	orders.DELETE("/:id", ordersHandler.CancelOrder)
+
+}
+
+func SetCartRoutes(api *echo.Group, cartHandler *rest.CartHandler) {
+	cart := api.Group("/cart", middleware.AuthMiddleware())
+	cart.GET("", cartHandler.GetCart)
+	cart.POST("", cartHandler.AddItem)
+	cart.PUT("/:product_id", cartHandler.UpdateItem)
+	cart.DELETE("/:product_id", cartHandler.RemoveItem)
+}
+
+func SetPricingRoutes(api *echo.Group, pricingHandler *rest.PricingHandler) {
+	pricing := api.Group("/pricing", middleware.AuthMiddleware())
+	pricing.POST("/preview", pricingHandler.Preview)
+}
 
+func SetPromotionAdminRoutes(api *echo.Group, pricingHandler *rest.PricingHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	promotions := api.Group("/admin/promotions", authRequired, adminOnly)
+	promotions.GET("", pricingHandler.GetPromotions)
+	promotions.POST("", pricingHandler.CreatePromotion)
+	promotions.DELETE("/:id", pricingHandler.DeletePromotion)
 }
 
 func SetPaymentsRoutes(api *echo.Group, paymentsHandler *rest.PaymentsHandler) {
 	payments := api.Group("/payments", middleware.AuthMiddleware())
 	payments.POST("", paymentsHandler.CreatePayment)
 	payments.POST("/topup", paymentsHandler.TopUp)
+	payments.POST("/refunds", paymentsHandler.RefundOrder)
 	payments.GET("/:id", paymentsHandler.GetPaymentsByID)
 	payments.GET("", paymentsHandler.GetAllPayments)
+	payments.POST("/:id/confirm", paymentsHandler.ConfirmPayment, middleware.AdminOnly())
 	api.GET("/paid", paymentsHandler.PaidResponse)
 }
 
-func SetWebhookHandler(api *echo.Group, webhookHandler *rest.WebhookController) {
-	webhook := api.Group("/webhook")
+func SetPaymentsAdminRoutes(api *echo.Group, paymentsHandler *rest.PaymentsHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	payments := api.Group("/admin/payments", authRequired, adminOnly)
+	payments.POST("/reconcile", paymentsHandler.ReconcilePayments)
+	payments.POST("/refunds", paymentsHandler.AdminRefundOrder)
+	payments.GET("/reconciliations", paymentsHandler.ListReconciliationReports)
+}
+
+func SetWalletRoutes(api *echo.Group, walletHandler *rest.WalletHandler) {
+	wallet := api.Group("/wallet", middleware.AuthMiddleware())
+	wallet.GET("/transactions", walletHandler.GetTransactions)
+	wallet.POST("/adjustments", walletHandler.Adjust, middleware.AdminOnly())
+	wallet.GET("/bank-accounts", walletHandler.GetBankAccounts)
+	wallet.POST("/bank-accounts", walletHandler.AddBankAccount)
+	wallet.DELETE("/bank-accounts/:id", walletHandler.DeleteBankAccount)
+	wallet.GET("/withdrawals", walletHandler.GetWithdrawals)
+	wallet.POST("/withdrawals", walletHandler.RequestWithdrawal)
+}
+
+func SetWithdrawalAdminRoutes(api *echo.Group, walletHandler *rest.WalletHandler, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	withdrawals := api.Group("/admin/withdrawals", authRequired, adminOnly)
+	withdrawals.GET("", walletHandler.ListWithdrawals)
+	withdrawals.POST("/:id/approve", walletHandler.ApproveWithdrawal)
+	withdrawals.POST("/:id/reject", walletHandler.RejectWithdrawal)
+}
+
+func SetWebhookHandler(api *echo.Group, webhookHandler *rest.WebhookController, webhookAuth echo.MiddlewareFunc) {
+	webhook := api.Group("/webhook", webhookAuth)
 	webhook.POST("/handler", webhookHandler.HandleWebhook)
 }
 
+func SetDisbursementWebhookHandler(api *echo.Group, walletHandler *rest.WalletHandler, webhookAuth echo.MiddlewareFunc) {
+	webhook := api.Group("/webhook", webhookAuth)
+	webhook.POST("/disbursement", walletHandler.HandleDisbursementWebhook)
+}
+
+func SetWebhookAdminRoutes(api *echo.Group, webhookHandler *rest.WebhookController, authRequired echo.MiddlewareFunc, adminOnly echo.MiddlewareFunc) {
+	events := api.Group("/admin/webhook-events", authRequired, adminOnly)
+	events.GET("", webhookHandler.ListEvents)
+	events.POST("/:id/replay", webhookHandler.ReplayEvent)
+}
+
 func SetupCategoryRoutes(api *echo.Group, handler *rest.CategoryHandler) {
 	categories := api.Group("/categories")
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/internal/fakegateway"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+)
+
+// Runs the Xendit and Mailjet simulator on its own. Point the API server at it with
+//
+//	XENDIT_URL=http://localhost:8090/v2/invoices
+//	MAILJET_BASE_URL=http://localhost:8090
+func main() {
+	_ = godotenv.Load()
+
+	logger.Init(getEnv("APP_ENV", "development"))
+
+	port := getEnv("FAKE_GATEWAYS_PORT", "8090")
+	simulator := fakegateway.New(fakegateway.Config{
+		BaseURL:                 getEnv("FAKE_GATEWAYS_BASE_URL", "http://localhost:"+port),
+		CallbackURL:             getEnv("FAKE_GATEWAYS_CALLBACK_URL", "http://localhost:"+getEnv("PORT", "8080")+"/api/v1/webhook/handler"),
+		DisbursementCallbackURL: getEnv("FAKE_GATEWAYS_DISBURSEMENT_CALLBACK_URL", "http://localhost:"+getEnv("PORT", "8080")+"/api/v1/webhook/disbursement"),
+		CallbackToken:           os.Getenv("XENDIT_CALLBACK_TOKEN"),
+	})
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Use(echomiddleware.Recover())
+	simulator.Register(e.Group(""))
+
+	go func() {
+		addr := fmt.Sprintf(":%s", port)
+		logger.Info("Fake gateways starting", "address", addr)
+		if err := e.Start(addr); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Failed to start fake gateways", "error", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		logger.Error("Fake gateways shutdown error", "error", err)
+	}
+}
+
+func getEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+
+	return defaultVal
+}
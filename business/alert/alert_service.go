@@ -0,0 +1,258 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/orders"
+	"myGreenMarket/business/product"
+	"myGreenMarket/business/user"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AlertRepository contract interface
+type AlertRepository interface {
+	// FindLowStock returns products at or below their reorder threshold
+	FindLowStock(ctx context.Context) ([]domain.Product, error)
+	FindOpen(ctx context.Context) ([]domain.StockAlert, error)
+	FindAll(ctx context.Context, openOnly bool, offset, limit int) ([]domain.StockAlert, int64, error)
+	Create(ctx context.Context, alert *domain.StockAlert) error
+	Resolve(ctx context.Context, id uint64, at time.Time) error
+	MarkNotified(ctx context.Context, ids []uint64, at time.Time) error
+}
+
+// BatchRepository contract interface
+type BatchRepository interface {
+	FindExpiring(ctx context.Context, before time.Time) ([]domain.StockBatch, error)
+}
+
+// UserRepository contract interface
+type UserRepository interface {
+	FindByRole(ctx context.Context, role string) ([]domain.User, error)
+}
+
+const (
+	defaultAlertLimit = 20
+	maxAlertLimit     = 100
+
+	SubjectStockAlerts   = "Stock Alerts"
+	EmailBodyStockAlerts = `Halo, %v, ada %v peringatan stok baru</br></br>%v`
+)
+
+type alertService struct {
+	alertRepo   AlertRepository
+	batchRepo   BatchRepository
+	productRepo product.ProductRepository
+	userRepo    UserRepository
+	notifRepo   user.NotificationRepository
+	txManager   orders.Transactor
+}
+
+func NewAlertService(
+	alertRepo AlertRepository,
+	batchRepo BatchRepository,
+	productRepo product.ProductRepository,
+	userRepo UserRepository,
+	notifRepo user.NotificationRepository,
+	txManager orders.Transactor,
+) *alertService {
+	return &alertService{
+		alertRepo:   alertRepo,
+		batchRepo:   batchRepo,
+		productRepo: productRepo,
+		userRepo:    userRepo,
+		notifRepo:   notifRepo,
+		txManager:   txManager,
+	}
+}
+
+// EvaluateAlerts opens an alert for every low-stock product and every batch
+// expiring within the given window that has none open yet, resolves open
+// alerts whose condition cleared, and mails admins a digest of the alerts
+// they have not been told about. It is run by the scheduler.
+func (s *alertService) EvaluateAlerts(ctx context.Context, expiringWithin time.Duration) error {
+	now := time.Now()
+	current, err := s.detect(ctx, now.Add(expiringWithin))
+	if err != nil {
+		return err
+	}
+
+	open, err := s.alertRepo.FindOpen(ctx)
+	if err != nil {
+		logger.Error("Failed to find open stock alerts", err)
+		return err
+	}
+
+	var opened, resolved int
+	var pending []domain.StockAlert
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		seen := make(map[string]bool)
+		for _, alert := range open {
+			seen[alert.Key()] = true
+			if _, ok := current[alert.Key()]; !ok {
+				if err := s.alertRepo.Resolve(ctx, alert.ID, now); err != nil {
+					return err
+				}
+				resolved++
+				continue
+			}
+			if alert.NotifiedAt == nil {
+				pending = append(pending, alert)
+			}
+		}
+
+		keys := make([]string, 0, len(current))
+		for key := range current {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			alert := current[key]
+			alert.CreatedAt = now
+			if err := s.alertRepo.Create(ctx, &alert); err != nil {
+				return err
+			}
+			opened++
+			pending = append(pending, alert)
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to save stock alerts", err)
+		return err
+	}
+
+	if opened > 0 || resolved > 0 {
+		logger.Info("Evaluated stock alerts", "opened", opened, "resolved", resolved)
+	}
+
+	return s.notify(ctx, pending, now)
+}
+
+// detect returns the alerts the stock calls for right now, by key
+func (s *alertService) detect(ctx context.Context, expiringBefore time.Time) (map[string]domain.StockAlert, error) {
+	alerts := make(map[string]domain.StockAlert)
+
+	products, err := s.alertRepo.FindLowStock(ctx)
+	if err != nil {
+		logger.Error("Failed to find low stock products", err)
+		return nil, err
+	}
+	for _, p := range products {
+		alert := domain.StockAlert{
+			ProductID: p.ID,
+			Kind:      domain.AlertKindLowStock,
+			Quantity:  p.Quantity,
+			Threshold: p.ReorderThreshold,
+			Message:   fmt.Sprintf("%s is low on stock: %v %s left, reorder threshold %v", p.ProductName, p.Quantity, p.Unit, *p.ReorderThreshold),
+		}
+		if p.Quantity <= 0 {
+			alert.Kind = domain.AlertKindOutOfStock
+			alert.Message = fmt.Sprintf("%s is sold out", p.ProductName)
+		}
+		alerts[alert.Key()] = alert
+	}
+
+	batches, err := s.batchRepo.FindExpiring(ctx, expiringBefore)
+	if err != nil {
+		logger.Error("Failed to find expiring stock batches", err)
+		return nil, err
+	}
+	names := make(map[uint64]domain.Product)
+	for _, batch := range batches {
+		p, ok := names[batch.ProductID]
+		if !ok {
+			p, err = s.productRepo.FindByID(ctx, batch.ProductID)
+			if err != nil {
+				logger.Error("Failed to find expiring product", err)
+				return nil, err
+			}
+			names[batch.ProductID] = p
+		}
+
+		batchID := batch.ID
+		expiresAt := batch.ExpiresAt
+		alert := domain.StockAlert{
+			ProductID: batch.ProductID,
+			Kind:      domain.AlertKindExpiring,
+			BatchID:   &batchID,
+			Quantity:  batch.Remaining,
+			ExpiresAt: &expiresAt,
+			Message:   fmt.Sprintf("%v %s of %s in batch %d expire on %s", batch.Remaining, p.Unit, p.ProductName, batch.ID, batch.ExpiresAt.Format("2006-01-02 15:04")),
+		}
+		alerts[alert.Key()] = alert
+	}
+
+	return alerts, nil
+}
+
+// notify mails the alerts to every admin in one digest. Alerts stay
+// unnotified, and go in the next digest, when no admin could be mailed.
+func (s *alertService) notify(ctx context.Context, alerts []domain.StockAlert, at time.Time) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	admins, err := s.userRepo.FindByRole(ctx, "admin")
+	if err != nil {
+		logger.Error("Failed to find admins", err)
+		return err
+	}
+	if len(admins) == 0 {
+		logger.Warn("No admin to send stock alerts to", "alerts", len(alerts))
+		return nil
+	}
+
+	lines := make([]string, len(alerts))
+	ids := make([]uint64, len(alerts))
+	for i, alert := range alerts {
+		lines[i] = "- " + alert.Message
+		ids[i] = alert.ID
+	}
+	digest := strings.Join(lines, "</br>")
+
+	var sent int
+	for _, admin := range admins {
+		err := s.notifRepo.SendEmail(admin.FullName, admin.Email, SubjectStockAlerts, fmt.Sprintf(EmailBodyStockAlerts, admin.FullName, len(alerts), digest))
+		if err != nil {
+			logger.Warn("Failed to send stock alerts", "admin", admin.ID, "error", err)
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return errors.New("failed to send stock alerts to any admin")
+	}
+
+	return s.alertRepo.MarkNotified(ctx, ids, at)
+}
+
+// GetAlerts returns a page of the alert feed, newest first. openOnly leaves
+// resolved alerts out.
+func (s *alertService) GetAlerts(ctx context.Context, openOnly bool, page, limit int) ([]domain.StockAlert, int64, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get stock alerts")
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultAlertLimit
+	}
+	if limit > maxAlertLimit {
+		limit = maxAlertLimit
+	}
+
+	return s.alertRepo.FindAll(ctx, openOnly, (page-1)*limit, limit)
+}
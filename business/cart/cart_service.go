@@ -0,0 +1,174 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/product"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// CartRepository contract interface
+type CartRepository interface {
+	FindByUserID(ctx context.Context, userID uint) ([]domain.CartItem, error)
+	FindItem(ctx context.Context, userID uint, productID uint64) (domain.CartItem, error)
+	Create(ctx context.Context, item *domain.CartItem) error
+	Update(ctx context.Context, item *domain.CartItem) error
+	Delete(ctx context.Context, userID uint, productID uint64) error
+	Clear(ctx context.Context, userID uint) error
+}
+
+type cartService struct {
+	cartRepo    CartRepository
+	productRepo product.ProductRepository
+	pricer      product.Pricer
+}
+
+func NewCartService(cartRepo CartRepository, productRepo product.ProductRepository, pricer product.Pricer) *cartService {
+	return &cartService{
+		cartRepo:    cartRepo,
+		productRepo: productRepo,
+		pricer:      pricer,
+	}
+}
+
+func (s *cartService) GetCart(ctx context.Context, userID uint) (domain.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get cart")
+		return domain.Cart{}, fmt.Errorf("context error: %w", err)
+	}
+
+	items, err := s.cartRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to find cart items", err)
+		return domain.Cart{}, err
+	}
+
+	cart := domain.Cart{
+		UserID: userID,
+		Items:  make([]domain.CartItem, 0, len(items)),
+	}
+	products := make([]domain.Product, 0, len(items))
+	for _, item := range items {
+		product, err := s.productRepo.FindByID(ctx, item.ProductID)
+		if err != nil {
+			logger.Error("Failed to find cart product", err)
+			return domain.Cart{}, err
+		}
+		products = append(products, product)
+	}
+
+	prices, err := s.pricer.UnitPrices(ctx, products)
+	if err != nil {
+		logger.Error("Failed to price cart", err)
+		return domain.Cart{}, err
+	}
+
+	for i, item := range items {
+		item.ProductName = products[i].ProductName
+		item.PriceEach = prices[i].UnitPrice
+		item.Subtotal = prices[i].UnitPrice.Mul(int64(item.Quantity))
+		cart.Total = cart.Total.Add(item.Subtotal)
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart, nil
+}
+
+func (s *cartService) AddItem(ctx context.Context, userID uint, productID uint64, quantity int) (domain.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when add cart item")
+		return domain.Cart{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if quantity <= 0 {
+		logger.Error("Invalid cart data: quantity must be greater than 0")
+		return domain.Cart{}, errors.New("quantity must be greater than 0")
+	}
+
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		logger.Error("Failed to find product", err)
+		return domain.Cart{}, err
+	}
+
+	item, err := s.cartRepo.FindItem(ctx, userID, productID)
+	if err == nil {
+		item.Quantity += quantity
+		if product.Quantity < float64(item.Quantity) {
+			return domain.Cart{}, errors.New("insufficient stock")
+		}
+		item.UpdatedAt = time.Now()
+		if err := s.cartRepo.Update(ctx, &item); err != nil {
+			logger.Error("failed to update cart item", err)
+			return domain.Cart{}, err
+		}
+	} else {
+		if product.Quantity < float64(quantity) {
+			return domain.Cart{}, errors.New("insufficient stock")
+		}
+		item = domain.CartItem{
+			UserID:    userID,
+			ProductID: productID,
+			Quantity:  quantity,
+		}
+		if err := s.cartRepo.Create(ctx, &item); err != nil {
+			logger.Error("failed to create cart item", err)
+			return domain.Cart{}, err
+		}
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+func (s *cartService) UpdateItem(ctx context.Context, userID uint, productID uint64, quantity int) (domain.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when update cart item")
+		return domain.Cart{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if quantity <= 0 {
+		logger.Error("Invalid cart data: quantity must be greater than 0")
+		return domain.Cart{}, errors.New("quantity must be greater than 0")
+	}
+
+	item, err := s.cartRepo.FindItem(ctx, userID, productID)
+	if err != nil {
+		logger.Error("cart item not found", err)
+		return domain.Cart{}, err
+	}
+
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		logger.Error("Failed to find product", err)
+		return domain.Cart{}, err
+	}
+	if product.Quantity < float64(quantity) {
+		return domain.Cart{}, errors.New("insufficient stock")
+	}
+
+	item.Quantity = quantity
+	item.UpdatedAt = time.Now()
+	if err := s.cartRepo.Update(ctx, &item); err != nil {
+		logger.Error("failed to update cart item", err)
+		return domain.Cart{}, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+func (s *cartService) RemoveItem(ctx context.Context, userID uint, productID uint64) (domain.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when remove cart item")
+		return domain.Cart{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if err := s.cartRepo.Delete(ctx, userID, productID); err != nil {
+		logger.Error("failed to remove cart item", err)
+		return domain.Cart{}, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
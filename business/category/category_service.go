@@ -12,9 +12,11 @@ import (
 type CategoryRepository interface {
 	Create(ctx context.Context, category *domain.Category) error
 	FindByID(ctx context.Context, id uint64) (domain.Category, error)
+	FindBySlug(ctx context.Context, slug string) (domain.Category, error)
 	FindAll(ctx context.Context) ([]domain.Category, error)
+	CountProducts(ctx context.Context) (map[uint64]int64, error)
 	Update(ctx context.Context, category *domain.Category) error
-	Delete(ctx context.Context, id uint64) error
+	Delete(ctx context.Context, id uint64, reassignTo *uint64) error
 }
 
 type categoryService struct {
@@ -27,7 +29,8 @@ func NewCategoryService(categoryRepo CategoryRepository) *categoryService {
 	}
 }
 
-func (s *categoryService) GetAllCategories(ctx context.Context) ([]domain.Category, error) {
+// GetAllCategories returns the category tree, top level categories first
+func (s *categoryService) GetAllCategories(ctx context.Context) ([]domain.CategoryNode, error) {
 	if err := ctx.Err(); err != nil {
 		logger.Error("context error when get all categories")
 		return nil, fmt.Errorf("context error: %w", err)
@@ -39,7 +42,13 @@ func (s *categoryService) GetAllCategories(ctx context.Context) ([]domain.Catego
 		return nil, err
 	}
 
-	return categories, nil
+	counts, err := s.categoryRepo.CountProducts(ctx)
+	if err != nil {
+		logger.Error("Failed to count products per category", err)
+		return nil, err
+	}
+
+	return buildTree(categories, counts), nil
 }
 
 func (s *categoryService) GetCategoryByID(ctx context.Context, id uint64) (domain.Category, error) {
@@ -74,6 +83,11 @@ func (s *categoryService) CreateCategory(ctx context.Context, category *domain.C
 		return nil, errors.New("product category is required")
 	}
 
+	if err := s.prepare(ctx, category); err != nil {
+		logger.Error("Invalid category data", err)
+		return nil, err
+	}
+
 	if err := s.categoryRepo.Create(ctx, category); err != nil {
 		logger.Error("failed to create new category", err)
 		return nil, fmt.Errorf("failed to create category: %w", err)
@@ -102,10 +116,20 @@ func (s *categoryService) UpdateCategory(ctx context.Context, category *domain.C
 	}
 
 	// Verify category exists
-	_, err := s.categoryRepo.FindByID(ctx, category.CategoryID)
+	current, err := s.categoryRepo.FindByID(ctx, category.CategoryID)
 	if err != nil {
 		logger.Error("category not found", err)
-		return nil, errors.New("category not found")
+		return nil, err
+	}
+
+	// The slug is part of the category's URL, it only changes when asked to
+	if category.Slug == "" {
+		category.Slug = current.Slug
+	}
+
+	if err := s.prepare(ctx, category); err != nil {
+		logger.Error("Invalid category data", err)
+		return nil, err
 	}
 
 	if err := s.categoryRepo.Update(ctx, category); err != nil {
@@ -125,12 +149,20 @@ func (s *categoryService) UpdateCategory(ctx context.Context, category *domain.C
 	return &updatedCategory, nil
 }
 
-func (s *categoryService) DeleteCategory(ctx context.Context, id uint64) error {
+// DeleteCategory deletes a category without subcategories. Its products are
+// moved to the reassignTo category, when given, or the category is kept and
+// domain.ErrCategoryInUse returned.
+func (s *categoryService) DeleteCategory(ctx context.Context, id uint64, reassignTo *uint64) error {
 	if id == 0 {
 		logger.Error("Invalid category id when deleting category")
 		return errors.New("invalid category id")
 	}
 
+	if reassignTo != nil && *reassignTo == id {
+		logger.Error("Invalid reassign category when deleting category")
+		return errors.New("cannot reassign products to the deleted category")
+	}
+
 	if err := ctx.Err(); err != nil {
 		logger.Error("context error when deleting category")
 		return fmt.Errorf("context error: %w", err)
@@ -140,15 +172,103 @@ func (s *categoryService) DeleteCategory(ctx context.Context, id uint64) error {
 	_, err := s.categoryRepo.FindByID(ctx, id)
 	if err != nil {
 		logger.Error("category not found", err)
-		return errors.New("category not found")
+		return err
 	}
 
-	if err := s.categoryRepo.Delete(ctx, id); err != nil {
+	if err := s.categoryRepo.Delete(ctx, id, reassignTo); err != nil {
 		logger.Error("failed to delete category", err)
-		return fmt.Errorf("failed to delete category: %w", err)
+		return err
 	}
 
 	logger.Info("category deleted successfully")
 
 	return nil
 }
+
+// prepare fills in the category's slug and checks its slug and parent
+func (s *categoryService) prepare(ctx context.Context, category *domain.Category) error {
+	if category.Slug == "" {
+		category.Slug = category.ProductCategory
+	}
+	category.Slug = domain.Slugify(category.Slug)
+	if category.Slug == "" {
+		return errors.New("category slug must contain letters or digits")
+	}
+
+	existing, err := s.categoryRepo.FindBySlug(ctx, category.Slug)
+	if err == nil && existing.CategoryID != category.CategoryID {
+		return errors.New("category slug already exists")
+	}
+	if err != nil && !errors.Is(err, domain.ErrCategoryNotFound) {
+		return err
+	}
+
+	if category.ParentID == nil {
+		return nil
+	}
+
+	// Walk up from the new parent, meeting the category itself means it would
+	// end up under its own subcategory
+	seen := map[uint64]bool{}
+	for parentID := category.ParentID; parentID != nil; {
+		if *parentID == category.CategoryID {
+			return errors.New("category cannot be nested under itself")
+		}
+		if seen[*parentID] {
+			break
+		}
+		seen[*parentID] = true
+
+		parent, err := s.categoryRepo.FindByID(ctx, *parentID)
+		if err != nil {
+			if errors.Is(err, domain.ErrCategoryNotFound) {
+				return errors.New("parent category not found")
+			}
+			return err
+		}
+		parentID = parent.ParentID
+	}
+
+	return nil
+}
+
+// buildTree nests the categories under their parents. A category whose parent
+// is missing is put on the top level.
+func buildTree(categories []domain.Category, counts map[uint64]int64) []domain.CategoryNode {
+	known := make(map[uint64]bool, len(categories))
+	for _, category := range categories {
+		known[category.CategoryID] = true
+	}
+
+	children := map[uint64][]domain.Category{}
+	var roots []domain.Category
+	for _, category := range categories {
+		if category.ParentID == nil || !known[*category.ParentID] {
+			roots = append(roots, category)
+			continue
+		}
+		children[*category.ParentID] = append(children[*category.ParentID], category)
+	}
+
+	var build func(category domain.Category) domain.CategoryNode
+	build = func(category domain.Category) domain.CategoryNode {
+		node := domain.CategoryNode{
+			Category:     category,
+			ProductCount: counts[category.CategoryID],
+			Children:     []domain.CategoryNode{},
+		}
+		for _, child := range children[category.CategoryID] {
+			childNode := build(child)
+			node.ProductCount += childNode.ProductCount
+			node.Children = append(node.Children, childNode)
+		}
+		return node
+	}
+
+	tree := make([]domain.CategoryNode, 0, len(roots))
+	for _, root := range roots {
+		tree = append(tree, build(root))
+	}
+
+	return tree
+}
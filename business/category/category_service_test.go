@@ -0,0 +1,85 @@
+package category
+
+import (
+	"myGreenMarket/domain"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	id := func(n uint64) *uint64 { return &n }
+
+	categories := []domain.Category{
+		{CategoryID: 1, ProductCategory: "Sayur"},
+		{CategoryID: 2, ProductCategory: "Sayur Daun", ParentID: id(1)},
+		{CategoryID: 3, ProductCategory: "Bayam", ParentID: id(2)},
+		{CategoryID: 4, ProductCategory: "Buah"},
+		{CategoryID: 5, ProductCategory: "Orphan", ParentID: id(99)},
+		{CategoryID: 6, ProductCategory: "Umbi", ParentID: id(1)},
+	}
+	counts := map[uint64]int64{1: 1, 2: 2, 3: 4, 4: 8, 5: 16}
+
+	tree := buildTree(categories, counts)
+
+	type want struct {
+		id       uint64
+		count    int64
+		children []uint64
+	}
+	var flatten func(nodes []domain.CategoryNode, out map[uint64]want)
+	flatten = func(nodes []domain.CategoryNode, out map[uint64]want) {
+		for _, node := range nodes {
+			children := []uint64{}
+			for _, child := range node.Children {
+				children = append(children, child.CategoryID)
+			}
+			out[node.CategoryID] = want{id: node.CategoryID, count: node.ProductCount, children: children}
+			flatten(node.Children, out)
+		}
+	}
+	got := map[uint64]want{}
+	flatten(tree, got)
+
+	var roots []uint64
+	for _, node := range tree {
+		roots = append(roots, node.CategoryID)
+	}
+	if len(roots) != 3 || roots[0] != 1 || roots[1] != 4 || roots[2] != 5 {
+		t.Fatalf("roots = %v, want [1 4 5]", roots)
+	}
+
+	tests := []want{
+		{id: 1, count: 7, children: []uint64{2, 6}},
+		{id: 2, count: 6, children: []uint64{3}},
+		{id: 3, count: 4, children: []uint64{}},
+		{id: 4, count: 8, children: []uint64{}},
+		{id: 5, count: 16, children: []uint64{}},
+		{id: 6, count: 0, children: []uint64{}},
+	}
+	for _, tt := range tests {
+		node, ok := got[tt.id]
+		if !ok {
+			t.Errorf("category %d missing from the tree", tt.id)
+			continue
+		}
+		if node.count != tt.count {
+			t.Errorf("category %d ProductCount = %d, want %d", tt.id, node.count, tt.count)
+		}
+		if len(node.children) != len(tt.children) {
+			t.Errorf("category %d children = %v, want %v", tt.id, node.children, tt.children)
+			continue
+		}
+		for i := range node.children {
+			if node.children[i] != tt.children[i] {
+				t.Errorf("category %d children = %v, want %v", tt.id, node.children, tt.children)
+				break
+			}
+		}
+	}
+}
+
+func TestBuildTreeEmpty(t *testing.T) {
+	tree := buildTree(nil, nil)
+	if tree == nil || len(tree) != 0 {
+		t.Errorf("buildTree(nil) = %#v, want an empty tree", tree)
+	}
+}
@@ -0,0 +1,208 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/product"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// BatchRepository contract interface
+type BatchRepository interface {
+	// Receive records the batch and adds its quantity to the product's stock
+	Receive(ctx context.Context, batch *domain.StockBatch, actor string) error
+	FindOpenByProductID(ctx context.Context, productID uint64) ([]domain.StockBatch, error)
+	Adjust(ctx context.Context, productID, batchID uint64, adjustment domain.BatchAdjustment) (domain.StockBatch, error)
+	FindExpiring(ctx context.Context, before time.Time) ([]domain.StockBatch, error)
+}
+
+// StockRepository contract interface
+type StockRepository interface {
+	AdjustStock(ctx context.Context, adjustment domain.StockAdjustment, actor string) (domain.Product, error)
+}
+
+// MovementRepository contract interface
+type MovementRepository interface {
+	FindByProductID(ctx context.Context, productID uint64, offset, limit int) ([]domain.InventoryMovement, int64, error)
+}
+
+const (
+	defaultMovementLimit = 20
+	maxMovementLimit     = 100
+)
+
+type inventoryService struct {
+	batchRepo    BatchRepository
+	stockRepo    StockRepository
+	movementRepo MovementRepository
+	productRepo  product.ProductRepository
+}
+
+func NewInventoryService(batchRepo BatchRepository, stockRepo StockRepository, movementRepo MovementRepository, productRepo product.ProductRepository) *inventoryService {
+	return &inventoryService{
+		batchRepo:    batchRepo,
+		stockRepo:    stockRepo,
+		movementRepo: movementRepo,
+		productRepo:  productRepo,
+	}
+}
+
+// ReceiveBatch records a delivery of the product and puts it on sale
+func (s *inventoryService) ReceiveBatch(ctx context.Context, adminID uint, batch domain.StockBatch) (domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when receiving stock batch")
+		return domain.StockBatch{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if batch.Quantity <= 0 {
+		return domain.StockBatch{}, errors.New("quantity must be greater than 0")
+	}
+	if batch.CostPrice.IsNegative() {
+		return domain.StockBatch{}, errors.New("cost price cannot be negative")
+	}
+	if batch.ReceivedAt.IsZero() {
+		batch.ReceivedAt = time.Now()
+	}
+	if !batch.ExpiresAt.After(batch.ReceivedAt) {
+		return domain.StockBatch{}, errors.New("batch must expire after it is received")
+	}
+	if batch.IsExpired(time.Now()) {
+		return domain.StockBatch{}, errors.New("batch has already expired")
+	}
+	if _, err := s.productRepo.FindByID(ctx, batch.ProductID); err != nil {
+		logger.Error("Failed to find batch product", err)
+		return domain.StockBatch{}, err
+	}
+
+	if err := s.batchRepo.Receive(ctx, &batch, fmt.Sprintf("admin:%d", adminID)); err != nil {
+		logger.Error("Failed to receive stock batch", err)
+		return domain.StockBatch{}, err
+	}
+
+	return batch, nil
+}
+
+func (s *inventoryService) GetBatches(ctx context.Context, productID uint64) ([]domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get stock batches")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.batchRepo.FindOpenByProductID(ctx, productID)
+}
+
+func (s *inventoryService) AdjustBatch(ctx context.Context, productID, batchID uint64, adjustment domain.BatchAdjustment) (domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when adjusting stock batch")
+		return domain.StockBatch{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if adjustment.CostPrice != nil && adjustment.CostPrice.IsNegative() {
+		return domain.StockBatch{}, errors.New("cost price cannot be negative")
+	}
+
+	batch, err := s.batchRepo.Adjust(ctx, productID, batchID, adjustment)
+	if err != nil {
+		logger.Error("Failed to adjust stock batch", err)
+		return domain.StockBatch{}, err
+	}
+
+	return batch, nil
+}
+
+// AdjustStock changes a product's stock by hand. Restocks and returns add
+// stock, write-offs remove it and corrections go either way.
+func (s *inventoryService) AdjustStock(ctx context.Context, adminID uint, adjustment domain.StockAdjustment) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when adjusting stock")
+		return domain.Product{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if !adjustment.Reason.IsManual() {
+		return domain.Product{}, fmt.Errorf("stock cannot be adjusted with reason %s", adjustment.Reason)
+	}
+	switch {
+	case adjustment.Quantity == 0:
+		return domain.Product{}, errors.New("quantity cannot be 0")
+	case adjustment.Quantity < 0 && (adjustment.Reason == domain.MovementReasonRestock || adjustment.Reason == domain.MovementReasonReturn):
+		return domain.Product{}, fmt.Errorf("%s must add stock", adjustment.Reason)
+	case adjustment.Quantity > 0 && adjustment.Reason == domain.MovementReasonWriteOff:
+		return domain.Product{}, errors.New("WRITE_OFF must remove stock")
+	}
+
+	product, err := s.stockRepo.AdjustStock(ctx, adjustment, fmt.Sprintf("admin:%d", adminID))
+	if err != nil {
+		logger.Error("Failed to adjust stock", err)
+		return domain.Product{}, err
+	}
+
+	return product, nil
+}
+
+// GetMovements returns a page of the product's stock movements, newest first
+func (s *inventoryService) GetMovements(ctx context.Context, productID uint64, page, limit int) ([]domain.InventoryMovement, int64, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get inventory movements")
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultMovementLimit
+	}
+	if limit > maxMovementLimit {
+		limit = maxMovementLimit
+	}
+
+	return s.movementRepo.FindByProductID(ctx, productID, (page-1)*limit, limit)
+}
+
+// GetExpiringStock reports stock left in batches expiring within the given
+// number of days, grouped by product and soonest first
+func (s *inventoryService) GetExpiringStock(ctx context.Context, days int) ([]domain.ExpiringStock, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get expiring stock")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	if days < 0 {
+		return nil, errors.New("days cannot be negative")
+	}
+
+	batches, err := s.batchRepo.FindExpiring(ctx, time.Now().AddDate(0, 0, days))
+	if err != nil {
+		logger.Error("Failed to find expiring stock batches", err)
+		return nil, err
+	}
+
+	report := make([]domain.ExpiringStock, 0)
+	index := make(map[uint64]int)
+	for _, batch := range batches {
+		i, ok := index[batch.ProductID]
+		if !ok {
+			product, err := s.productRepo.FindByID(ctx, batch.ProductID)
+			if err != nil {
+				logger.Error("Failed to find expiring product", err)
+				return nil, err
+			}
+
+			i = len(report)
+			index[batch.ProductID] = i
+			report = append(report, domain.ExpiringStock{
+				ProductID:   product.ID,
+				ProductName: product.ProductName,
+			})
+		}
+
+		report[i].Quantity += batch.Remaining
+		report[i].CostValue = report[i].CostValue.Add(batch.RemainingCost())
+		report[i].Batches = append(report[i].Batches, batch)
+	}
+
+	return report, nil
+}
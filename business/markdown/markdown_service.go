@@ -0,0 +1,221 @@
+package markdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/orders"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"sort"
+	"time"
+)
+
+// MarkdownRepository contract interface
+type MarkdownRepository interface {
+	CreateRule(ctx context.Context, rule *domain.MarkdownRule) error
+	FindRules(ctx context.Context) ([]domain.MarkdownRule, error)
+	DeleteRule(ctx context.Context, id uint64) error
+	// FindMarkdownCandidates returns products that have open batches or a
+	// markdown on them, with their open batches loaded
+	FindMarkdownCandidates(ctx context.Context) ([]domain.Product, error)
+	SetMarkdown(ctx context.Context, productID uint64, outcome domain.MarkdownOutcome) error
+	// WriteOff closes the batch and takes what is left of it out of the
+	// product's stock
+	WriteOff(ctx context.Context, batchID uint64, at time.Time) error
+}
+
+type markdownService struct {
+	markdownRepo MarkdownRepository
+	txManager    orders.Transactor
+}
+
+func NewMarkdownService(markdownRepo MarkdownRepository, txManager orders.Transactor) *markdownService {
+	return &markdownService{
+		markdownRepo: markdownRepo,
+		txManager:    txManager,
+	}
+}
+
+// Plan works out what a markdown run does to the product at the given time.
+// Expired batches are written off, the earliest batch with stock left on sale
+// picks the markdown rule.
+func Plan(p domain.Product, rules []domain.MarkdownRule, at time.Time) domain.MarkdownOutcome {
+	outcome := domain.MarkdownOutcome{
+		ProductID:   p.ID,
+		ProductName: p.ProductName,
+		Action:      domain.MarkdownActionKeep,
+		IsGreenTag:  p.IsGreenTag,
+		SalePrice:   p.SalePrice,
+		Discount:    p.Discount,
+	}
+
+	batches := make([]domain.StockBatch, len(p.Batches))
+	copy(batches, p.Batches)
+	sort.Slice(batches, func(i, j int) bool { return batches[i].ExpiresAt.Before(batches[j].ExpiresAt) })
+
+	var next *domain.StockBatch
+	for i := range batches {
+		if batches[i].IsExpired(at) {
+			outcome.WriteOffs = append(outcome.WriteOffs, domain.BatchWriteOff{
+				BatchID:   batches[i].ID,
+				ExpiresAt: batches[i].ExpiresAt,
+				Quantity:  batches[i].Remaining,
+			})
+			continue
+		}
+		if next == nil && batches[i].Remaining > 0 {
+			next = &batches[i]
+		}
+	}
+
+	var rule *domain.MarkdownRule
+	if next != nil {
+		expiresAt := next.ExpiresAt
+		daysLeft := next.DaysLeft(at)
+		outcome.ExpiresAt = &expiresAt
+		outcome.DaysLeft = &daysLeft
+
+		for i := range rules {
+			if rules[i].AppliesTo(p, daysLeft) && (rule == nil || rules[i].DiscountPercent > rule.DiscountPercent) {
+				rule = &rules[i]
+			}
+		}
+	}
+
+	switch {
+	case rule != nil:
+		ruleID := rule.ID
+		outcome.RuleID = &ruleID
+		outcome.IsGreenTag = true
+		outcome.Discount = rule.DiscountPercent
+		outcome.SalePrice = p.NormalPrice.Sub(p.NormalPrice.Percent(rule.DiscountPercent)).Round()
+		if p.MarkdownRuleID == nil || *p.MarkdownRuleID != ruleID || !p.IsGreenTag ||
+			p.Discount != outcome.Discount || p.SalePrice.Cmp(outcome.SalePrice) != 0 {
+			outcome.Action = domain.MarkdownActionApply
+		}
+	case p.MarkdownRuleID != nil:
+		outcome.Action = domain.MarkdownActionClear
+		outcome.IsGreenTag = false
+		outcome.Discount = 0
+		outcome.SalePrice = domain.Money{}
+	}
+
+	return outcome
+}
+
+// PreviewMarkdowns returns what a markdown run would do now, without doing it.
+// Products the run leaves alone are left out.
+func (s *markdownService) PreviewMarkdowns(ctx context.Context) ([]domain.MarkdownOutcome, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when previewing markdowns")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.plan(ctx, time.Now())
+}
+
+// ApplyMarkdowns writes off expired batches and moves products on and off
+// green tag according to the markdown rules. It is run by the scheduler.
+func (s *markdownService) ApplyMarkdowns(ctx context.Context) error {
+	now := time.Now()
+	outcomes, err := s.plan(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	var applied, failed int
+	for _, outcome := range outcomes {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			for _, writeOff := range outcome.WriteOffs {
+				if err := s.markdownRepo.WriteOff(ctx, writeOff.BatchID, now); err != nil {
+					return err
+				}
+			}
+			if outcome.Action == domain.MarkdownActionKeep {
+				return nil
+			}
+
+			return s.markdownRepo.SetMarkdown(ctx, outcome.ProductID, outcome)
+		})
+		if err != nil {
+			failed++
+			logger.Warn("Failed to apply markdown", "product", outcome.ProductID, "error", err)
+			continue
+		}
+		applied++
+	}
+
+	if applied > 0 || failed > 0 {
+		logger.Info("Applied markdowns", "applied", applied, "failed", failed)
+	}
+	return nil
+}
+
+func (s *markdownService) plan(ctx context.Context, at time.Time) ([]domain.MarkdownOutcome, error) {
+	rules, err := s.markdownRepo.FindRules(ctx)
+	if err != nil {
+		logger.Error("Failed to find markdown rules", err)
+		return nil, err
+	}
+
+	products, err := s.markdownRepo.FindMarkdownCandidates(ctx)
+	if err != nil {
+		logger.Error("Failed to find markdown candidates", err)
+		return nil, err
+	}
+
+	outcomes := make([]domain.MarkdownOutcome, 0)
+	for _, p := range products {
+		outcome := Plan(p, rules, at)
+		if outcome.Action == domain.MarkdownActionKeep && len(outcome.WriteOffs) == 0 {
+			continue
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	return outcomes, nil
+}
+
+func (s *markdownService) CreateRule(ctx context.Context, rule domain.MarkdownRule) (domain.MarkdownRule, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when creating markdown rule")
+		return domain.MarkdownRule{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if rule.DaysLeft < 0 {
+		return domain.MarkdownRule{}, errors.New("days left cannot be negative")
+	}
+	if rule.DiscountPercent <= 0 || rule.DiscountPercent > 100 {
+		return domain.MarkdownRule{}, errors.New("discount percent must be between 0 and 100")
+	}
+
+	if err := s.markdownRepo.CreateRule(ctx, &rule); err != nil {
+		logger.Error("Failed to create markdown rule", err)
+		return domain.MarkdownRule{}, err
+	}
+
+	return rule, nil
+}
+
+func (s *markdownService) GetRules(ctx context.Context) ([]domain.MarkdownRule, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get markdown rules")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.markdownRepo.FindRules(ctx)
+}
+
+func (s *markdownService) DeleteRule(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when deleting markdown rule")
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return s.markdownRepo.DeleteRule(ctx, id)
+}
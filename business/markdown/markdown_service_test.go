@@ -0,0 +1,197 @@
+package markdown
+
+import (
+	"myGreenMarket/domain"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.Add(time.Duration(n) * 24 * time.Hour) }
+	ruleID := func(id uint64) *uint64 { return &id }
+
+	rules := []domain.MarkdownRule{
+		{ID: 1, DaysLeft: 3, DiscountPercent: 20},
+		{ID: 2, DaysLeft: 1, DiscountPercent: 50},
+		{ID: 3, DaysLeft: 5, DiscountPercent: 30, ProductCategory: "Buah"},
+	}
+	product := domain.Product{
+		ID:              10,
+		ProductName:     "Bayam",
+		ProductCategory: "Sayur",
+		NormalPrice:     domain.IDR(10000),
+	}
+	with := func(batches []domain.StockBatch, change func(p *domain.Product)) domain.Product {
+		p := product
+		p.Batches = batches
+		if change != nil {
+			change(&p)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name          string
+		product       domain.Product
+		wantAction    domain.MarkdownAction
+		wantRule      *uint64
+		wantSalePrice domain.Money
+		wantGreenTag  bool
+		wantDaysLeft  int
+		wantWriteOffs []uint64
+	}{
+		{
+			name:       "no batches",
+			product:    with(nil, nil),
+			wantAction: domain.MarkdownActionKeep,
+		},
+		{
+			name:         "fresh stock",
+			product:      with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(10)}}, nil),
+			wantAction:   domain.MarkdownActionKeep,
+			wantDaysLeft: 10,
+		},
+		{
+			name:          "close to expiry",
+			product:       with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(2)}}, nil),
+			wantAction:    domain.MarkdownActionApply,
+			wantRule:      ruleID(1),
+			wantSalePrice: domain.IDR(8000),
+			wantGreenTag:  true,
+			wantDaysLeft:  2,
+		},
+		{
+			name:          "deepest matching discount wins",
+			product:       with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: now.Add(6 * time.Hour)}}, nil),
+			wantAction:    domain.MarkdownActionApply,
+			wantRule:      ruleID(2),
+			wantSalePrice: domain.IDR(5000),
+			wantGreenTag:  true,
+			wantDaysLeft:  1,
+		},
+		{
+			name: "category rule only for its category",
+			product: with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(4)}}, func(p *domain.Product) {
+				p.ProductCategory = "Buah"
+			}),
+			wantAction:    domain.MarkdownActionApply,
+			wantRule:      ruleID(3),
+			wantSalePrice: domain.IDR(7000),
+			wantGreenTag:  true,
+			wantDaysLeft:  4,
+		},
+		{
+			name: "earliest batch with stock picks the rule",
+			product: with([]domain.StockBatch{
+				{ID: 1, Remaining: 5, ExpiresAt: days(9)},
+				{ID: 2, Remaining: 0, ExpiresAt: days(1)},
+				{ID: 3, Remaining: 2, ExpiresAt: days(3)},
+			}, nil),
+			wantAction:    domain.MarkdownActionApply,
+			wantRule:      ruleID(1),
+			wantSalePrice: domain.IDR(8000),
+			wantGreenTag:  true,
+			wantDaysLeft:  3,
+		},
+		{
+			name: "expired batches are written off",
+			product: with([]domain.StockBatch{
+				{ID: 1, Remaining: 4, ExpiresAt: days(-1)},
+				{ID: 2, Remaining: 1, ExpiresAt: now},
+				{ID: 3, Remaining: 5, ExpiresAt: days(8)},
+			}, nil),
+			wantAction:    domain.MarkdownActionKeep,
+			wantDaysLeft:  8,
+			wantWriteOffs: []uint64{1, 2},
+		},
+		{
+			name: "markdown already applied",
+			product: with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(2)}}, func(p *domain.Product) {
+				p.MarkdownRuleID = ruleID(1)
+				p.IsGreenTag = true
+				p.Discount = 20
+				p.SalePrice = domain.IDR(8000)
+			}),
+			wantAction:    domain.MarkdownActionKeep,
+			wantRule:      ruleID(1),
+			wantSalePrice: domain.IDR(8000),
+			wantGreenTag:  true,
+			wantDaysLeft:  2,
+		},
+		{
+			name: "markdown moves to a deeper rule",
+			product: with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(1)}}, func(p *domain.Product) {
+				p.MarkdownRuleID = ruleID(1)
+				p.IsGreenTag = true
+				p.Discount = 20
+				p.SalePrice = domain.IDR(8000)
+			}),
+			wantAction:    domain.MarkdownActionApply,
+			wantRule:      ruleID(2),
+			wantSalePrice: domain.IDR(5000),
+			wantGreenTag:  true,
+			wantDaysLeft:  1,
+		},
+		{
+			name: "markdown cleared once the old batch is gone",
+			product: with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(10)}}, func(p *domain.Product) {
+				p.MarkdownRuleID = ruleID(1)
+				p.IsGreenTag = true
+				p.Discount = 20
+				p.SalePrice = domain.IDR(8000)
+			}),
+			wantAction:   domain.MarkdownActionClear,
+			wantDaysLeft: 10,
+		},
+		{
+			name: "green tag set by hand is left alone",
+			product: with([]domain.StockBatch{{ID: 1, Remaining: 5, ExpiresAt: days(10)}}, func(p *domain.Product) {
+				p.IsGreenTag = true
+				p.SalePrice = domain.IDR(9000)
+			}),
+			wantAction:    domain.MarkdownActionKeep,
+			wantSalePrice: domain.IDR(9000),
+			wantGreenTag:  true,
+			wantDaysLeft:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Plan(tt.product, rules, now)
+
+			if got.Action != tt.wantAction {
+				t.Errorf("Action = %s, want %s", got.Action, tt.wantAction)
+			}
+			switch {
+			case tt.wantRule == nil && got.RuleID != nil:
+				t.Errorf("RuleID = %d, want none", *got.RuleID)
+			case tt.wantRule != nil && (got.RuleID == nil || *got.RuleID != *tt.wantRule):
+				t.Errorf("RuleID = %v, want %d", got.RuleID, *tt.wantRule)
+			}
+			if got.SalePrice.Cmp(tt.wantSalePrice) != 0 {
+				t.Errorf("SalePrice = %s, want %s", got.SalePrice, tt.wantSalePrice)
+			}
+			if got.IsGreenTag != tt.wantGreenTag {
+				t.Errorf("IsGreenTag = %t, want %t", got.IsGreenTag, tt.wantGreenTag)
+			}
+			if tt.wantDaysLeft == 0 {
+				if got.DaysLeft != nil {
+					t.Errorf("DaysLeft = %d, want none", *got.DaysLeft)
+				}
+			} else if got.DaysLeft == nil || *got.DaysLeft != tt.wantDaysLeft {
+				t.Errorf("DaysLeft = %v, want %d", got.DaysLeft, tt.wantDaysLeft)
+			}
+
+			if len(got.WriteOffs) != len(tt.wantWriteOffs) {
+				t.Fatalf("WriteOffs = %+v, want batches %v", got.WriteOffs, tt.wantWriteOffs)
+			}
+			for i, writeOff := range got.WriteOffs {
+				if writeOff.BatchID != tt.wantWriteOffs[i] {
+					t.Errorf("WriteOffs[%d] = batch %d, want %d", i, writeOff.BatchID, tt.wantWriteOffs[i])
+				}
+			}
+		})
+	}
+}
@@ -3,110 +3,410 @@ package orders
 import (
 	"context"
 	"errors"
+	"fmt"
+	"myGreenMarket/business/cart"
 	"myGreenMarket/business/product"
 	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
 	"time"
 )
 
 type OrdersRepository interface {
-	CreateOrder(data domain.Orders) (domain.Orders, error)
-	GetAllOrders(user_id int) ([]domain.Orders, error)
-	GetOrder(order_id, user_id int) (domain.Orders, error)
-	GetOrderStatus(status string, user_id int) (domain.Orders, error)
-	UpdateOrder(data domain.Orders) error
-	DeleteOrder(order_id, user_id int) error
+	CreateOrder(ctx context.Context, data domain.Orders) (domain.Orders, error)
+	GetAllOrders(ctx context.Context, user_id int) ([]domain.Orders, error)
+	GetOrder(ctx context.Context, order_id, user_id int) (domain.Orders, error)
+	LockOrder(ctx context.Context, order_id, user_id int) (domain.Orders, error)
+	GetOrderStatus(ctx context.Context, status string, user_id int) (domain.Orders, error)
+	UpdateOrder(ctx context.Context, data domain.Orders) error
+	GetOrderByID(ctx context.Context, order_id int) (domain.Orders, error)
+	UpdateOrderItem(ctx context.Context, data domain.OrderItem) error
+	UpdateOrderStatus(ctx context.Context, data domain.Orders, history domain.OrderStatusHistory) error
+	GetStatusHistory(ctx context.Context, order_id int) ([]domain.OrderStatusHistory, error)
+	GetStaleOrders(ctx context.Context, status domain.OrderStatus, before time.Time, limit int) ([]domain.Orders, error)
 }
 
+// Transactor runs fn in one database transaction. Repository calls made with
+// the ctx passed to fn are committed or rolled back together.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// StockRepository reserves stock for orders, see domain.StockReservation.
+// actor is recorded on the inventory movements of every stock change.
+type StockRepository interface {
+	Reserve(ctx context.Context, orderID int, items []domain.OrderItem, actor string) error
+	Adjust(ctx context.Context, orderID, productID, quantity int, actor string) error
+	Commit(ctx context.Context, orderID int) error
+	Release(ctx context.Context, orderID int, actor string) error
+	Restock(ctx context.Context, orderID int, items []domain.OrderItem, actor string) error
+}
+
+// PaymentCloser closes an order's open invoices so they can no longer be paid,
+// see business/payments. An invoice paid meanwhile is settled as paid.
+type PaymentCloser interface {
+	CloseOrderPayments(ctx context.Context, orderID int, actor string) error
+}
+
+// ChangeStatus moves the order to a new status if the transition table allows
+// it and records who did it and why. Every status change, including the ones
+// made by payments, goes through here.
+func ChangeStatus(ctx context.Context, repo OrdersRepository, order *domain.Orders, to domain.OrderStatus, actor, reason string) error {
+	if !order.OrderStatus.CanTransitionTo(to) {
+		return &domain.InvalidTransitionError{From: order.OrderStatus, To: to}
+	}
+
+	now := time.Now()
+	updated := *order
+	updated.OrderStatus = to
+	updated.UpdatedAt = now
+
+	err := repo.UpdateOrderStatus(ctx, updated, domain.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.OrderStatus,
+		ToStatus:   to,
+		Actor:      actor,
+		Reason:     reason,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return err
+	}
+
+	*order = updated
+	return nil
+}
+
+// expiryBatch caps how many orders one expiry run handles
+const expiryBatch = 200
+
 type OrdersService struct {
 	orderRepo    OrdersRepository
 	productsRepo product.ProductRepository
+	cartRepo     cart.CartRepository
+	stockRepo    StockRepository
+	pricer       product.Pricer
+	payments     PaymentCloser
+	txManager    Transactor
 }
 
-func NewOrdersService(orderRepo OrdersRepository, productsRepo product.ProductRepository) *OrdersService {
+func NewOrdersService(orderRepo OrdersRepository, productsRepo product.ProductRepository, cartRepo cart.CartRepository, stockRepo StockRepository, pricer product.Pricer, payments PaymentCloser, txManager Transactor) *OrdersService {
 	return &OrdersService{
 		orderRepo:    orderRepo,
 		productsRepo: productsRepo,
+		cartRepo:     cartRepo,
+		stockRepo:    stockRepo,
+		pricer:       pricer,
+		payments:     payments,
+		txManager:    txManager,
 	}
 }
 
 func (s *OrdersService) CreateOrder(data domain.Orders) (domain.Orders, error) {
-	product, err := s.productsRepo.FindByID(context.TODO(), uint64(data.ProductID))
+	return s.createOrder(context.TODO(), data)
+}
+
+func (s *OrdersService) createOrder(ctx context.Context, data domain.Orders) (domain.Orders, error) {
+	if len(data.Items) == 0 {
+		return domain.Orders{}, errors.New("order has no items")
+	}
+
+	// Merge repeated products into a single line
+	lines := make([]domain.OrderItem, 0, len(data.Items))
+	index := make(map[int]int)
+	for _, item := range data.Items {
+		if item.Quantity <= 0 {
+			return domain.Orders{}, errors.New("quantity must be greater than 0")
+		}
+		if i, ok := index[item.ProductID]; ok {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(lines)
+		lines = append(lines, domain.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	products := make([]domain.Product, 0, len(lines))
+	for i := range lines {
+		product, err := s.productsRepo.FindByID(ctx, uint64(lines[i].ProductID))
+		if err != nil {
+			return domain.Orders{}, err
+		}
+		if product.Quantity == 0 {
+			return domain.Orders{}, errors.New("product stock is empty")
+		}
+		if product.Quantity < float64(lines[i].Quantity) {
+			return domain.Orders{}, domain.ErrInsufficientStock
+		}
+		products = append(products, product)
+	}
+
+	prices, err := s.pricer.UnitPrices(ctx, products)
 	if err != nil {
 		return domain.Orders{}, err
 	}
-	if product.Quantity == 0 {
-		return domain.Orders{}, errors.New("product stock is empty")
-	}
-	if product.Quantity < float64(data.Quantity) {
-		return domain.Orders{}, errors.New("insufficient stock")
+
+	// Each line keeps the price it was sold at, later price changes and
+	// promotions ending do not touch placed orders
+	data.TotalAmount = domain.Money{}
+	for i := range lines {
+		lines[i].ProductName = products[i].ProductName
+		lines[i].ListPrice = prices[i].ListPrice
+		lines[i].Discount = prices[i].Discount
+		lines[i].PriceSource = prices[i].Source
+		lines[i].PromotionID = prices[i].PromotionID
+		lines[i].PriceEach = prices[i].UnitPrice
+		lines[i].Subtotal = prices[i].UnitPrice.Mul(int64(lines[i].Quantity))
+		data.TotalAmount = data.TotalAmount.Add(lines[i].Subtotal)
 	}
 
-	data.PriceEach = product.NormalPrice
-	data.Subtotal = product.NormalPrice * float64(data.Quantity)
-	data.OrderStatus = "PENDING"
+	data.Items = lines
+	data.OrderStatus = domain.OrderStatusPending
 	data.CreatedAt = time.Now()
 	data.UpdatedAt = time.Now()
 
-	return s.orderRepo.CreateOrder(data)
+	var order domain.Orders
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = s.orderRepo.CreateOrder(ctx, data)
+		if err != nil {
+			return err
+		}
+
+		// Another buyer may have taken the stock since the check above
+		return s.stockRepo.Reserve(ctx, order.ID, order.Items, fmt.Sprintf("user:%d", order.UserID))
+	})
+	if err != nil {
+		return domain.Orders{}, err
+	}
+
+	return order, nil
 }
+
+// Checkout turns the user's cart into a single order and empties the cart
+func (s *OrdersService) Checkout(user_id int) (domain.Orders, error) {
+	ctx := context.TODO()
+	cartItems, err := s.cartRepo.FindByUserID(ctx, uint(user_id))
+	if err != nil {
+		return domain.Orders{}, err
+	}
+	if len(cartItems) == 0 {
+		return domain.Orders{}, errors.New("cart is empty")
+	}
+
+	items := make([]domain.OrderItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		items = append(items, domain.OrderItem{
+			ProductID: int(item.ProductID),
+			Quantity:  item.Quantity,
+		})
+	}
+
+	var order domain.Orders
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = s.createOrder(ctx, domain.Orders{
+			UserID: user_id,
+			Items:  items,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.cartRepo.Clear(ctx, uint(user_id))
+	})
+	if err != nil {
+		return domain.Orders{}, err
+	}
+
+	return order, nil
+}
+
 func (s *OrdersService) GetAllOrders(user_id int) ([]domain.Orders, error) {
-	return s.orderRepo.GetAllOrders(user_id)
+	return s.orderRepo.GetAllOrders(context.TODO(), user_id)
 }
 func (s *OrdersService) GetOrder(order_id, user_id int) (domain.Orders, error) {
-	return s.orderRepo.GetOrder(order_id, user_id)
+	return s.orderRepo.GetOrder(context.TODO(), order_id, user_id)
 }
 
 func (s *OrdersService) GetOrderStatus(status string, user_id int) (domain.Orders, error) {
-	return s.orderRepo.GetOrderStatus(status, user_id)
+	return s.orderRepo.GetOrderStatus(context.TODO(), status, user_id)
 }
 
-func (s *OrdersService) UpdateOrder(data domain.Orders) error {
-	order, err := s.orderRepo.GetOrder(data.ID, data.UserID)
+// UpdateOrder changes the quantity of a single line on a pending order. The
+// order is locked while it is checked and changed, so it cannot move on to
+// awaiting payment with the old total.
+func (s *OrdersService) UpdateOrder(order_id, user_id int, item domain.OrderItem) error {
+	if item.Quantity <= 0 {
+		return errors.New("quantity must be greater than 0")
+	}
+
+	return s.txManager.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		order, err := s.orderRepo.LockOrder(ctx, order_id, user_id)
+		if err != nil {
+			return err
+		}
+
+		if order.OrderStatus != domain.OrderStatusPending {
+			return fmt.Errorf("order is %s and cannot be updated", order.OrderStatus)
+		}
+
+		if user_id != order.UserID {
+			return errors.New("this is not your order")
+		}
+
+		var line *domain.OrderItem
+		for i := range order.Items {
+			if order.Items[i].ProductID == item.ProductID {
+				line = &order.Items[i]
+				break
+			}
+		}
+		if line == nil {
+			return errors.New("product is not in this order")
+		}
+
+		line.Quantity = item.Quantity
+		line.Subtotal = line.PriceEach.Mul(int64(item.Quantity))
+		order.TotalAmount = domain.Money{}
+		for _, l := range order.Items {
+			order.TotalAmount = order.TotalAmount.Add(l.Subtotal)
+		}
+		order.UpdatedAt = time.Now()
+
+		if err := s.stockRepo.Adjust(ctx, order.ID, line.ProductID, item.Quantity, fmt.Sprintf("user:%d", user_id)); err != nil {
+			return err
+		}
+		if err := s.orderRepo.UpdateOrderItem(ctx, *line); err != nil {
+			return err
+		}
+
+		return s.orderRepo.UpdateOrder(ctx, order)
+	})
+}
+
+// CancelOrder cancels the customer's order, the order itself is kept for its history
+func (s *OrdersService) CancelOrder(order_id, user_id int) error {
+	ctx := context.TODO()
+	order, err := s.orderRepo.GetOrder(ctx, order_id, user_id)
 	if err != nil {
 		return err
 	}
 
-	switch order.OrderStatus {
-	case "AWAITING_PAYMENT":
-		return errors.New("order is awaiting payment and cannot be updated")
-	case "PAID":
-		return errors.New("order have already been paid")
-	case "CANCELLED":
-		return errors.New("order cancelled")
+	_, err = s.cancel(ctx, order, fmt.Sprintf("user:%d", user_id), "cancelled by customer")
+	return err
+}
+
+// cancel cancels the order and gives its stock back. An order awaiting
+// payment has its invoice closed first, so it cannot be paid once the order
+// is gone.
+func (s *OrdersService) cancel(ctx context.Context, order domain.Orders, actor, reason string) (domain.Orders, error) {
+	if order.OrderStatus == domain.OrderStatusAwaitingPayment {
+		if err := s.payments.CloseOrderPayments(ctx, order.ID, actor); err != nil {
+			return domain.Orders{}, err
+		}
+
+		// Closing the invoice put the order back to PENDING, or to PAID when
+		// it was paid meanwhile, which cannot be cancelled
+		var err error
+		order, err = s.orderRepo.GetOrderByID(ctx, order.ID)
+		if err != nil {
+			return domain.Orders{}, err
+		}
+	}
+
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusCancelled, actor, reason); err != nil {
+			return err
+		}
+
+		return s.stockRepo.Release(ctx, order.ID, actor)
+	})
+	if err != nil {
+		return domain.Orders{}, err
 	}
 
-	if data.UserID != order.UserID {
-		return errors.New("this is not your order")
+	return order, nil
+}
+
+// UpdateOrderStatus is used by admins to move an order through fulfilment or
+// cancel it. PAID and the refund statuses are only ever set by the payments
+// and refunds that go with them.
+func (s *OrdersService) UpdateOrderStatus(order_id int, status domain.OrderStatus, admin_id int, reason string) (domain.Orders, error) {
+	if !status.IsValid() {
+		return domain.Orders{}, fmt.Errorf("unknown order status %s", status)
+	}
+	if !status.IsFulfilment() && status != domain.OrderStatusCancelled {
+		return domain.Orders{}, fmt.Errorf("order status %s cannot be set by hand", status)
 	}
-	product, err := s.productsRepo.FindByID(context.TODO(), uint64(order.ProductID))
+
+	ctx := context.TODO()
+	order, err := s.orderRepo.GetOrderByID(ctx, order_id)
 	if err != nil {
-		return err
+		return domain.Orders{}, err
 	}
-	if product.Quantity < float64(data.Quantity) {
-		return errors.New("insufficient stock")
+
+	if reason == "" {
+		reason = "updated by admin"
+	}
+	actor := fmt.Sprintf("admin:%d", admin_id)
+	if status == domain.OrderStatusCancelled {
+		return s.cancel(ctx, order, actor, reason)
 	}
 
-	data.ProductID = order.ProductID
-	data.OrderStatus = order.OrderStatus
-	data.PaymentMethod = order.PaymentMethod
-	data.PriceEach = order.PriceEach
-	data.Subtotal = order.PriceEach * float64(data.Quantity)
-	data.CreatedAt = order.CreatedAt
-	data.UpdatedAt = time.Now()
-	return s.orderRepo.UpdateOrder(data)
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return ChangeStatus(ctx, s.orderRepo, &order, status, actor, reason)
+	})
+	if err != nil {
+		return domain.Orders{}, err
+	}
+
+	return order, nil
 }
-func (s *OrdersService) DeleteOrder(order_id, user_id int) error {
-	order, err := s.orderRepo.GetOrder(order_id, user_id)
+
+// ExpireStaleOrders expires PENDING orders untouched for longer than ttl and
+// gives their reserved stock back. Orders awaiting payment are left to the
+// payment expiry, which returns them to PENDING once their invoice lapses.
+func (s *OrdersService) ExpireStaleOrders(ctx context.Context, ttl time.Duration) error {
+	stale, err := s.orderRepo.GetStaleOrders(ctx, domain.OrderStatusPending, time.Now().Add(-ttl), expiryBatch)
 	if err != nil {
 		return err
 	}
 
-	switch order.OrderStatus {
-	case "AWAITING_PAYMENT":
-		return errors.New("order is awaiting payment and cannot be deleted")
-	case "PAID":
-		return errors.New("order have already been paid")
+	var expired, failed int
+	for _, order := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusExpired, "system", "not paid in time"); err != nil {
+				return err
+			}
+
+			return s.stockRepo.Release(ctx, order.ID, "system")
+		})
+		if err != nil {
+			failed++
+			logger.Warn("Failed to expire order", "order", order.ID, "error", err)
+			continue
+		}
+		expired++
+	}
+
+	if expired > 0 || failed > 0 {
+		logger.Info("Expired stale orders", "expired", expired, "failed", failed)
+	}
+	return nil
+}
+
+func (s *OrdersService) GetOrderHistory(order_id, user_id int) ([]domain.OrderStatusHistory, error) {
+	ctx := context.TODO()
+	if _, err := s.orderRepo.GetOrder(ctx, order_id, user_id); err != nil {
+		return nil, err
 	}
 
-	return s.orderRepo.DeleteOrder(order_id, user_id)
+	return s.orderRepo.GetStatusHistory(ctx, order_id)
 }
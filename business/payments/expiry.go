@@ -0,0 +1,107 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// expiryBatch caps how many payments one expiry run handles
+const expiryBatch = 200
+
+// ExpireOverduePayments expires PENDING payments whose invoice has lapsed.
+// An invoice the gateway still holds open is expired there first so it can
+// no longer be paid. An invoice the gateway reports as paid is settled as
+// paid instead, the callback for it was lost.
+func (s *PaymentsService) ExpireOverduePayments(ctx context.Context) error {
+	now := time.Now()
+	overdue, err := s.paymentRepo.GetOverduePayments(ctx, now, now.Add(-topUpInvoiceDuration), expiryBatch)
+	if err != nil {
+		return err
+	}
+
+	var expired, paid, failed int
+	for _, payment := range overdue {
+		if ctx.Err() != nil {
+			break
+		}
+
+		status, err := s.expirePayment(ctx, payment, "system")
+		if err != nil {
+			failed++
+			logger.Warn("Failed to expire payment", "payment", payment.ID, "error", err)
+			continue
+		}
+		if status == "PAID" {
+			paid++
+		} else {
+			expired++
+		}
+	}
+
+	if expired > 0 || paid > 0 || failed > 0 {
+		logger.Info("Expired overdue payments", "expired", expired, "paid", paid, "failed", failed)
+	}
+	return nil
+}
+
+// CloseOrderPayments expires the order's open invoices at the gateway and
+// settles them, so none of them can be paid any more. An invoice the gateway
+// reports as paid is settled as paid.
+func (s *PaymentsService) CloseOrderPayments(ctx context.Context, orderID int, actor string) error {
+	payments, err := s.paymentRepo.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if payment.PaymentType != "ORDER" || payment.PaymentStatus != "PENDING" {
+			continue
+		}
+		if _, err := s.expirePayment(ctx, payment, actor); err != nil {
+			return fmt.Errorf("failed to close payment %d: %w", payment.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// expirePayment returns the status the payment was settled with
+func (s *PaymentsService) expirePayment(ctx context.Context, payment domain.Payments, actor string) (string, error) {
+	status := "EXPIRED"
+	var method string
+	amount := payment.Amount
+
+	if payment.InvoiceID != "" && (payment.Gateway == "" || payment.Gateway == s.gateway.Name()) {
+		invoice, err := s.gateway.ExpireInvoice(ctx, payment.InvoiceID)
+		switch {
+		case errors.Is(err, domain.ErrInvoiceNotFound):
+			// Nothing left open at the gateway
+		case err != nil:
+			// The invoice may already be closed, ask for its state before giving up
+			invoice, err = s.gateway.GetInvoice(ctx, payment.InvoiceID)
+			if err != nil {
+				return "", err
+			}
+			if invoice.Status == "PAID" || invoice.Status == "SETTLED" {
+				status = "PAID"
+				method = invoice.PaymentMethod
+				amount = invoice.Amount
+			} else if invoice.Status != "EXPIRED" {
+				return "", errors.New("gateway invoice is still open")
+			}
+		}
+	}
+
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.settlePayment(ctx, payment, status, method, amount, actor)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
@@ -2,42 +2,96 @@ package payments
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"myGreenMarket/business/orders"
 	"myGreenMarket/business/product"
 	"myGreenMarket/business/user"
+	"myGreenMarket/business/wallet"
 	"myGreenMarket/domain"
-	"myGreenMarket/internal/repository/xendit"
 	"myGreenMarket/internal/rest"
+	"myGreenMarket/pkg/logger"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type PaymentsRepository interface {
-	CreatePayment(data domain.Payments) (domain.Payments, error)
-	GetAllPayments(user_id int) ([]domain.Payments, error)
-	GetPayment(payment_id, user_id int) (domain.Payments, error)
-	UpdatePayment(data domain.Payments) error
-	DeletePayment(payment_id int) error
-	GetPaymentByOrderID(order_id int) (domain.Payments, error)
+	CreatePayment(ctx context.Context, data domain.Payments) (domain.Payments, error)
+	GetAllPayments(ctx context.Context, user_id int) ([]domain.Payments, error)
+	GetPayment(ctx context.Context, payment_id, user_id int) (domain.Payments, error)
+	GetPaymentByID(ctx context.Context, payment_id int) (domain.Payments, error)
+	LockPaymentByID(ctx context.Context, payment_id int) (domain.Payments, error)
+	GetPendingPayments(ctx context.Context, before time.Time, limit int) ([]domain.Payments, error)
+	GetOverduePayments(ctx context.Context, now, legacyBefore time.Time, limit int) ([]domain.Payments, error)
+	GetPendingRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Payments, error)
+	UpdatePayment(ctx context.Context, data domain.Payments) error
+	DeletePayment(ctx context.Context, payment_id int) error
+	GetPaymentByOrderID(ctx context.Context, order_id int) (domain.Payments, error)
+	GetPaymentsByOrderID(ctx context.Context, order_id int) ([]domain.Payments, error)
+}
+
+// WebhookEventRepository is the inbox that makes gateway callbacks idempotent
+type WebhookEventRepository interface {
+	Record(ctx context.Context, event domain.WebhookEvent) (domain.WebhookEvent, error)
+	FindByID(ctx context.Context, id uint64) (domain.WebhookEvent, error)
+	LockByID(ctx context.Context, id uint64) (domain.WebhookEvent, error)
+	FindByStatus(ctx context.Context, status string, limit, offset int) ([]domain.WebhookEvent, int64, error)
+	MarkProcessed(ctx context.Context, id uint64) error
+	MarkFailed(ctx context.Context, id uint64, reason string) error
+}
+
+const (
+	orderInvoiceDuration = time.Hour
+	topUpInvoiceDuration = 24 * time.Hour
+)
+
+// PaymentGateway is a payment provider that can take an order or top up
+// payment. The gateway in use is picked from config when the server starts.
+type PaymentGateway interface {
+	Name() string
+	CreateInvoice(ctx context.Context, invoice domain.InvoiceRequest) (domain.Invoice, error)
+	GetInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error)
+	ExpireInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error)
+	Refund(ctx context.Context, refund domain.RefundRequest) (domain.Refund, error)
+	GetRefund(ctx context.Context, refundID string) (domain.Refund, error)
+}
+
+type ReconciliationRepository interface {
+	Create(ctx context.Context, report domain.ReconciliationReport) (domain.ReconciliationReport, error)
+	FindAll(ctx context.Context, limit, offset int) ([]domain.ReconciliationReport, int64, error)
 }
 
 type PaymentsService struct {
 	paymentRepo PaymentsRepository
-	xenditRepo  *xendit.XenditRepository
+	gateway     PaymentGateway
 	userRepo    user.UserRepository
 	orderRepo   orders.OrdersRepository
 	productRepo product.ProductRepository
+	stockRepo   orders.StockRepository
+	walletRepo  wallet.WalletRepository
+	webhookRepo WebhookEventRepository
+	reportRepo  ReconciliationRepository
+	txManager   orders.Transactor
+
+	// reconciling stops a manual reconciliation from overlapping a scheduled one
+	reconciling sync.Mutex
 }
 
-func NewPaymentsService(paymentRepo PaymentsRepository, xenditRepo *xendit.XenditRepository, userRepo user.UserRepository, orderRepo orders.OrdersRepository, productRepo product.ProductRepository) *PaymentsService {
+func NewPaymentsService(paymentRepo PaymentsRepository, gateway PaymentGateway, userRepo user.UserRepository, orderRepo orders.OrdersRepository, productRepo product.ProductRepository, stockRepo orders.StockRepository, walletRepo wallet.WalletRepository, webhookRepo WebhookEventRepository, reportRepo ReconciliationRepository, txManager orders.Transactor) *PaymentsService {
 	return &PaymentsService{
 		paymentRepo: paymentRepo,
-		xenditRepo:  xenditRepo,
+		gateway:     gateway,
 		userRepo:    userRepo,
 		orderRepo:   orderRepo,
 		productRepo: productRepo,
+		stockRepo:   stockRepo,
+		walletRepo:  walletRepo,
+		webhookRepo: webhookRepo,
+		reportRepo:  reportRepo,
+		txManager:   txManager,
 	}
 }
 
@@ -47,53 +101,61 @@ func (s *PaymentsService) CreatePayment(data domain.Payments, isWallet bool, use
 		return domain.PaymentWithLink{}, errors.New("order id is nil, please add order id")
 	}
 
+	ctx := context.TODO()
+
 	if isWallet {
+		if err := s.closeOpenInvoices(ctx, *data.OrderID, user_id); err != nil {
+			return domain.PaymentWithLink{}, err
+		}
+
 		data.PaymentMethod = "WALLET"
 		data.PaymentStatus = "PAID"
 		data.CreatedAt = time.Now()
 		data.PaymentType = "ORDER"
 
-		user, err := s.userRepo.FindByID(context.TODO(), user_id)
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-		order, err := s.orderRepo.GetOrder(*data.OrderID, int(user_id))
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-
-		if user.Wallet < order.Subtotal {
-			return domain.PaymentWithLink{}, errors.New("insufficient wallet balance")
-		}
-
-		if order.OrderStatus == "PAID" {
-			return domain.PaymentWithLink{}, errors.New("this order have already been paid")
-		}
+		var payment domain.Payments
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			order, err := s.orderRepo.LockOrder(ctx, *data.OrderID, int(user_id))
+			if err != nil {
+				return err
+			}
+			if err := s.checkNoPaymentPending(ctx, order.ID); err != nil {
+				return err
+			}
 
-		product, err := s.productRepo.FindByID(context.TODO(), uint64(order.ProductID))
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-		if product.Quantity == 0 {
-			return domain.PaymentWithLink{}, errors.New("product stock is empty")
-		}
+			if !order.OrderStatus.CanTransitionTo(domain.OrderStatusPaid) {
+				return &domain.InvalidTransitionError{From: order.OrderStatus, To: domain.OrderStatusPaid}
+			}
 
-		payment, err := s.paymentRepo.CreatePayment(data)
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
+			err = s.commitStock(ctx, order, fmt.Sprintf("user:%d", user_id))
+			if err != nil {
+				return err
+			}
 
-		user.Wallet -= order.Subtotal
+			data.Amount = order.TotalAmount
+			payment, err = s.paymentRepo.CreatePayment(ctx, data)
+			if err != nil {
+				return err
+			}
 
-		err = s.userRepo.Update(context.TODO(), &user)
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
+			// Rejected with ErrInsufficientBalance if the wallet cannot cover the order
+			_, err = s.walletRepo.Post(ctx, domain.WalletPosting{
+				UserID:        user_id,
+				Direction:     domain.WalletDirectionDebit,
+				EntryType:     domain.WalletEntryOrderPayment,
+				Amount:        order.TotalAmount,
+				ContraAccount: domain.LedgerAccountSales,
+				Reference:     fmt.Sprintf("order:%d", order.ID),
+				Description:   fmt.Sprintf("payment for order %d", order.ID),
+				CreatedBy:     fmt.Sprintf("user:%d", user_id),
+			})
+			if err != nil {
+				return err
+			}
 
-		order.OrderStatus = "PAID"
-		order.PaymentMethod = "WALLET"
-		order.UpdatedAt = time.Now()
-		err = s.orderRepo.UpdateOrder(order)
+			order.PaymentMethod = "WALLET"
+			return orders.ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusPaid, fmt.Sprintf("user:%d", user_id), "paid with wallet")
+		})
 		if err != nil {
 			return domain.PaymentWithLink{}, err
 		}
@@ -109,226 +171,649 @@ func (s *PaymentsService) CreatePayment(data domain.Payments, isWallet bool, use
 		}, nil
 
 	} else {
-		existing, err := s.paymentRepo.GetPaymentByOrderID(*data.OrderID)
-		if err == nil && existing.PaymentStatus == "PENDING" {
-			return domain.PaymentWithLink{}, errors.New("pending payment already exists for this order")
-		}
-
 		data.PaymentStatus = "PENDING"
 		data.CreatedAt = time.Now()
 		data.PaymentType = "ORDER"
 
-		user, err := s.userRepo.FindByID(context.TODO(), user_id)
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-		order, err := s.orderRepo.GetOrder(*data.OrderID, int(user_id))
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-		if order.OrderStatus == "PAID" {
-			return domain.PaymentWithLink{}, errors.New("this order have already been paid")
-		}
+		var payment domain.Payments
+		var request domain.InvoiceRequest
+		err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			user, err := s.userRepo.FindByID(ctx, user_id)
+			if err != nil {
+				return err
+			}
+			order, err := s.orderRepo.LockOrder(ctx, *data.OrderID, int(user_id))
+			if err != nil {
+				return err
+			}
+			if err := s.checkNoPaymentPending(ctx, order.ID); err != nil {
+				return err
+			}
+			if !order.OrderStatus.CanTransitionTo(domain.OrderStatusAwaitingPayment) {
+				return &domain.InvalidTransitionError{From: order.OrderStatus, To: domain.OrderStatusAwaitingPayment}
+			}
 
-		product, err := s.productRepo.FindByID(context.TODO(), uint64(order.ProductID))
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
-		if product.Quantity == 0 {
-			return domain.PaymentWithLink{}, errors.New("product stock is empty")
-		}
+			products, err := s.orderProducts(ctx, order)
+			if err != nil {
+				return err
+			}
 
-		payment, err := s.paymentRepo.CreatePayment(data)
-		if err != nil {
-			return domain.PaymentWithLink{}, err
-		}
+			data.Amount = order.TotalAmount
+			payment, err = s.paymentRepo.CreatePayment(ctx, data)
+			if err != nil {
+				return err
+			}
+
+			items := make([]domain.Item, 0, len(order.Items))
+			for i, line := range order.Items {
+				items = append(items, domain.Item{
+					Name:     line.ProductName,
+					Quantity: int64(line.Quantity),
+					Price:    line.PriceEach,
+					Category: products[i].ProductCategory,
+				})
+			}
 
-		paymentLink, err := s.xenditRepo.XenditInvoiceUrl("TRANSFER", user.FullName, user.Email, product.ProductName, product.ProductCategory, int(user.ID), int(product.ID), order.Quantity, payment.ID, order.Subtotal, order.PriceEach)
+			request = domain.InvoiceRequest{
+				ExternalID:  externalID(payment.ID, int(user.ID), order.ID, "TRANSFER"),
+				PayerEmail:  user.Email,
+				Description: fmt.Sprintf("payment order %s", order.TotalAmount),
+				Amount:      order.TotalAmount,
+				Duration:    orderInvoiceDuration,
+				Items:       items,
+			}
+
+			return orders.ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusAwaitingPayment, fmt.Sprintf("user:%d", user_id), "invoice requested")
+		})
 		if err != nil {
 			return domain.PaymentWithLink{}, err
 		}
 
-		order.OrderStatus = "AWAITING_PAYMENT"
-		order.UpdatedAt = time.Now()
-		err = s.orderRepo.UpdateOrder(order)
+		invoice, err := s.openInvoice(ctx, payment, request, fmt.Sprintf("user:%d", user_id))
 		if err != nil {
 			return domain.PaymentWithLink{}, err
 		}
 
-		if paymentLink == "" {
-			return domain.PaymentWithLink{}, errors.New("payment link doesnt generated, please try again!")
-		}
 		return domain.PaymentWithLink{
 			ID:            payment.ID,
 			UserID:        payment.UserID,
 			OrderID:       *payment.OrderID,
 			PaymentStatus: payment.PaymentStatus,
 			PaymentMethod: payment.PaymentMethod,
-			PaymentLink:   paymentLink,
+			PaymentLink:   invoice.InvoiceURL,
+			Instructions:  invoice.Instructions,
 			CreatedAt:     payment.CreatedAt,
 		}, nil
 	}
 }
+
+// checkNoPaymentPending refuses to pay an order that still has an open
+// invoice. It is called with the order row locked, so two payments of one
+// order cannot both get past it.
+func (s *PaymentsService) checkNoPaymentPending(ctx context.Context, orderID int) error {
+	payments, err := s.paymentRepo.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if payment.PaymentType == "ORDER" && payment.PaymentStatus == "PENDING" {
+			return errors.New("pending payment already exists for this order")
+		}
+	}
+
+	return nil
+}
+
+// closeOpenInvoices expires the order's open invoices before it is paid from
+// the wallet, so it cannot be paid twice. Nothing is closed when the wallet
+// cannot cover the order, the customer keeps the invoice they have.
+func (s *PaymentsService) closeOpenInvoices(ctx context.Context, orderID int, user_id uint) error {
+	order, err := s.orderRepo.GetOrder(ctx, orderID, int(user_id))
+	if err != nil {
+		return err
+	}
+	payments, err := s.paymentRepo.GetPaymentsByOrderID(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, user_id)
+	if err != nil {
+		return err
+	}
+	// Wallet money held by an open split payment comes back when it is closed
+	available := user.Wallet
+	open := false
+	for _, payment := range payments {
+		if payment.PaymentType == "ORDER" && payment.PaymentStatus == "PENDING" {
+			open = true
+			available = available.Add(payment.WalletAmount)
+		}
+	}
+	if !open {
+		return nil
+	}
+	if available.Cmp(order.TotalAmount) < 0 {
+		return domain.ErrInsufficientBalance
+	}
+
+	return s.CloseOrderPayments(ctx, order.ID, fmt.Sprintf("user:%d", user_id))
+}
+
 func (s *PaymentsService) GetAllPayments(user_id int) ([]domain.Payments, error) {
-	return s.paymentRepo.GetAllPayments(user_id)
+	return s.paymentRepo.GetAllPayments(context.TODO(), user_id)
 }
 func (s *PaymentsService) GetPayment(payment_id, user_id int) (domain.Payments, error) {
-	return s.paymentRepo.GetPayment(payment_id, user_id)
+	return s.paymentRepo.GetPayment(context.TODO(), payment_id, user_id)
+}
+
+// ReceivePaymentWebhook stores the callback in the webhook inbox and applies
+// it. A callback that was already processed is acknowledged without running
+// its side effects again.
+func (s *PaymentsService) ReceivePaymentWebhook(request rest.WebhookRequest, payload []byte) error {
+	eventID := request.ID
+	if eventID == "" {
+		eventID = request.ExternalID
+	}
+
+	event, err := s.webhookRepo.Record(context.TODO(), domain.WebhookEvent{
+		Provider:         "xendit",
+		EventID:          eventID,
+		EventStatus:      request.Status,
+		ExternalID:       request.ExternalID,
+		Payload:          string(payload),
+		ProcessingStatus: domain.WebhookEventReceived,
+		ReceivedAt:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if event.ProcessingStatus == domain.WebhookEventProcessed {
+		logger.Info("Skipping duplicate webhook event", "event_id", event.EventID, "status", event.EventStatus)
+		return nil
+	}
+
+	return s.processWebhookEvent(event.ID, request)
+}
+
+func (s *PaymentsService) ListWebhookEvents(status string, page, limit int) ([]domain.WebhookEvent, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	return s.webhookRepo.FindByStatus(context.TODO(), strings.ToUpper(status), limit, (page-1)*limit)
+}
+
+// ReplayWebhookEvent runs a stored callback again, for events that failed
+func (s *PaymentsService) ReplayWebhookEvent(id uint64) error {
+	event, err := s.webhookRepo.FindByID(context.TODO(), id)
+	if err != nil {
+		return err
+	}
+	if event.ProcessingStatus == domain.WebhookEventProcessed {
+		return errors.New("webhook event already processed")
+	}
+
+	var request rest.WebhookRequest
+	if err := json.Unmarshal([]byte(event.Payload), &request); err != nil {
+		return fmt.Errorf("invalid stored webhook payload: %w", err)
+	}
+
+	return s.processWebhookEvent(event.ID, request)
+}
+
+// processWebhookEvent applies the callback and marks the event processed in
+// the same transaction. The event row is locked first, so two deliveries of
+// one event can never both apply it.
+func (s *PaymentsService) processWebhookEvent(eventID uint64, request rest.WebhookRequest) error {
+	err := s.txManager.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		event, err := s.webhookRepo.LockByID(ctx, eventID)
+		if err != nil {
+			return err
+		}
+		if event.ProcessingStatus == domain.WebhookEventProcessed {
+			return nil
+		}
+
+		if err := s.applyPaymentWebhook(ctx, request); err != nil {
+			return err
+		}
+
+		return s.webhookRepo.MarkProcessed(ctx, eventID)
+	})
+	if err != nil {
+		if markErr := s.webhookRepo.MarkFailed(context.TODO(), eventID, err.Error()); markErr != nil {
+			logger.Error("Failed to mark webhook event failed", "event", eventID, "error", markErr)
+		}
+		return err
+	}
+
+	return nil
 }
-func (s *PaymentsService) ReceivePaymentWebhook(request rest.WebhookRequest) error {
+
+func (s *PaymentsService) applyPaymentWebhook(ctx context.Context, request rest.WebhookRequest) error {
 	externalID := strings.Split(request.ExternalID, "|")
+	if len(externalID) != 4 {
+		return fmt.Errorf("invalid external id %q", request.ExternalID)
+	}
 	paymentId, _ := strconv.Atoi(externalID[0])
 	userId, _ := strconv.Atoi(externalID[1])
-	productId, _ := strconv.Atoi(externalID[2])
-	purpose := externalID[3]
 
-	var errUpdate error
-	payment, err := s.paymentRepo.GetPayment(paymentId, userId)
+	payment, err := s.paymentRepo.GetPayment(ctx, paymentId, userId)
+	if err != nil {
+		return err
+	}
+
+	return s.settlePayment(ctx, payment, request.Status, request.PaymentMethod, request.Amount, "xendit")
+}
+
+// ConfirmPayment is how an admin marks a bank transfer as received, or a bank
+// transfer refund as sent back
+func (s *PaymentsService) ConfirmPayment(payment_id int, admin_id uint) (domain.Payments, error) {
+	var payment domain.Payments
+	err := s.txManager.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		var err error
+		payment, err = s.paymentRepo.GetPaymentByID(ctx, payment_id)
+		if err != nil {
+			return err
+		}
+		if payment.PaymentStatus != "PENDING" {
+			return fmt.Errorf("payment is %s and cannot be confirmed", payment.PaymentStatus)
+		}
+
+		if payment.PaymentType == "REFUND" {
+			// Other gateways report their refunds themselves, see SyncRefunds
+			if payment.Gateway != "bank_transfer" {
+				return errors.New("only bank transfer refunds can be confirmed")
+			}
+			err = s.settlePayment(ctx, payment, "REFUNDED", payment.PaymentMethod, payment.Amount, fmt.Sprintf("admin:%d", admin_id))
+		} else {
+			var amount domain.Money
+			amount, err = s.paymentAmount(ctx, payment)
+			if err != nil {
+				return err
+			}
+
+			err = s.settlePayment(ctx, payment, "PAID", "BANK_TRANSFER", amount, fmt.Sprintf("admin:%d", admin_id))
+		}
+		if err != nil {
+			return err
+		}
+
+		payment, err = s.paymentRepo.GetPaymentByID(ctx, payment_id)
+		return err
+	})
+	if err != nil {
+		return domain.Payments{}, err
+	}
+
+	return payment, nil
+}
+
+// settlePayment applies a PAID or EXPIRED invoice to the payment and whatever
+// it pays for, or a REFUNDED or FAILED refund to a REFUND payment. The payment
+// row is locked and read again first, so webhooks, admin confirmations and
+// reconciliation never settle one payment twice. Payments that are already
+// PAID, REFUNDED or FAILED, or already in the given status, are left alone.
+func (s *PaymentsService) settlePayment(ctx context.Context, payment domain.Payments, status, method string, amount domain.Money, actor string) error {
+	payment, err := s.paymentRepo.LockPaymentByID(ctx, payment.ID)
 	if err != nil {
 		return err
 	}
-	if payment.PaymentStatus == "PAID" {
+	switch payment.PaymentStatus {
+	case "PAID", "REFUNDED", "FAILED", status:
 		return nil
 	}
 
-	switch purpose {
-	case "TRANSFER":
-		order, err := s.orderRepo.GetOrder(*payment.OrderID, userId)
+	var errUpdate error
+	switch payment.PaymentType {
+	case "ORDER":
+		order, err := s.orderRepo.GetOrder(ctx, *payment.OrderID, payment.UserID)
 		if err != nil {
 			return err
 		}
-		switch request.Status {
+		switch status {
 		case "PAID":
+			// Like top ups, a gateway reporting a different amount fails the
+			// settlement and leaves it to reconciliation and an admin
+			if amount.IsPositive() {
+				expected, err := s.paymentAmount(ctx, payment)
+				if err != nil {
+					return err
+				}
+				if amount.Cmp(expected) != 0 {
+					logger.Warn("Paid amount does not match the invoice", "payment", payment.ID, "paid", amount, "invoiced", expected)
+					return fmt.Errorf("paid amount %s does not match invoiced amount %s", amount, expected)
+				}
+			}
 
-			payment.PaymentMethod = request.PaymentMethod
-			payment.PaymentStatus = request.Status
+			holdOpen := payment.PaymentStatus == "PENDING"
+			payment.PaymentMethod = method
+			payment.PaymentStatus = status
+
+			// The order was cancelled, expired or paid another way while the
+			// invoice was open, or the wallet part of this lapsed split payment
+			// was already given back. The money is kept for the customer.
+			if !order.OrderStatus.CanTransitionTo(domain.OrderStatusPaid) || (!holdOpen && payment.WalletAmount.IsPositive()) {
+				if err := s.refundLatePayment(ctx, order, payment, holdOpen, actor); err != nil {
+					return err
+				}
+				errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
+				break
+			}
 
-			product, err := s.productRepo.FindByID(context.TODO(), uint64(productId))
+			err = s.commitStock(ctx, order, actor)
 			if err != nil {
 				return err
 			}
 
-			if product.Quantity == 0 {
-				return errors.New("product stock is empty")
-			}
-			if product.Quantity < float64(request.Items[0].Quantity) {
-				return errors.New("insufficient stock")
+			if payment.WalletAmount.IsPositive() {
+				if err := s.captureWalletHold(ctx, payment, actor); err != nil {
+					return err
+				}
+				payment.PaymentMethod = "WALLET+" + method
 			}
 
-			err = s.orderRepo.UpdateOrder(domain.Orders{
-				ID:            order.ID,
-				UserID:        order.UserID,
-				ProductID:     order.ProductID,
-				Quantity:      order.Quantity,
-				PriceEach:     order.PriceEach,
-				Subtotal:      order.Subtotal,
-				OrderStatus:   "PAID",
-				PaymentMethod: request.PaymentMethod,
-				CreatedAt:     order.CreatedAt,
-				UpdatedAt:     time.Now(),
-			})
+			order.PaymentMethod = payment.PaymentMethod
+			err = orders.ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusPaid, actor, "invoice paid")
 			if err != nil {
 				return err
 			}
 
-			err = s.productRepo.Update(context.TODO(), &domain.Product{
-				ID:              product.ID,
-				ProductID:       product.ProductID,
-				ProductSKUID:    product.ProductSKUID,
-				IsGreenTag:      product.IsGreenTag,
-				ProductName:     product.ProductName,
-				ProductCategory: product.ProductCategory,
-				Unit:            product.Unit,
-				NormalPrice:     product.NormalPrice,
-				SalePrice:       product.SalePrice,
-				Discount:        product.Discount,
-				Quantity:        product.Quantity - float64(request.Items[0].Quantity),
-				CreatedAt:       product.CreatedAt,
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
+		case "EXPIRED":
+			// An order cancelled while its invoice was open has nothing to go back to
+			if order.OrderStatus == domain.OrderStatusAwaitingPayment {
+				err = orders.ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusPending, actor, "invoice expired")
+				if err != nil {
+					return err
+				}
+			}
+			if payment.WalletAmount.IsPositive() {
+				if err := s.releaseWalletHold(ctx, payment, actor); err != nil {
+					return err
+				}
+			}
+			payment.PaymentStatus = status
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
+
+		}
+	case "TOPUP":
+		switch status {
+		case "PAID":
+			// The wallet is credited what was invoiced. A gateway reporting a
+			// different amount fails the settlement, which leaves the webhook
+			// event or reconciliation result failed for an admin to look at.
+			if !payment.Amount.IsPositive() {
+				return errors.New("top up has no stored amount")
+			}
+			if amount.IsPositive() && amount.Cmp(payment.Amount) != 0 {
+				return fmt.Errorf("paid amount %s does not match top up amount %s", amount, payment.Amount)
+			}
+
+			_, err := s.walletRepo.Post(ctx, domain.WalletPosting{
+				UserID:        uint(payment.UserID),
+				Direction:     domain.WalletDirectionCredit,
+				EntryType:     domain.WalletEntryTopUp,
+				Amount:        payment.Amount,
+				ContraAccount: domain.LedgerAccountGateway,
+				Reference:     fmt.Sprintf("payment:%d", payment.ID),
+				Description:   "wallet top up",
+				CreatedBy:     actor,
 			})
 			if err != nil {
 				return err
 			}
 
-			errUpdate = s.paymentRepo.UpdatePayment(payment)
+			payment.PaymentMethod = method
+			payment.PaymentStatus = status
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
+
 		case "EXPIRED":
-			err = s.orderRepo.UpdateOrder(domain.Orders{
-				ID:            order.ID,
-				UserID:        order.UserID,
-				ProductID:     order.ProductID,
-				Quantity:      order.Quantity,
-				PriceEach:     order.PriceEach,
-				Subtotal:      order.Subtotal,
-				OrderStatus:   "PENDING",
-				PaymentMethod: request.PaymentMethod,
-				CreatedAt:     order.CreatedAt,
-				UpdatedAt:     time.Now(),
-			})
-			if err != nil {
+			payment.PaymentStatus = status
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
+		}
+	case "REFUND":
+		switch status {
+		case "REFUNDED":
+			if err := s.applyRefund(ctx, payment); err != nil {
 				return err
 			}
-			payment.PaymentStatus = request.Status
-			errUpdate = s.paymentRepo.UpdatePayment(payment)
+			payment.PaymentStatus = status
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
 
+		case "FAILED":
+			logger.Warn("Refund failed at the gateway", "payment", payment.ID, "order", payment.OrderID, "amount", payment.Amount)
+			payment.PaymentStatus = status
+			errUpdate = s.paymentRepo.UpdatePayment(ctx, payment)
 		}
-	case "TOPUP":
-		switch request.Status {
-		case "PAID":
-			user, err := s.userRepo.FindByID(context.TODO(), uint(userId))
-			if err != nil {
+	}
+
+	return errUpdate
+}
+
+// refundLatePayment credits the wallet with what the gateway took for an
+// order that can no longer be paid and records it as a REFUND payment. The
+// wallet part of a split payment is given back too while it is still held.
+func (s *PaymentsService) refundLatePayment(ctx context.Context, order domain.Orders, payment domain.Payments, holdOpen bool, actor string) error {
+	amount := payment.Amount
+	if payment.WalletAmount.IsPositive() {
+		amount = payment.GatewayAmount
+		if holdOpen {
+			if err := s.releaseWalletHold(ctx, payment, actor); err != nil {
 				return err
 			}
+		}
+	} else if !amount.IsPositive() {
+		amount = order.TotalAmount
+	}
+
+	refund, err := s.paymentRepo.CreatePayment(ctx, domain.Payments{
+		UserID:          payment.UserID,
+		OrderID:         payment.OrderID,
+		PaymentType:     "REFUND",
+		PaymentStatus:   "REFUNDED",
+		PaymentMethod:   "WALLET",
+		Amount:          amount,
+		ParentPaymentID: &payment.ID,
+		CreatedAt:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.walletRepo.Post(ctx, domain.WalletPosting{
+		UserID:        uint(payment.UserID),
+		Direction:     domain.WalletDirectionCredit,
+		EntryType:     domain.WalletEntryRefund,
+		Amount:        amount,
+		ContraAccount: domain.LedgerAccountGateway,
+		Reference:     fmt.Sprintf("refund:%d", refund.ID),
+		Description:   fmt.Sprintf("payment for order %d arrived after it was %s", order.ID, strings.ToLower(string(order.OrderStatus))),
+		CreatedBy:     actor,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Warn("Refunded late payment to wallet", "payment", payment.ID, "order", order.ID, "order_status", order.OrderStatus, "amount", amount)
+	return nil
+}
+
+// paymentAmount is what the payment's invoice asks for, the gateway part of a
+// split payment. Payments made before the amount was stored are priced from
+// their order.
+func (s *PaymentsService) paymentAmount(ctx context.Context, payment domain.Payments) (domain.Money, error) {
+	if payment.WalletAmount.IsPositive() {
+		return payment.GatewayAmount, nil
+	}
+	if payment.Amount.IsPositive() {
+		return payment.Amount, nil
+	}
+	if payment.OrderID == nil {
+		return domain.Money{}, errors.New("payment has no amount")
+	}
+
+	order, err := s.orderRepo.GetOrder(ctx, *payment.OrderID, payment.UserID)
+	if err != nil {
+		return domain.Money{}, err
+	}
+
+	return order.TotalAmount, nil
+}
+
+// openInvoice asks the gateway for the invoice of a PENDING payment that is
+// already committed, so no row stays locked while the gateway answers. A
+// payment the gateway opened no invoice for is expired again, which puts its
+// order back to PENDING, and an invoice that cannot be attached is expired at
+// the gateway, so nothing payable is left without a payment to match it.
+func (s *PaymentsService) openInvoice(ctx context.Context, payment domain.Payments, request domain.InvoiceRequest, actor string) (domain.Invoice, error) {
+	invoice, err := s.gateway.CreateInvoice(ctx, request)
+	if err != nil {
+		s.abandonPayment(ctx, payment, actor)
+		return domain.Invoice{}, err
+	}
 
-			user.Wallet = user.Wallet + float64(request.Amount)
-			err = s.userRepo.Update(context.TODO(), &user)
+	if invoice.InvoiceURL == "" && invoice.Instructions == "" {
+		err = errors.New("payment link doesnt generated, please try again!")
+	} else {
+		err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			// Read again under the lock, a fast callback may have settled it already
+			current, err := s.paymentRepo.LockPaymentByID(ctx, payment.ID)
 			if err != nil {
 				return err
 			}
+			return s.attachInvoice(ctx, &current, invoice)
+		})
+	}
+	if err != nil {
+		if invoice.ID != "" {
+			if _, errExpire := s.gateway.ExpireInvoice(ctx, invoice.ID); errExpire != nil {
+				logger.Error("Failed to expire unattached invoice", "payment", payment.ID, "invoice", invoice.ID, "error", errExpire)
+			}
+		}
+		s.abandonPayment(ctx, payment, actor)
+		return domain.Invoice{}, err
+	}
 
-			payment.PaymentMethod = request.PaymentMethod
-			payment.PaymentStatus = request.Status
-			errUpdate = s.paymentRepo.UpdatePayment(payment)
+	return invoice, nil
+}
 
-		case "EXPIRED":
-			payment.PaymentStatus = request.Status
-			errUpdate = s.paymentRepo.UpdatePayment(payment)
+// abandonPayment expires a payment that never got an invoice. A failure is
+// only logged, the expiry job picks the payment up later.
+func (s *PaymentsService) abandonPayment(ctx context.Context, payment domain.Payments, actor string) {
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.settlePayment(ctx, payment, "EXPIRED", "", payment.Amount, actor)
+	})
+	if err != nil {
+		logger.Error("Failed to expire payment without invoice", "payment", payment.ID, "error", err)
+	}
+}
+
+// attachInvoice stores the gateway invoice on its payment, the invoice id is
+// what later status checks and expiry are sent to the gateway with
+func (s *PaymentsService) attachInvoice(ctx context.Context, payment *domain.Payments, invoice domain.Invoice) error {
+	payment.Gateway = s.gateway.Name()
+	payment.InvoiceID = invoice.ID
+	payment.InvoiceURL = invoice.InvoiceURL
+	if !invoice.ExpiryDate.IsZero() {
+		expiresAt := invoice.ExpiryDate
+		payment.InvoiceExpiresAt = &expiresAt
+	}
+
+	return s.paymentRepo.UpdatePayment(ctx, *payment)
+}
+
+// externalID is the reference sent with every invoice, webhooks are matched
+// back to the payment with it
+func externalID(paymentID, userID, orderID int, purpose string) string {
+	return fmt.Sprintf("%d|%d|%d|%s", paymentID, userID, orderID, purpose)
+}
+
+// orderProducts loads every product on the order, in line order
+func (s *PaymentsService) orderProducts(ctx context.Context, order domain.Orders) ([]domain.Product, error) {
+	products := make([]domain.Product, 0, len(order.Items))
+	for _, line := range order.Items {
+		product, err := s.productRepo.FindByID(ctx, uint64(line.ProductID))
+		if err != nil {
+			return nil, err
 		}
+		products = append(products, product)
 	}
 
-	return errUpdate
+	return products, nil
+}
+
+// commitStock turns the order's stock reservation into a sale. Orders placed
+// before reservations existed have nothing to commit, so they reserve first.
+func (s *PaymentsService) commitStock(ctx context.Context, order domain.Orders, actor string) error {
+	err := s.stockRepo.Commit(ctx, order.ID)
+	if !errors.Is(err, domain.ErrNoActiveReservation) {
+		return err
+	}
+
+	if err := s.stockRepo.Reserve(ctx, order.ID, order.Items, actor); err != nil {
+		return err
+	}
+
+	return s.stockRepo.Commit(ctx, order.ID)
 }
+
 func (s *PaymentsService) DeletePayment(payment_id int) error {
-	return s.paymentRepo.DeletePayment(payment_id)
+	return s.paymentRepo.DeletePayment(context.TODO(), payment_id)
 }
 
-func (s *PaymentsService) TopUp(user_id uint, amount float64) (domain.TopUp, error) {
-	user, err := s.userRepo.FindByID(context.TODO(), user_id)
+func (s *PaymentsService) TopUp(user_id uint, amount domain.Money) (domain.TopUp, error) {
+	if !amount.IsPositive() {
+		return domain.TopUp{}, errors.New("amount must be greater than 0")
+	}
+
+	ctx := context.TODO()
+	user, err := s.userRepo.FindByID(ctx, user_id)
 	if err != nil {
 		return domain.TopUp{}, err
 	}
 
-	payment, err := s.paymentRepo.CreatePayment(domain.Payments{
+	payment, err := s.paymentRepo.CreatePayment(ctx, domain.Payments{
 		UserID:        int(user_id),
 		OrderID:       nil,
 		PaymentType:   "TOPUP",
 		PaymentStatus: "PENDING",
+		Amount:        amount,
 		CreatedAt:     time.Now(),
 	})
 	if err != nil {
 		return domain.TopUp{}, err
 	}
 
-	paymentLink, err := s.xenditRepo.XenditInvoiceUrl("TOPUP", user.FullName, user.Email, "Wallet", "Topup", int(user_id), 0, 1, payment.ID, amount, amount)
+	invoice, err := s.openInvoice(ctx, payment, domain.InvoiceRequest{
+		ExternalID:  externalID(payment.ID, int(user_id), 0, "TOPUP"),
+		PayerEmail:  user.Email,
+		Description: fmt.Sprintf("top up wallet %s", amount),
+		Amount:      amount,
+		Duration:    topUpInvoiceDuration,
+		Items: []domain.Item{
+			{
+				Name:     "Wallet",
+				Quantity: 1,
+				Price:    amount,
+				Category: "Topup",
+			},
+		},
+	}, fmt.Sprintf("user:%d", user_id))
 	if err != nil {
 		return domain.TopUp{}, err
 	}
-	if paymentLink == "" {
-		return domain.TopUp{}, errors.New("empty payment link")
-	}
 
 	return domain.TopUp{
-		ID:        payment.ID,
-		UserID:    user_id,
-		Amount:    amount,
-		TopUpLink: paymentLink,
+		ID:           payment.ID,
+		UserID:       user_id,
+		Amount:       amount,
+		TopUpLink:    invoice.InvoiceURL,
+		Instructions: invoice.Instructions,
 	}, nil
 }
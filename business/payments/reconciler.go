@@ -0,0 +1,161 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// reconcileBatch caps how many payments one reconciliation pass asks the gateway about
+const reconcileBatch = 200
+
+var ErrReconciliationRunning = errors.New("a reconciliation is already running")
+
+// Reconcile asks the gateway about every payment still PENDING after
+// olderThan and applies what it reports, the same way a webhook would have.
+// It is the safety net for callbacks that never arrived. Every pass is
+// stored as a report.
+func (s *PaymentsService) Reconcile(ctx context.Context, olderThan time.Duration, triggeredBy string) (domain.ReconciliationReport, error) {
+	if !s.reconciling.TryLock() {
+		return domain.ReconciliationReport{}, ErrReconciliationRunning
+	}
+	defer s.reconciling.Unlock()
+
+	report := domain.ReconciliationReport{
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+
+	pending, err := s.paymentRepo.GetPendingPayments(ctx, report.StartedAt.Add(-olderThan), reconcileBatch)
+	if err != nil {
+		return domain.ReconciliationReport{}, err
+	}
+
+	results := make([]domain.ReconciliationResult, 0, len(pending))
+	for _, payment := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := s.reconcilePayment(ctx, payment)
+		results = append(results, result)
+
+		report.Checked++
+		switch result.Action {
+		case domain.ReconcileActionPaid:
+			report.Paid++
+		case domain.ReconcileActionExpired:
+			report.Expired++
+		case domain.ReconcileActionPending:
+			report.StillPending++
+		case domain.ReconcileActionSkipped:
+			report.Skipped++
+		case domain.ReconcileActionFailed:
+			report.Failed++
+			logger.Warn("Failed to reconcile payment", "payment", result.PaymentID, "error", result.Error)
+		}
+	}
+
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return domain.ReconciliationReport{}, err
+	}
+	report.Results = string(resultsJSON)
+	report.FinishedAt = time.Now()
+
+	// The report is saved even when the caller's ctx was cancelled mid-pass
+	report, err = s.reportRepo.Create(context.WithoutCancel(ctx), report)
+	if err != nil {
+		return domain.ReconciliationReport{}, err
+	}
+
+	logger.Info("Payment reconciliation finished",
+		"triggered_by", triggeredBy,
+		"checked", report.Checked,
+		"paid", report.Paid,
+		"expired", report.Expired,
+		"failed", report.Failed,
+	)
+	return report, nil
+}
+
+func (s *PaymentsService) reconcilePayment(ctx context.Context, payment domain.Payments) domain.ReconciliationResult {
+	result := domain.ReconciliationResult{
+		PaymentID: payment.ID,
+		InvoiceID: payment.InvoiceID,
+	}
+
+	if payment.InvoiceID == "" {
+		result.Action = domain.ReconcileActionSkipped
+		result.Error = "payment has no gateway invoice"
+		return result
+	}
+	if payment.Gateway != "" && payment.Gateway != s.gateway.Name() {
+		result.Action = domain.ReconcileActionSkipped
+		result.Error = fmt.Sprintf("invoice belongs to gateway %s", payment.Gateway)
+		return result
+	}
+
+	invoice, err := s.gateway.GetInvoice(ctx, payment.InvoiceID)
+	if err != nil {
+		result.Action = domain.ReconcileActionFailed
+		result.Error = err.Error()
+		return result
+	}
+	result.GatewayStatus = invoice.Status
+
+	var status string
+	switch invoice.Status {
+	case "PAID", "SETTLED":
+		status = "PAID"
+		result.Action = domain.ReconcileActionPaid
+	case "EXPIRED":
+		status = "EXPIRED"
+		result.Action = domain.ReconcileActionExpired
+	default:
+		result.Action = domain.ReconcileActionPending
+		return result
+	}
+
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.settlePayment(ctx, payment, status, invoice.PaymentMethod, invoice.Amount, "reconciler")
+	})
+	if err != nil {
+		result.Action = domain.ReconcileActionFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// ReconcileScheduled is the scheduled reconciliation, it skips quietly when
+// an admin triggered run is still going
+func (s *PaymentsService) ReconcileScheduled(ctx context.Context, olderThan time.Duration) error {
+	_, err := s.Reconcile(ctx, olderThan, "scheduler")
+	if errors.Is(err, ErrReconciliationRunning) {
+		return nil
+	}
+
+	return err
+}
+
+// ReconcilePayments is the admin trigger, it reconciles every PENDING
+// payment older than olderThan right away
+func (s *PaymentsService) ReconcilePayments(admin_id uint, olderThan time.Duration) (domain.ReconciliationReport, error) {
+	return s.Reconcile(context.TODO(), olderThan, fmt.Sprintf("admin:%d", admin_id))
+}
+
+func (s *PaymentsService) ListReconciliationReports(page, limit int) ([]domain.ReconciliationReport, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	return s.reportRepo.FindAll(context.TODO(), limit, (page-1)*limit)
+}
@@ -0,0 +1,395 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/orders"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"sort"
+	"time"
+)
+
+// refundBatch caps how many refunds one sync run handles
+const refundBatch = 100
+
+// RefundOrder gives money back on a paid order, for the whole order or for
+// some of its lines. The refund is recorded as a REFUND payment linked to the
+// order's payment. Customers can only refund an order that has not been packed
+// yet, and its stock always goes back on sale. Admins can refund later in
+// fulfilment and choose whether to restock.
+//
+// Wallet refunds are settled right away. Gateway refunds are recorded as
+// PENDING before the gateway is called, and booked on the order only once
+// the gateway reports the money returned, see SyncRefunds.
+func (s *PaymentsService) RefundOrder(refund domain.OrderRefund, isAdmin bool) (domain.Payments, error) {
+	ctx := context.TODO()
+	if !isAdmin {
+		refund.Restock = true
+	}
+
+	var payment domain.Payments
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var order domain.Orders
+		var err error
+		if isAdmin {
+			order, err = s.orderRepo.GetOrderByID(ctx, refund.OrderID)
+		} else {
+			order, err = s.orderRepo.GetOrder(ctx, refund.OrderID, refund.UserID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !isAdmin && order.OrderStatus != domain.OrderStatusPaid {
+			return fmt.Errorf("order is %s, contact us to refund it", order.OrderStatus)
+		}
+		if !order.OrderStatus.CanTransitionTo(domain.OrderStatusRefunded) {
+			return &domain.InvalidTransitionError{From: order.OrderStatus, To: domain.OrderStatusRefunded}
+		}
+
+		original, err := s.orderPayment(ctx, order.ID)
+		if err != nil {
+			return err
+		}
+		// Locking the paid payment lets only one refund of the order through at a time
+		if _, err := s.paymentRepo.LockPaymentByID(ctx, original.ID); err != nil {
+			return err
+		}
+		if err := s.checkNoRefundPending(ctx, order.ID); err != nil {
+			return err
+		}
+
+		lines, amount, err := refundLines(order, refund.Lines)
+		if err != nil {
+			return err
+		}
+
+		payment = domain.Payments{
+			UserID:          order.UserID,
+			OrderID:         &order.ID,
+			PaymentType:     "REFUND",
+			PaymentStatus:   "PENDING",
+			PaymentMethod:   original.PaymentMethod,
+			Amount:          amount,
+			ParentPaymentID: &original.ID,
+			Refund: &domain.RefundDetails{
+				Lines:   lines,
+				Restock: refund.Restock,
+				Reason:  refund.Reason,
+				Actor:   refund.Actor,
+			},
+			CreatedAt: time.Now(),
+		}
+		// Split payments are refunded to the wallet, the gateway only holds part of them
+		toWallet := refund.ToWallet || original.PaymentMethod == "WALLET" || original.WalletAmount.IsPositive()
+		if toWallet {
+			payment.PaymentMethod = "WALLET"
+		} else {
+			if original.InvoiceID == "" || (original.Gateway != "" && original.Gateway != s.gateway.Name()) {
+				return errors.New("the original payment cannot be refunded through the gateway, refund to wallet instead")
+			}
+			payment.Gateway = s.gateway.Name()
+		}
+
+		payment, err = s.paymentRepo.CreatePayment(ctx, payment)
+		if err != nil {
+			return err
+		}
+		if !toWallet {
+			return nil
+		}
+
+		_, err = s.walletRepo.Post(ctx, domain.WalletPosting{
+			UserID:        uint(order.UserID),
+			Direction:     domain.WalletDirectionCredit,
+			EntryType:     domain.WalletEntryRefund,
+			Amount:        amount,
+			ContraAccount: domain.LedgerAccountRefunds,
+			Reference:     fmt.Sprintf("refund:%d", payment.ID),
+			Description:   fmt.Sprintf("refund for order %d", order.ID),
+			CreatedBy:     refund.Actor,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.settlePayment(ctx, payment, "REFUNDED", "WALLET", amount, refund.Actor)
+	})
+	if err != nil {
+		return domain.Payments{}, err
+	}
+
+	if payment.PaymentMethod != "WALLET" {
+		if err := s.sendRefund(ctx, payment); err != nil {
+			return domain.Payments{}, err
+		}
+	}
+
+	return s.paymentRepo.GetPaymentByID(ctx, payment.ID)
+}
+
+// SyncRefunds moves PENDING gateway refunds along. Refunds the gateway never
+// answered are sent again, the rest are asked about and settled once the
+// gateway reports them REFUNDED or FAILED.
+func (s *PaymentsService) SyncRefunds(ctx context.Context, olderThan time.Duration) error {
+	pending, err := s.paymentRepo.GetPendingRefunds(ctx, time.Now().Add(-olderThan), refundBatch)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, payment := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		if payment.Gateway != s.gateway.Name() {
+			continue
+		}
+
+		if payment.InvoiceID == "" {
+			err = s.sendRefund(ctx, payment)
+			if errors.Is(err, domain.ErrRefundRejected) {
+				// Settled as FAILED, nothing left to retry
+				continue
+			}
+		} else {
+			err = s.checkRefund(ctx, payment)
+		}
+		if err != nil {
+			failed++
+			logger.Warn("Failed to sync refund", "payment", payment.ID, "error", err)
+		}
+	}
+
+	if failed > 0 {
+		logger.Info("Synced pending refunds", "refunds", len(pending), "failed", failed)
+	}
+	return nil
+}
+
+// sendRefund asks the gateway to return a PENDING REFUND payment. The
+// reference is the payment's own id, so sending it again never refunds twice.
+// A refund the gateway did not answer stays PENDING to be sent again, a
+// refund it rejected is settled as FAILED.
+func (s *PaymentsService) sendRefund(ctx context.Context, payment domain.Payments) error {
+	if payment.ParentPaymentID == nil {
+		return errors.New("refund has no original payment")
+	}
+	original, err := s.paymentRepo.GetPaymentByID(ctx, *payment.ParentPaymentID)
+	if err != nil {
+		return err
+	}
+
+	var reason string
+	if payment.Refund != nil {
+		reason = payment.Refund.Reason
+	}
+	gatewayRefund, err := s.gateway.Refund(ctx, domain.RefundRequest{
+		InvoiceID:   original.InvoiceID,
+		ReferenceID: fmt.Sprintf("refund-%d", payment.ID),
+		Amount:      payment.Amount,
+		Reason:      reason,
+	})
+	if errors.Is(err, domain.ErrRefundRejected) {
+		errSettle := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+			return s.settlePayment(ctx, payment, "FAILED", "", payment.Amount, "system")
+		})
+		if errSettle != nil {
+			return errSettle
+		}
+		return err
+	}
+	if err != nil {
+		logger.Warn("Refund not sent, it will be sent again", "payment", payment.ID, "error", err)
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		payment, err := s.paymentRepo.LockPaymentByID(ctx, payment.ID)
+		if err != nil {
+			return err
+		}
+		if payment.PaymentStatus != "PENDING" {
+			return nil
+		}
+		payment.Gateway = s.gateway.Name()
+		payment.InvoiceID = gatewayRefund.ID
+		if err := s.paymentRepo.UpdatePayment(ctx, payment); err != nil {
+			return err
+		}
+
+		status := refundStatus(gatewayRefund.Status)
+		if status == "PENDING" {
+			return nil
+		}
+		return s.settlePayment(ctx, payment, status, "", payment.Amount, s.gateway.Name())
+	})
+}
+
+// checkRefund settles a sent refund once the gateway has finished with it
+func (s *PaymentsService) checkRefund(ctx context.Context, payment domain.Payments) error {
+	gatewayRefund, err := s.gateway.GetRefund(ctx, payment.InvoiceID)
+	if err != nil {
+		return err
+	}
+
+	status := refundStatus(gatewayRefund.Status)
+	if status == "PENDING" {
+		return nil
+	}
+
+	return s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.settlePayment(ctx, payment, status, "", payment.Amount, s.gateway.Name())
+	})
+}
+
+// refundStatus maps a gateway refund status to the REFUND payment status
+func refundStatus(status string) string {
+	switch status {
+	case "SUCCEEDED", "COMPLETED":
+		return "REFUNDED"
+	case "FAILED", "CANCELLED":
+		return "FAILED"
+	default:
+		return "PENDING"
+	}
+}
+
+// checkNoRefundPending refuses a new refund while another one of the order
+// has not been settled, the pending one is not booked on the order yet
+func (s *PaymentsService) checkNoRefundPending(ctx context.Context, orderID int) error {
+	payments, err := s.paymentRepo.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if payment.PaymentType == "REFUND" && payment.PaymentStatus == "PENDING" {
+			return fmt.Errorf("order has a refund in progress (payment %d)", payment.ID)
+		}
+	}
+
+	return nil
+}
+
+// applyRefund books a settled refund on its order: the refunded quantities,
+// the stock going back on sale and the order status. Refunds of late payments
+// carry no details, the order never had that money.
+func (s *PaymentsService) applyRefund(ctx context.Context, payment domain.Payments) error {
+	if payment.Refund == nil || payment.OrderID == nil {
+		return nil
+	}
+	refund := payment.Refund
+
+	order, err := s.orderRepo.GetOrderByID(ctx, *payment.OrderID)
+	if err != nil {
+		return err
+	}
+
+	quantities := make(map[int]int, len(refund.Lines))
+	for _, line := range refund.Lines {
+		quantities[line.ProductID] += line.Quantity
+	}
+
+	fullyRefunded := true
+	for i := range order.Items {
+		item := &order.Items[i]
+		if quantity, ok := quantities[item.ProductID]; ok {
+			if item.RefundedQuantity+quantity > item.Quantity {
+				return fmt.Errorf("refund %d gives back more of product %d than was ordered", payment.ID, item.ProductID)
+			}
+			item.RefundedQuantity += quantity
+			if err := s.orderRepo.UpdateOrderItem(ctx, *item); err != nil {
+				return err
+			}
+		}
+		if item.RefundedQuantity < item.Quantity {
+			fullyRefunded = false
+		}
+	}
+
+	if refund.Restock {
+		restock := make([]domain.OrderItem, 0, len(refund.Lines))
+		for _, line := range refund.Lines {
+			restock = append(restock, domain.OrderItem{ProductID: line.ProductID, Quantity: line.Quantity})
+		}
+		if err := s.stockRepo.Restock(ctx, order.ID, restock, refund.Actor); err != nil {
+			return err
+		}
+	}
+
+	status := domain.OrderStatusPartiallyRefunded
+	if fullyRefunded {
+		status = domain.OrderStatusRefunded
+	}
+	reason := refund.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("refunded %s", payment.Amount)
+	}
+
+	return orders.ChangeStatus(ctx, s.orderRepo, &order, status, refund.Actor, reason)
+}
+
+// orderPayment is the PAID payment an order was paid with
+func (s *PaymentsService) orderPayment(ctx context.Context, orderID int) (domain.Payments, error) {
+	payments, err := s.paymentRepo.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return domain.Payments{}, err
+	}
+
+	for _, payment := range payments {
+		if payment.PaymentType == "ORDER" && payment.PaymentStatus == "PAID" {
+			return payment, nil
+		}
+	}
+
+	return domain.Payments{}, errors.New("order has no paid payment to refund")
+}
+
+// refundLines works out the quantity to refund per product, ordered by
+// product, and what it is worth. Without requested lines everything not
+// refunded yet is refunded.
+func refundLines(order domain.Orders, requested []domain.RefundLine) ([]domain.RefundLine, domain.Money, error) {
+	remaining := make(map[int]int, len(order.Items))
+	prices := make(map[int]domain.Money, len(order.Items))
+	for _, item := range order.Items {
+		remaining[item.ProductID] = item.Quantity - item.RefundedQuantity
+		prices[item.ProductID] = item.PriceEach
+	}
+
+	lines := make(map[int]int)
+	if len(requested) == 0 {
+		for productID, quantity := range remaining {
+			if quantity > 0 {
+				lines[productID] = quantity
+			}
+		}
+	}
+	for _, line := range requested {
+		if line.Quantity <= 0 {
+			return nil, domain.Money{}, errors.New("refund quantity must be greater than 0")
+		}
+		if _, ok := remaining[line.ProductID]; !ok {
+			return nil, domain.Money{}, fmt.Errorf("product %d is not in this order", line.ProductID)
+		}
+		lines[line.ProductID] += line.Quantity
+	}
+	if len(lines) == 0 {
+		return nil, domain.Money{}, errors.New("order has nothing left to refund")
+	}
+
+	refunded := make([]domain.RefundLine, 0, len(lines))
+	var amount domain.Money
+	for productID, quantity := range lines {
+		if quantity > remaining[productID] {
+			return nil, domain.Money{}, fmt.Errorf("only %d of product %d can still be refunded", remaining[productID], productID)
+		}
+		amount = amount.Add(prices[productID].Mul(int64(quantity)))
+		refunded = append(refunded, domain.RefundLine{ProductID: productID, Quantity: quantity})
+	}
+	sort.Slice(refunded, func(i, j int) bool { return refunded[i].ProductID < refunded[j].ProductID })
+
+	return refunded, amount, nil
+}
@@ -0,0 +1,127 @@
+package payments
+
+import (
+	"myGreenMarket/domain"
+	"reflect"
+	"testing"
+)
+
+func TestRefundLines(t *testing.T) {
+	order := domain.Orders{
+		ID: 1,
+		Items: []domain.OrderItem{
+			{ProductID: 10, Quantity: 3, PriceEach: domain.IDR(5000)},
+			{ProductID: 20, Quantity: 2, PriceEach: domain.NewMoney(250050), RefundedQuantity: 1},
+			{ProductID: 30, Quantity: 1, PriceEach: domain.IDR(1000), RefundedQuantity: 1},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		order      domain.Orders
+		requested  []domain.RefundLine
+		wantLines  []domain.RefundLine
+		wantAmount domain.Money
+		wantErr    bool
+	}{
+		{
+			name:  "everything left",
+			order: order,
+			wantLines: []domain.RefundLine{
+				{ProductID: 10, Quantity: 3},
+				{ProductID: 20, Quantity: 1},
+			},
+			wantAmount: domain.NewMoney(1750050),
+		},
+		{
+			name:       "one line",
+			order:      order,
+			requested:  []domain.RefundLine{{ProductID: 10, Quantity: 2}},
+			wantLines:  []domain.RefundLine{{ProductID: 10, Quantity: 2}},
+			wantAmount: domain.IDR(10000),
+		},
+		{
+			name:       "repeated product is merged",
+			order:      order,
+			requested:  []domain.RefundLine{{ProductID: 10, Quantity: 1}, {ProductID: 10, Quantity: 2}},
+			wantLines:  []domain.RefundLine{{ProductID: 10, Quantity: 3}},
+			wantAmount: domain.IDR(15000),
+		},
+		{
+			name:      "more than is left",
+			order:     order,
+			requested: []domain.RefundLine{{ProductID: 20, Quantity: 2}},
+			wantErr:   true,
+		},
+		{
+			name:      "merged lines more than ordered",
+			order:     order,
+			requested: []domain.RefundLine{{ProductID: 10, Quantity: 2}, {ProductID: 10, Quantity: 2}},
+			wantErr:   true,
+		},
+		{
+			name:      "already refunded line",
+			order:     order,
+			requested: []domain.RefundLine{{ProductID: 30, Quantity: 1}},
+			wantErr:   true,
+		},
+		{
+			name:      "product not in the order",
+			order:     order,
+			requested: []domain.RefundLine{{ProductID: 99, Quantity: 1}},
+			wantErr:   true,
+		},
+		{
+			name:      "zero quantity",
+			order:     order,
+			requested: []domain.RefundLine{{ProductID: 10, Quantity: 0}},
+			wantErr:   true,
+		},
+		{
+			name: "nothing left to refund",
+			order: domain.Orders{Items: []domain.OrderItem{
+				{ProductID: 10, Quantity: 2, PriceEach: domain.IDR(5000), RefundedQuantity: 2},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, amount, err := refundLines(tt.order, tt.requested)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("refundLines() = %v, %s, want an error", lines, amount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refundLines() error: %v", err)
+			}
+
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", lines, tt.wantLines)
+			}
+			if amount.Cmp(tt.wantAmount) != 0 {
+				t.Errorf("amount = %s, want %s", amount, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestRefundStatus(t *testing.T) {
+	tests := map[string]string{
+		"SUCCEEDED": "REFUNDED",
+		"COMPLETED": "REFUNDED",
+		"FAILED":    "FAILED",
+		"CANCELLED": "FAILED",
+		"PENDING":   "PENDING",
+		"":          "PENDING",
+	}
+
+	for gateway, want := range tests {
+		if got := refundStatus(gateway); got != want {
+			t.Errorf("refundStatus(%q) = %s, want %s", gateway, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/orders"
+	"myGreenMarket/domain"
+	"time"
+)
+
+// CreateSplitPayment pays an order with whatever is in the wallet and opens
+// a gateway invoice for the rest. The wallet part is moved to a hold account
+// straight away, so it cannot be spent twice. It becomes a sale once the
+// invoice is paid and goes back to the wallet if the invoice expires. A
+// wallet that covers the whole order is charged like a plain wallet payment,
+// and an empty wallet gets a plain invoice.
+func (s *PaymentsService) CreateSplitPayment(order_id int, user_id uint) (domain.PaymentWithLink, error) {
+	ctx := context.TODO()
+
+	user, err := s.userRepo.FindByID(ctx, user_id)
+	if err != nil {
+		return domain.PaymentWithLink{}, err
+	}
+	order, err := s.orderRepo.GetOrder(ctx, order_id, int(user_id))
+	if err != nil {
+		return domain.PaymentWithLink{}, err
+	}
+
+	walletAmount := user.Wallet.Min(order.TotalAmount)
+	if !walletAmount.IsPositive() || walletAmount.Cmp(order.TotalAmount) == 0 {
+		return s.CreatePayment(domain.Payments{
+			UserID:  int(user_id),
+			OrderID: &order_id,
+		}, walletAmount.Cmp(order.TotalAmount) == 0, user_id)
+	}
+
+	var payment domain.Payments
+	var request domain.InvoiceRequest
+	var gatewayAmount domain.Money
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		order, err = s.orderRepo.LockOrder(ctx, order_id, int(user_id))
+		if err != nil {
+			return err
+		}
+		if err := s.checkNoPaymentPending(ctx, order.ID); err != nil {
+			return err
+		}
+		gatewayAmount = order.TotalAmount.Sub(walletAmount)
+		if !gatewayAmount.IsPositive() {
+			return errors.New("order total changed, please try again")
+		}
+		if !order.OrderStatus.CanTransitionTo(domain.OrderStatusAwaitingPayment) {
+			return &domain.InvalidTransitionError{From: order.OrderStatus, To: domain.OrderStatusAwaitingPayment}
+		}
+
+		payment, err = s.paymentRepo.CreatePayment(ctx, domain.Payments{
+			UserID:        int(user_id),
+			OrderID:       &order_id,
+			PaymentType:   "ORDER",
+			PaymentStatus: "PENDING",
+			PaymentMethod: "SPLIT",
+			Amount:        order.TotalAmount,
+			WalletAmount:  walletAmount,
+			GatewayAmount: gatewayAmount,
+			CreatedAt:     time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Rejected with ErrInsufficientBalance if the wallet was spent meanwhile
+		_, err = s.walletRepo.Post(ctx, domain.WalletPosting{
+			UserID:        user_id,
+			Direction:     domain.WalletDirectionDebit,
+			EntryType:     domain.WalletEntryHold,
+			Amount:        walletAmount,
+			ContraAccount: domain.LedgerAccountHolds,
+			Reference:     fmt.Sprintf("payment:%d", payment.ID),
+			Description:   fmt.Sprintf("held for order %d", order.ID),
+			CreatedBy:     fmt.Sprintf("user:%d", user_id),
+		})
+		if err != nil {
+			return err
+		}
+
+		request = domain.InvoiceRequest{
+			ExternalID:  externalID(payment.ID, int(user.ID), order.ID, "TRANSFER"),
+			PayerEmail:  user.Email,
+			Description: fmt.Sprintf("payment order %s, %s paid from wallet", order.TotalAmount, walletAmount),
+			Amount:      gatewayAmount,
+			Duration:    orderInvoiceDuration,
+			Items: []domain.Item{
+				{
+					Name:     fmt.Sprintf("Order %d after wallet balance", order.ID),
+					Quantity: 1,
+					Price:    gatewayAmount,
+					Category: "Order",
+				},
+			},
+		}
+
+		return orders.ChangeStatus(ctx, s.orderRepo, &order, domain.OrderStatusAwaitingPayment, fmt.Sprintf("user:%d", user_id), "split invoice requested")
+	})
+	if err != nil {
+		return domain.PaymentWithLink{}, err
+	}
+
+	// Expiring a payment the gateway opened no invoice for releases the hold
+	invoice, err := s.openInvoice(ctx, payment, request, fmt.Sprintf("user:%d", user_id))
+	if err != nil {
+		return domain.PaymentWithLink{}, err
+	}
+
+	return domain.PaymentWithLink{
+		ID:            payment.ID,
+		UserID:        payment.UserID,
+		OrderID:       *payment.OrderID,
+		PaymentStatus: payment.PaymentStatus,
+		PaymentMethod: payment.PaymentMethod,
+		PaymentLink:   invoice.InvoiceURL,
+		Instructions:  invoice.Instructions,
+		WalletAmount:  payment.WalletAmount,
+		GatewayAmount: payment.GatewayAmount,
+		CreatedAt:     payment.CreatedAt,
+	}, nil
+}
+
+// captureWalletHold turns the held wallet part of a split payment into a sale
+func (s *PaymentsService) captureWalletHold(ctx context.Context, payment domain.Payments, actor string) error {
+	return s.walletRepo.Transfer(ctx, domain.LedgerTransfer{
+		FromAccount: domain.LedgerAccountHolds,
+		ToAccount:   domain.LedgerAccountSales,
+		EntryType:   domain.WalletEntryHoldCapture,
+		Amount:      payment.WalletAmount,
+		Reference:   fmt.Sprintf("payment:%d", payment.ID),
+		Description: fmt.Sprintf("payment for order %d", *payment.OrderID),
+		CreatedBy:   actor,
+	})
+}
+
+// releaseWalletHold gives the held wallet part of a split payment back
+func (s *PaymentsService) releaseWalletHold(ctx context.Context, payment domain.Payments, actor string) error {
+	_, err := s.walletRepo.Post(ctx, domain.WalletPosting{
+		UserID:        uint(payment.UserID),
+		Direction:     domain.WalletDirectionCredit,
+		EntryType:     domain.WalletEntryHoldRelease,
+		Amount:        payment.WalletAmount,
+		ContraAccount: domain.LedgerAccountHolds,
+		Reference:     fmt.Sprintf("payment:%d", payment.ID),
+		Description:   fmt.Sprintf("released hold for order %d", *payment.OrderID),
+		CreatedBy:     actor,
+	})
+
+	return err
+}
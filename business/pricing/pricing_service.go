@@ -0,0 +1,225 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/cart"
+	"myGreenMarket/business/product"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// PromotionRepository contract interface
+type PromotionRepository interface {
+	Create(ctx context.Context, promotion *domain.Promotion) error
+	FindAll(ctx context.Context) ([]domain.Promotion, error)
+	FindActive(ctx context.Context, at time.Time) ([]domain.Promotion, error)
+	Delete(ctx context.Context, id uint64) error
+}
+
+type pricingService struct {
+	promotionRepo PromotionRepository
+	productRepo   product.ProductRepository
+	cartRepo      cart.CartRepository
+}
+
+func NewPricingService(promotionRepo PromotionRepository, productRepo product.ProductRepository, cartRepo cart.CartRepository) *pricingService {
+	return &pricingService{
+		promotionRepo: promotionRepo,
+		productRepo:   productRepo,
+		cartRepo:      cartRepo,
+	}
+}
+
+// Resolve works out the unit price of a product. The sale price, the
+// product's own discount and every promotion covering it are each a
+// candidate and the lowest price wins; discounts never stack. Percentage
+// discounts are rounded to whole rupiah.
+func Resolve(p domain.Product, promotions []domain.Promotion) domain.PriceBreakdown {
+	list := p.NormalPrice
+	best := domain.PriceBreakdown{
+		ProductID: p.ID,
+		ListPrice: list,
+		UnitPrice: list,
+		Source:    domain.PriceSourceList,
+	}
+
+	consider := func(price domain.Money, source domain.PriceSource, promotionID *uint64) {
+		if price.IsNegative() {
+			price = domain.Money{}
+		}
+		if price.LessThan(best.UnitPrice) {
+			best.UnitPrice = price
+			best.Source = source
+			best.PromotionID = promotionID
+		}
+	}
+
+	if p.SalePrice.IsPositive() {
+		consider(p.SalePrice, domain.PriceSourceSalePrice, nil)
+	}
+	if p.Discount > 0 {
+		consider(list.Sub(list.Percent(p.Discount)).Round(), domain.PriceSourceDiscount, nil)
+	}
+	for _, promotion := range promotions {
+		if !promotion.AppliesTo(p) {
+			continue
+		}
+		id := promotion.ID
+		consider(list.Sub(list.Percent(promotion.DiscountPercent)).Round(), domain.PriceSourcePromotion, &id)
+	}
+
+	best.Discount = list.Sub(best.UnitPrice)
+
+	return best
+}
+
+// UnitPrices resolves the price of each product against the promotions
+// running now
+func (s *pricingService) UnitPrices(ctx context.Context, products []domain.Product) ([]domain.PriceBreakdown, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when resolving prices")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	promotions, err := s.promotionRepo.FindActive(ctx, time.Now())
+	if err != nil {
+		logger.Error("Failed to find active promotions", err)
+		return nil, err
+	}
+
+	prices := make([]domain.PriceBreakdown, 0, len(products))
+	for _, p := range products {
+		prices = append(prices, Resolve(p, promotions))
+	}
+
+	return prices, nil
+}
+
+// Quote prices the given lines the way checkout would, repeated products are
+// merged into one line
+func (s *pricingService) Quote(ctx context.Context, items []domain.CartItem) (domain.PriceQuote, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when quoting prices")
+		return domain.PriceQuote{}, fmt.Errorf("context error: %w", err)
+	}
+
+	lines := make([]domain.PriceQuoteLine, 0, len(items))
+	index := make(map[uint64]int)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return domain.PriceQuote{}, errors.New("quantity must be greater than 0")
+		}
+		if i, ok := index[item.ProductID]; ok {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(lines)
+		lines = append(lines, domain.PriceQuoteLine{
+			PriceBreakdown: domain.PriceBreakdown{ProductID: item.ProductID},
+			Quantity:       item.Quantity,
+		})
+	}
+
+	products := make([]domain.Product, 0, len(lines))
+	for _, line := range lines {
+		p, err := s.productRepo.FindByID(ctx, line.ProductID)
+		if err != nil {
+			logger.Error("Failed to find quoted product", err)
+			return domain.PriceQuote{}, err
+		}
+		products = append(products, p)
+	}
+
+	prices, err := s.UnitPrices(ctx, products)
+	if err != nil {
+		return domain.PriceQuote{}, err
+	}
+
+	var quote domain.PriceQuote
+	for i := range lines {
+		quantity := int64(lines[i].Quantity)
+		lines[i].PriceBreakdown = prices[i]
+		lines[i].ProductName = products[i].ProductName
+		lines[i].Subtotal = prices[i].UnitPrice.Mul(quantity)
+
+		quote.ListTotal = quote.ListTotal.Add(prices[i].ListPrice.Mul(quantity))
+		quote.DiscountTotal = quote.DiscountTotal.Add(prices[i].Discount.Mul(quantity))
+		quote.Total = quote.Total.Add(lines[i].Subtotal)
+	}
+	quote.Lines = lines
+
+	return quote, nil
+}
+
+// QuoteCart prices the user's cart
+func (s *pricingService) QuoteCart(ctx context.Context, userID uint) (domain.PriceQuote, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when quoting cart")
+		return domain.PriceQuote{}, fmt.Errorf("context error: %w", err)
+	}
+
+	items, err := s.cartRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to find cart items", err)
+		return domain.PriceQuote{}, err
+	}
+	if len(items) == 0 {
+		return domain.PriceQuote{}, errors.New("cart is empty")
+	}
+
+	return s.Quote(ctx, items)
+}
+
+func (s *pricingService) CreatePromotion(ctx context.Context, promotion domain.Promotion) (domain.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when creating promotion")
+		return domain.Promotion{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if promotion.DiscountPercent <= 0 || promotion.DiscountPercent > 100 {
+		return domain.Promotion{}, errors.New("discount percent must be between 0 and 100")
+	}
+	if promotion.ProductID != nil && promotion.ProductCategory != "" {
+		return domain.Promotion{}, errors.New("promotion is either for a product or for a category")
+	}
+	if promotion.StartsAt.IsZero() {
+		promotion.StartsAt = time.Now()
+	}
+	if promotion.EndsAt != nil && !promotion.EndsAt.After(promotion.StartsAt) {
+		return domain.Promotion{}, errors.New("promotion must end after it starts")
+	}
+	if promotion.ProductID != nil {
+		if _, err := s.productRepo.FindByID(ctx, *promotion.ProductID); err != nil {
+			logger.Error("Failed to find promoted product", err)
+			return domain.Promotion{}, err
+		}
+	}
+
+	if err := s.promotionRepo.Create(ctx, &promotion); err != nil {
+		logger.Error("Failed to create promotion", err)
+		return domain.Promotion{}, err
+	}
+
+	return promotion, nil
+}
+
+func (s *pricingService) GetPromotions(ctx context.Context) ([]domain.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get promotions")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.promotionRepo.FindAll(ctx)
+}
+
+func (s *pricingService) DeletePromotion(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when deleting promotion")
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return s.promotionRepo.Delete(ctx, id)
+}
@@ -0,0 +1,141 @@
+package pricing
+
+import (
+	"myGreenMarket/domain"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	productPromo := uint64(7)
+	otherProduct := uint64(99)
+
+	product := domain.Product{
+		ID:              1,
+		ProductCategory: "Sayur",
+		NormalPrice:     domain.IDR(10000),
+	}
+	with := func(change func(p *domain.Product)) domain.Product {
+		p := product
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name          string
+		product       domain.Product
+		promotions    []domain.Promotion
+		wantUnit      domain.Money
+		wantSource    domain.PriceSource
+		wantPromotion *uint64
+	}{
+		{
+			name:       "list price",
+			product:    product,
+			wantUnit:   domain.IDR(10000),
+			wantSource: domain.PriceSourceList,
+		},
+		{
+			name:       "sale price below list",
+			product:    with(func(p *domain.Product) { p.SalePrice = domain.IDR(8000) }),
+			wantUnit:   domain.IDR(8000),
+			wantSource: domain.PriceSourceSalePrice,
+		},
+		{
+			name:       "sale price above list is ignored",
+			product:    with(func(p *domain.Product) { p.SalePrice = domain.IDR(12000) }),
+			wantUnit:   domain.IDR(10000),
+			wantSource: domain.PriceSourceList,
+		},
+		{
+			name:       "product discount",
+			product:    with(func(p *domain.Product) { p.Discount = 25 }),
+			wantUnit:   domain.IDR(7500),
+			wantSource: domain.PriceSourceDiscount,
+		},
+		{
+			name: "discount rounded to whole rupiah",
+			product: with(func(p *domain.Product) {
+				p.NormalPrice = domain.IDR(999)
+				p.Discount = 15
+			}),
+			wantUnit:   domain.IDR(849),
+			wantSource: domain.PriceSourceDiscount,
+		},
+		{
+			name:       "category promotion",
+			product:    product,
+			promotions: []domain.Promotion{{ID: 3, ProductCategory: "Sayur", DiscountPercent: 30}},
+			wantUnit:   domain.IDR(7000),
+			wantSource: domain.PriceSourcePromotion,
+			wantPromotion: func() *uint64 {
+				id := uint64(3)
+				return &id
+			}(),
+		},
+		{
+			name:    "best of several, no stacking",
+			product: with(func(p *domain.Product) { p.SalePrice = domain.IDR(9000); p.Discount = 20 }),
+			promotions: []domain.Promotion{
+				{ID: 3, ProductCategory: "Sayur", DiscountPercent: 10},
+				{ID: 7, ProductID: &productPromo, DiscountPercent: 40},
+				{ID: 8, DiscountPercent: 15},
+			},
+			wantUnit:   domain.IDR(8000),
+			wantSource: domain.PriceSourceDiscount,
+		},
+		{
+			name:          "promotion for this product",
+			product:       with(func(p *domain.Product) { p.ID = productPromo }),
+			promotions:    []domain.Promotion{{ID: 7, ProductID: &productPromo, DiscountPercent: 40}},
+			wantUnit:      domain.IDR(6000),
+			wantSource:    domain.PriceSourcePromotion,
+			wantPromotion: &productPromo,
+		},
+		{
+			name:    "promotions for other products and categories",
+			product: product,
+			promotions: []domain.Promotion{
+				{ID: 4, ProductID: &otherProduct, DiscountPercent: 50},
+				{ID: 5, ProductCategory: "Buah", DiscountPercent: 50},
+			},
+			wantUnit:   domain.IDR(10000),
+			wantSource: domain.PriceSourceList,
+		},
+		{
+			name:       "more than everything off is free",
+			product:    product,
+			promotions: []domain.Promotion{{ID: 9, DiscountPercent: 150}},
+			wantUnit:   domain.Money{},
+			wantSource: domain.PriceSourcePromotion,
+			wantPromotion: func() *uint64 {
+				id := uint64(9)
+				return &id
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(tt.product, tt.promotions)
+
+			if got.UnitPrice.Cmp(tt.wantUnit) != 0 {
+				t.Errorf("UnitPrice = %s, want %s", got.UnitPrice, tt.wantUnit)
+			}
+			if got.Source != tt.wantSource {
+				t.Errorf("Source = %s, want %s", got.Source, tt.wantSource)
+			}
+			if got.ListPrice.Cmp(tt.product.NormalPrice) != 0 {
+				t.Errorf("ListPrice = %s, want %s", got.ListPrice, tt.product.NormalPrice)
+			}
+			if got.Discount.Cmp(got.ListPrice.Sub(got.UnitPrice)) != 0 {
+				t.Errorf("Discount = %s, want list less unit price", got.Discount)
+			}
+			switch {
+			case tt.wantPromotion == nil && got.PromotionID != nil:
+				t.Errorf("PromotionID = %d, want none", *got.PromotionID)
+			case tt.wantPromotion != nil && (got.PromotionID == nil || *got.PromotionID != *tt.wantPromotion):
+				t.Errorf("PromotionID = %v, want %d", got.PromotionID, *tt.wantPromotion)
+			}
+		})
+	}
+}
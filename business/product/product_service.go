@@ -10,36 +10,86 @@ import (
 
 // ProductRepository contract interface
 type ProductRepository interface {
-	Create(ctx context.Context, product *domain.Product) error
+	Create(ctx context.Context, product *domain.Product, actor string) error
 	FindByID(ctx context.Context, id uint64) (domain.Product, error)
-	FindAll(ctx context.Context) ([]domain.Product, error)
+	FindAll(ctx context.Context, query domain.ProductQuery) ([]domain.Product, int64, error)
 	Update(ctx context.Context, product *domain.Product) error
 	Delete(ctx context.Context, id uint64) error
 }
 
+// CategoryRepository contract interface
+type CategoryRepository interface {
+	FindByID(ctx context.Context, id uint64) (domain.Category, error)
+	FindByName(ctx context.Context, name string) (domain.Category, error)
+}
+
+// Pricer resolves what products sell for right now, see business/pricing.
+// It returns one breakdown per product, in the same order.
+type Pricer interface {
+	UnitPrices(ctx context.Context, products []domain.Product) ([]domain.PriceBreakdown, error)
+}
+
+const (
+	defaultProductLimit = 20
+	maxProductLimit     = 100
+)
+
 type productService struct {
-	productRepo ProductRepository
+	productRepo  ProductRepository
+	categoryRepo CategoryRepository
 }
 
-func NewProductService(productRepo ProductRepository) *productService {
+func NewProductService(productRepo ProductRepository, categoryRepo CategoryRepository) *productService {
 	return &productService{
-		productRepo: productRepo,
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
 	}
 }
 
-func (s *productService) GetAllProducts(ctx context.Context) ([]domain.Product, error) {
+// GetAllProducts returns a page of the products matching the query
+func (s *productService) GetAllProducts(ctx context.Context, query domain.ProductQuery, page, limit int) (domain.ProductPage, error) {
 	if err := ctx.Err(); err != nil {
 		logger.Error("context error when get all product")
-		return nil, fmt.Errorf("context error: %w", err)
+		return domain.ProductPage{}, fmt.Errorf("context error: %w", err)
 	}
 
-	product, err := s.productRepo.FindAll(ctx)
+	if query.Sort != "" && !query.Sort.IsValid() {
+		return domain.ProductPage{}, fmt.Errorf("%w: unknown sort %s", domain.ErrInvalidProductQuery, query.Sort)
+	}
+	if (query.MinPrice != nil && query.MinPrice.IsNegative()) || (query.MaxPrice != nil && query.MaxPrice.IsNegative()) {
+		return domain.ProductPage{}, fmt.Errorf("%w: price cannot be negative", domain.ErrInvalidProductQuery)
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && query.MaxPrice.LessThan(*query.MinPrice) {
+		return domain.ProductPage{}, fmt.Errorf("%w: max price cannot be less than min price", domain.ErrInvalidProductQuery)
+	}
+	if query.MinDiscount < 0 || query.MinDiscount > 100 {
+		return domain.ProductPage{}, fmt.Errorf("%w: min discount must be between 0 and 100", domain.ErrInvalidProductQuery)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultProductLimit
+	}
+	if limit > maxProductLimit {
+		limit = maxProductLimit
+	}
+	query.Offset = (page - 1) * limit
+	query.Limit = limit
+
+	products, total, err := s.productRepo.FindAll(ctx, query)
 	if err != nil {
 		logger.Error("Failed to find all product", err)
-		return nil, err
+		return domain.ProductPage{}, err
 	}
 
-	return product, nil
+	return domain.ProductPage{
+		Products: products,
+		Total:    total,
+		Page:     page,
+		Limit:    limit,
+	}, nil
 }
 
 func (s *productService) GetProductByID(ctx context.Context, id uint) (*domain.Product, error) {
@@ -62,7 +112,9 @@ func (s *productService) GetProductByID(ctx context.Context, id uint) (*domain.P
 	return &product, nil
 }
 
-func (s *productService) CreateProduct(ctx context.Context, product *domain.Product) (*domain.Product, error) {
+// CreateProduct saves a new product, adminID is recorded as having put its
+// starting quantity on sale
+func (s *productService) CreateProduct(ctx context.Context, product *domain.Product, adminID uint) (*domain.Product, error) {
 	if err := ctx.Err(); err != nil {
 		logger.Error("context error when create product")
 		return nil, fmt.Errorf("context error: %w", err)
@@ -74,7 +126,7 @@ func (s *productService) CreateProduct(ctx context.Context, product *domain.Prod
 		return nil, errors.New("product name is required")
 	}
 
-	if product.ProductCategory == "" {
+	if product.CategoryID == nil && product.ProductCategory == "" {
 		logger.Error("Invalid product data: product category is required")
 		return nil, errors.New("product category is required")
 	}
@@ -84,7 +136,7 @@ func (s *productService) CreateProduct(ctx context.Context, product *domain.Prod
 		return nil, errors.New("unit is required")
 	}
 
-	if product.NormalPrice <= 0 {
+	if !product.NormalPrice.IsPositive() {
 		logger.Error("Invalid product data: normal price must be greater than 0")
 		return nil, errors.New("normal price must be greater than 0")
 	}
@@ -94,7 +146,16 @@ func (s *productService) CreateProduct(ctx context.Context, product *domain.Prod
 		return nil, errors.New("quantity cannot be negative")
 	}
 
-	if err := s.productRepo.Create(ctx, product); err != nil {
+	if product.ReorderThreshold != nil && *product.ReorderThreshold < 0 {
+		logger.Error("Invalid product data: reorder threshold cannot be negative")
+		return nil, errors.New("reorder threshold cannot be negative")
+	}
+
+	if err := s.resolveCategory(ctx, product); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Create(ctx, product, fmt.Sprintf("admin:%d", adminID)); err != nil {
 		logger.Error("failed to create new product", err)
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
@@ -121,23 +182,34 @@ func (s *productService) UpdateProduct(ctx context.Context, product *domain.Prod
 		return nil, errors.New("product name is required")
 	}
 
-	if product.NormalPrice <= 0 {
+	if !product.NormalPrice.IsPositive() {
 		logger.Error("Invalid product data: normal price must be greater than 0")
 		return nil, errors.New("normal price must be greater than 0")
 	}
 
-	if product.Quantity < 0 {
-		logger.Error("Invalid product data: quantity cannot be negative")
-		return nil, errors.New("quantity cannot be negative")
+	if product.ReorderThreshold != nil && *product.ReorderThreshold < 0 {
+		logger.Error("Invalid product data: reorder threshold cannot be negative")
+		return nil, errors.New("reorder threshold cannot be negative")
 	}
 
 	// Verify product exists
-	_, err := s.productRepo.FindByID(ctx, product.ID)
+	current, err := s.productRepo.FindByID(ctx, product.ID)
 	if err != nil {
 		logger.Error("product not found", err)
 		return nil, errors.New("product not found")
 	}
 
+	// Without a category in the update the product stays where it is
+	if product.CategoryID == nil && product.ProductCategory == "" {
+		product.CategoryID = current.CategoryID
+		product.ProductCategory = current.ProductCategory
+	}
+	if product.CategoryID != nil || product.ProductCategory != current.ProductCategory {
+		if err := s.resolveCategory(ctx, product); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := s.productRepo.Update(ctx, product); err != nil {
 		logger.Error("failed to update product", err)
 		return nil, fmt.Errorf("failed to update product: %w", err)
@@ -182,3 +254,27 @@ func (s *productService) DeleteProduct(ctx context.Context, id uint64) error {
 
 	return nil
 }
+
+// resolveCategory links the product to its category, by CategoryID when set
+// and by name otherwise, and copies the category's name onto the product
+func (s *productService) resolveCategory(ctx context.Context, product *domain.Product) error {
+	var category domain.Category
+	var err error
+	if product.CategoryID != nil {
+		category, err = s.categoryRepo.FindByID(ctx, *product.CategoryID)
+	} else {
+		category, err = s.categoryRepo.FindByName(ctx, product.ProductCategory)
+	}
+	if err != nil {
+		logger.Error("Invalid product data: category not found", err)
+		if errors.Is(err, domain.ErrCategoryNotFound) {
+			return errors.New("product category not found")
+		}
+		return err
+	}
+
+	product.CategoryID = &category.CategoryID
+	product.ProductCategory = category.ProductCategory
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// minHighlightPrefix is how many leading letters a word has to share with a
+// query word to be highlighted when the query word is not in it whole
+const minHighlightPrefix = 2
+
+// highlight escapes text for HTML and marks, in every word, the part that
+// matches a query word. A query word found inside the word is marked as is,
+// otherwise the longest shared prefix is, so "bayem" marks "Bay" in "Bayam".
+func highlight(text string, queryWords []string) string {
+	words := make([][]rune, len(queryWords))
+	for i, word := range queryWords {
+		words[i] = lowerRunes([]rune(word))
+	}
+
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		b.WriteString(highlightWord(runes[i:j], words))
+		i = j
+	}
+
+	return b.String()
+}
+
+func highlightWord(word []rune, queryWords [][]rune) string {
+	lower := lowerRunes(word)
+
+	var start, end int
+	for _, q := range queryWords {
+		if i := indexRunes(lower, q); i >= 0 {
+			if len(q) > end-start {
+				start, end = i, i+len(q)
+			}
+			continue
+		}
+		if n := commonPrefix(lower, q); n >= minHighlightPrefix && n > end-start {
+			start, end = 0, n
+		}
+	}
+
+	if start == end {
+		return html.EscapeString(string(word))
+	}
+
+	return html.EscapeString(string(word[:start])) +
+		"<mark>" + html.EscapeString(string(word[start:end])) + "</mark>" +
+		html.EscapeString(string(word[end:]))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lowerRunes lowercases rune by rune, so indexes still line up with the original
+func lowerRunes(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	return lower
+}
+
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func commonPrefix(a, b []rune) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"myGreenMarket/domain"
+	"sync"
+	"time"
+)
+
+// prefixCache keeps the suggestions for short queries in memory. Short
+// queries are the prefixes every customer types on the way to a longer one,
+// so a few hundred of them cover most suggestion requests. When it is full
+// the least asked for prefix makes room.
+type prefixCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	entries  map[string]*prefixCacheEntry
+}
+
+type prefixCacheEntry struct {
+	suggestions []domain.Suggestion
+	expiresAt   time.Time
+	hits        int
+}
+
+func newPrefixCache(capacity int, ttl time.Duration) *prefixCache {
+	return &prefixCache{
+		ttl:      ttl,
+		capacity: capacity,
+		entries:  make(map[string]*prefixCacheEntry),
+	}
+}
+
+func (c *prefixCache) get(prefix string, now time.Time) ([]domain.Suggestion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[prefix]
+	if !ok || now.After(entry.expiresAt) {
+		return nil, false
+	}
+	entry.hits++
+
+	return entry.suggestions, true
+}
+
+func (c *prefixCache) put(prefix string, suggestions []domain.Suggestion, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// An expired entry keeps its hits, a popular prefix stays popular
+	if entry, ok := c.entries[prefix]; ok {
+		entry.suggestions = suggestions
+		entry.expiresAt = now.Add(c.ttl)
+		return
+	}
+
+	if len(c.entries) >= c.capacity {
+		c.evict(now)
+	}
+	c.entries[prefix] = &prefixCacheEntry{
+		suggestions: suggestions,
+		expiresAt:   now.Add(c.ttl),
+	}
+}
+
+// evict drops expired entries, or the least hit one when none has expired
+func (c *prefixCache) evict(now time.Time) {
+	var coldest string
+	coldestHits := -1
+	for prefix, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, prefix)
+			continue
+		}
+		if coldestHits < 0 || entry.hits < coldestHits {
+			coldest, coldestHits = prefix, entry.hits
+		}
+	}
+
+	if len(c.entries) >= c.capacity && coldestHits >= 0 {
+		delete(c.entries, coldest)
+	}
+}
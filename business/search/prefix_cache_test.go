@@ -0,0 +1,94 @@
+package search
+
+import (
+	"myGreenMarket/domain"
+	"testing"
+	"time"
+)
+
+func TestPrefixCache(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	suggestions := func(text string) []domain.Suggestion {
+		return []domain.Suggestion{{Kind: domain.SuggestionKindProduct, Text: text}}
+	}
+
+	tests := []struct {
+		name string
+		run  func(c *prefixCache)
+		hit  map[string]bool
+		at   time.Time
+	}{
+		{
+			name: "hit within ttl",
+			run: func(c *prefixCache) {
+				c.put("ba", suggestions("Bayam"), now)
+			},
+			hit: map[string]bool{"ba": true, "bu": false},
+			at:  now.Add(time.Minute),
+		},
+		{
+			name: "expired after ttl",
+			run: func(c *prefixCache) {
+				c.put("ba", suggestions("Bayam"), now)
+			},
+			hit: map[string]bool{"ba": false},
+			at:  now.Add(10 * time.Minute),
+		},
+		{
+			name: "least hit prefix makes room",
+			run: func(c *prefixCache) {
+				c.put("ba", suggestions("Bayam"), now)
+				c.put("bu", suggestions("Buncis"), now)
+				c.get("ba", now)
+				c.put("ca", suggestions("Cabai"), now)
+			},
+			hit: map[string]bool{"ba": true, "bu": false, "ca": true},
+			at:  now,
+		},
+		{
+			name: "expired entries make room first",
+			run: func(c *prefixCache) {
+				c.put("ba", suggestions("Bayam"), now)
+				c.get("ba", now)
+				c.put("bu", suggestions("Buncis"), now.Add(4*time.Minute))
+				c.put("ca", suggestions("Cabai"), now.Add(6*time.Minute))
+			},
+			hit: map[string]bool{"ba": false, "bu": true, "ca": true},
+			at:  now.Add(6 * time.Minute),
+		},
+		{
+			name: "put again refreshes the entry",
+			run: func(c *prefixCache) {
+				c.put("ba", suggestions("Bayam"), now)
+				c.put("ba", suggestions("Bawang"), now.Add(4*time.Minute))
+			},
+			hit: map[string]bool{"ba": true},
+			at:  now.Add(8 * time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPrefixCache(2, 5*time.Minute)
+			tt.run(c)
+
+			for prefix, want := range tt.hit {
+				if _, ok := c.get(prefix, tt.at); ok != want {
+					t.Errorf("get(%q) hit = %t, want %t", prefix, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixCacheReturnsLatestSuggestions(t *testing.T) {
+	now := time.Now()
+	c := newPrefixCache(10, time.Minute)
+	c.put("ba", []domain.Suggestion{{Text: "Bayam"}}, now)
+	c.put("ba", []domain.Suggestion{{Text: "Bawang"}}, now)
+
+	got, ok := c.get("ba", now)
+	if !ok || len(got) != 1 || got[0].Text != "Bawang" {
+		t.Errorf("get(ba) = %v, %t, want the Bawang suggestion", got, ok)
+	}
+}
@@ -0,0 +1,110 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SuggestionRepository contract interface
+type SuggestionRepository interface {
+	Suggest(ctx context.Context, q string, limit int) ([]domain.Suggestion, error)
+	RecordMiss(ctx context.Context, q string, at time.Time) error
+	FindMisses(ctx context.Context, offset, limit int) ([]domain.SearchMiss, int64, error)
+}
+
+const (
+	suggestionLimit  = 10
+	minSuggestQuery  = 2
+	maxSuggestQuery  = 64
+	defaultMissLimit = 20
+	maxMissLimit     = 100
+	maxCachedPrefix  = 6
+	prefixCacheSize  = 500
+	prefixCacheTTL   = 5 * time.Minute
+)
+
+type searchService struct {
+	suggestionRepo SuggestionRepository
+	cache          *prefixCache
+}
+
+func NewSearchService(suggestionRepo SuggestionRepository) *searchService {
+	return &searchService{
+		suggestionRepo: suggestionRepo,
+		cache:          newPrefixCache(prefixCacheSize, prefixCacheTTL),
+	}
+}
+
+// Suggest returns product and category names that start with or look like
+// q, typos included, best match first. Queries that find nothing are
+// recorded for merchandising to review.
+func (s *searchService) Suggest(ctx context.Context, q string) ([]domain.Suggestion, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when suggesting products")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	q = strings.ToLower(strings.Join(strings.Fields(q), " "))
+	length := utf8.RuneCountInString(q)
+	if length < minSuggestQuery {
+		return nil, fmt.Errorf("query must be at least %d characters", minSuggestQuery)
+	}
+	if length > maxSuggestQuery {
+		return nil, errors.New("query is too long")
+	}
+
+	now := time.Now()
+	suggestions, cached := s.cache.get(q, now)
+	if !cached {
+		found, err := s.suggestionRepo.Suggest(ctx, q, suggestionLimit)
+		if err != nil {
+			logger.Error("Failed to find suggestions", err)
+			return nil, err
+		}
+
+		words := strings.Fields(q)
+		for i := range found {
+			found[i].Highlighted = highlight(found[i].Text, words)
+		}
+		suggestions = found
+		if length <= maxCachedPrefix {
+			s.cache.put(q, suggestions, now)
+		}
+	}
+
+	if len(suggestions) == 0 {
+		logger.Info("Suggestion query found nothing", "query", q)
+		if err := s.suggestionRepo.RecordMiss(ctx, q, now); err != nil {
+			logger.Warn("Failed to record search miss", "query", q, "error", err)
+		}
+		return []domain.Suggestion{}, nil
+	}
+
+	return suggestions, nil
+}
+
+// GetMisses returns a page of the queries that found nothing, most asked first
+func (s *searchService) GetMisses(ctx context.Context, page, limit int) ([]domain.SearchMiss, int64, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get search misses")
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultMissLimit
+	}
+	if limit > maxMissLimit {
+		limit = maxMissLimit
+	}
+
+	return s.suggestionRepo.FindMisses(ctx, (page-1)*limit, limit)
+}
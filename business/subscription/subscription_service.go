@@ -0,0 +1,107 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/product"
+	"myGreenMarket/business/user"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// SubscriptionRepository contract interface
+type SubscriptionRepository interface {
+	// Create saves the subscription, or loads the customer's waiting one for the product
+	Create(ctx context.Context, subscription *domain.StockSubscription) error
+	FindDue(ctx context.Context, limit int) ([]domain.StockSubscription, error)
+	MarkNotified(ctx context.Context, id uint64, at time.Time) error
+}
+
+const (
+	SubjectBackInStock   = "Back in Stock!"
+	EmailBodyBackInStock = `Halo, %v, %v sudah tersedia kembali</br></br>Stok terbatas, segera pesan sebelum habis lagi`
+)
+
+type subscriptionService struct {
+	subscriptionRepo SubscriptionRepository
+	productRepo      product.ProductRepository
+	notifRepo        user.NotificationRepository
+}
+
+func NewSubscriptionService(subscriptionRepo SubscriptionRepository, productRepo product.ProductRepository, notifRepo user.NotificationRepository) *subscriptionService {
+	return &subscriptionService{
+		subscriptionRepo: subscriptionRepo,
+		productRepo:      productRepo,
+		notifRepo:        notifRepo,
+	}
+}
+
+// Subscribe asks for the customer to be told when the sold out product is
+// back in stock. Subscribing twice keeps the one subscription.
+func (s *subscriptionService) Subscribe(ctx context.Context, userID uint, productID uint64) (domain.StockSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when subscribing to product")
+		return domain.StockSubscription{}, fmt.Errorf("context error: %w", err)
+	}
+
+	p, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		logger.Error("Failed to find subscribed product", err)
+		return domain.StockSubscription{}, err
+	}
+	if p.Quantity > 0 {
+		return domain.StockSubscription{}, errors.New("product is in stock")
+	}
+
+	subscription := domain.StockSubscription{
+		ProductID: productID,
+		UserID:    userID,
+	}
+	if err := s.subscriptionRepo.Create(ctx, &subscription); err != nil {
+		logger.Error("Failed to create stock subscription", err)
+		return domain.StockSubscription{}, err
+	}
+
+	return subscription, nil
+}
+
+// NotifyRestocked tells customers their product is back in stock, at most
+// limit of them per run so a popular restock doesn't flood the mail
+// provider. Customers not reached are tried again on the next run. It is run
+// by the scheduler.
+func (s *subscriptionService) NotifyRestocked(ctx context.Context, limit int) error {
+	subscriptions, err := s.subscriptionRepo.FindDue(ctx, limit)
+	if err != nil {
+		logger.Error("Failed to find due stock subscriptions", err)
+		return err
+	}
+
+	var sent, failed int
+	for _, subscription := range subscriptions {
+		if ctx.Err() != nil {
+			break
+		}
+
+		customer := subscription.User
+		err := s.notifRepo.SendEmail(customer.FullName, customer.Email, SubjectBackInStock, fmt.Sprintf(EmailBodyBackInStock, customer.FullName, subscription.Product.ProductName))
+		if err != nil {
+			failed++
+			logger.Warn("Failed to send back in stock notification", "subscription", subscription.ID, "error", err)
+			continue
+		}
+
+		if err := s.subscriptionRepo.MarkNotified(ctx, subscription.ID, time.Now()); err != nil {
+			failed++
+			logger.Warn("Failed to mark stock subscription notified", "subscription", subscription.ID, "error", err)
+			continue
+		}
+		sent++
+	}
+
+	if sent > 0 || failed > 0 {
+		logger.Info("Sent back in stock notifications", "sent", sent, "failed", failed)
+	}
+	return nil
+}
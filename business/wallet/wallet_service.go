@@ -0,0 +1,154 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/business/orders"
+	"myGreenMarket/business/user"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"time"
+)
+
+// WalletRepository contract interface
+type WalletRepository interface {
+	Post(ctx context.Context, posting domain.WalletPosting) (domain.WalletLedgerEntry, error)
+	Transfer(ctx context.Context, transfer domain.LedgerTransfer) error
+	FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.WalletLedgerEntry, int64, error)
+}
+
+type BankAccountRepository interface {
+	Create(ctx context.Context, account domain.BankAccount) (domain.BankAccount, error)
+	FindByUserID(ctx context.Context, userID uint) ([]domain.BankAccount, error)
+	FindByID(ctx context.Context, id uint64, userID uint) (domain.BankAccount, error)
+	Delete(ctx context.Context, id uint64, userID uint) error
+}
+
+type WithdrawalRepository interface {
+	Create(ctx context.Context, withdrawal domain.Withdrawal) (domain.Withdrawal, error)
+	Update(ctx context.Context, withdrawal domain.Withdrawal) error
+	FindByID(ctx context.Context, id uint64) (domain.Withdrawal, error)
+	LockByID(ctx context.Context, id uint64) (domain.Withdrawal, error)
+	FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.Withdrawal, int64, error)
+	FindByStatus(ctx context.Context, status string, limit, offset int) ([]domain.Withdrawal, int64, error)
+	GetStaleWithdrawals(ctx context.Context, status string, before time.Time, limit int) ([]domain.Withdrawal, error)
+}
+
+// DisbursementGateway pays money out to a bank account. The gateway in use is
+// picked from config when the server starts.
+type DisbursementGateway interface {
+	Name() string
+	CreateDisbursement(ctx context.Context, disbursement domain.DisbursementRequest) (domain.Disbursement, error)
+	GetDisbursement(ctx context.Context, disbursementID string) (domain.Disbursement, error)
+}
+
+const (
+	defaultStatementLimit = 20
+	maxStatementLimit     = 100
+)
+
+type walletService struct {
+	walletRepo      WalletRepository
+	userRepo        user.UserRepository
+	bankAccountRepo BankAccountRepository
+	withdrawalRepo  WithdrawalRepository
+	disbursement    DisbursementGateway
+	txManager       orders.Transactor
+
+	// approvalThreshold is the largest withdrawal sent without an admin's approval
+	approvalThreshold domain.Money
+}
+
+func NewWalletService(walletRepo WalletRepository, userRepo user.UserRepository, bankAccountRepo BankAccountRepository, withdrawalRepo WithdrawalRepository, disbursement DisbursementGateway, txManager orders.Transactor, approvalThreshold domain.Money) *walletService {
+	return &walletService{
+		walletRepo:        walletRepo,
+		userRepo:          userRepo,
+		bankAccountRepo:   bankAccountRepo,
+		withdrawalRepo:    withdrawalRepo,
+		disbursement:      disbursement,
+		txManager:         txManager,
+		approvalThreshold: approvalThreshold,
+	}
+}
+
+func (s *walletService) GetTransactions(ctx context.Context, userID uint, page, limit int) (domain.WalletStatement, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get wallet transactions")
+		return domain.WalletStatement{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultStatementLimit
+	}
+	if limit > maxStatementLimit {
+		limit = maxStatementLimit
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to find user", err)
+		return domain.WalletStatement{}, err
+	}
+
+	entries, total, err := s.walletRepo.FindByUserID(ctx, userID, limit, (page-1)*limit)
+	if err != nil {
+		logger.Error("Failed to find wallet transactions", err)
+		return domain.WalletStatement{}, err
+	}
+
+	return domain.WalletStatement{
+		UserID:  userID,
+		Balance: user.Wallet,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+		Entries: entries,
+	}, nil
+}
+
+// Adjust lets an admin correct a wallet. A positive amount credits the wallet,
+// a negative amount debits it.
+func (s *walletService) Adjust(ctx context.Context, adminID, userID uint, amount domain.Money, description string) (domain.WalletLedgerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when adjusting wallet")
+		return domain.WalletLedgerEntry{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if amount.IsZero() {
+		logger.Error("Invalid wallet adjustment: amount is zero")
+		return domain.WalletLedgerEntry{}, errors.New("amount cannot be zero")
+	}
+
+	if description == "" {
+		logger.Error("Invalid wallet adjustment: description is required")
+		return domain.WalletLedgerEntry{}, errors.New("description is required")
+	}
+
+	direction := domain.WalletDirectionCredit
+	if amount.IsNegative() {
+		direction = domain.WalletDirectionDebit
+		amount = amount.Neg()
+	}
+
+	entry, err := s.walletRepo.Post(ctx, domain.WalletPosting{
+		UserID:        userID,
+		Direction:     direction,
+		EntryType:     domain.WalletEntryAdjustment,
+		Amount:        amount,
+		ContraAccount: domain.LedgerAccountAdjustments,
+		Description:   description,
+		CreatedBy:     fmt.Sprintf("admin:%d", adminID),
+	})
+	if err != nil {
+		logger.Error("failed to adjust wallet", err)
+		return domain.WalletLedgerEntry{}, err
+	}
+
+	logger.Info("wallet adjusted successfully")
+
+	return entry, nil
+}
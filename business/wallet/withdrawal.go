@@ -0,0 +1,427 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syncBatch caps how many withdrawals one sync pass asks the gateway about
+const syncBatch = 100
+
+const withdrawalExternalIDPrefix = "withdrawal-"
+
+func (s *walletService) AddBankAccount(ctx context.Context, account domain.BankAccount) (domain.BankAccount, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when adding bank account")
+		return domain.BankAccount{}, fmt.Errorf("context error: %w", err)
+	}
+
+	account.BankCode = strings.ToUpper(strings.TrimSpace(account.BankCode))
+	account.AccountNumber = strings.TrimSpace(account.AccountNumber)
+	account.AccountHolderName = strings.TrimSpace(account.AccountHolderName)
+
+	existing, err := s.bankAccountRepo.FindByUserID(ctx, account.UserID)
+	if err != nil {
+		logger.Error("Failed to find bank accounts", err)
+		return domain.BankAccount{}, err
+	}
+	for _, other := range existing {
+		if other.BankCode == account.BankCode && other.AccountNumber == account.AccountNumber {
+			return domain.BankAccount{}, errors.New("bank account already exists")
+		}
+	}
+
+	account, err = s.bankAccountRepo.Create(ctx, account)
+	if err != nil {
+		logger.Error("Failed to create bank account", err)
+		return domain.BankAccount{}, err
+	}
+
+	return account, nil
+}
+
+func (s *walletService) GetBankAccounts(ctx context.Context, userID uint) ([]domain.BankAccount, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get bank accounts")
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.bankAccountRepo.FindByUserID(ctx, userID)
+}
+
+func (s *walletService) DeleteBankAccount(ctx context.Context, userID uint, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when deleting bank account")
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return s.bankAccountRepo.Delete(ctx, id, userID)
+}
+
+// RequestWithdrawal debits the wallet and pays the amount out to one of the
+// user's bank accounts. Withdrawals above the approval threshold stay
+// REQUESTED until an admin approves or rejects them, smaller ones are sent
+// to the disbursement gateway straight away.
+func (s *walletService) RequestWithdrawal(ctx context.Context, userID uint, bankAccountID uint64, amount domain.Money) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when requesting withdrawal")
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if !amount.IsPositive() {
+		return domain.Withdrawal{}, errors.New("amount must be greater than 0")
+	}
+	if !amount.IsWhole() {
+		return domain.Withdrawal{}, errors.New("amount must be a whole number")
+	}
+
+	account, err := s.bankAccountRepo.FindByID(ctx, bankAccountID, userID)
+	if err != nil {
+		logger.Error("Failed to find bank account", err)
+		return domain.Withdrawal{}, err
+	}
+
+	var withdrawal domain.Withdrawal
+	err = s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		withdrawal, err = s.withdrawalRepo.Create(ctx, domain.Withdrawal{
+			UserID:        userID,
+			BankAccountID: account.ID,
+			Amount:        amount,
+			Status:        domain.WithdrawalStatusRequested,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Rejected with ErrInsufficientBalance when the wallet does not cover it
+		_, err = s.walletRepo.Post(ctx, domain.WalletPosting{
+			UserID:        userID,
+			Direction:     domain.WalletDirectionDebit,
+			EntryType:     domain.WalletEntryWithdrawal,
+			Amount:        amount,
+			ContraAccount: domain.LedgerAccountPayouts,
+			Reference:     fmt.Sprintf("withdrawal:%d", withdrawal.ID),
+			Description:   fmt.Sprintf("withdrawal to %s %s", account.BankCode, account.AccountNumber),
+			CreatedBy:     fmt.Sprintf("user:%d", userID),
+		})
+
+		return err
+	})
+	if err != nil {
+		logger.Error("Failed to request withdrawal", err)
+		return domain.Withdrawal{}, err
+	}
+
+	logger.Info("Withdrawal requested", "withdrawal", withdrawal.ID, "user", userID, "amount", amount)
+
+	if s.approvalThreshold.IsPositive() && amount.GreaterThan(s.approvalThreshold) {
+		withdrawal.BankAccount = &account
+		return withdrawal, nil
+	}
+
+	return s.disburse(ctx, withdrawal.ID, "system")
+}
+
+func (s *walletService) GetWithdrawals(ctx context.Context, userID uint, page, limit int) ([]domain.Withdrawal, int64, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when get withdrawals")
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	page, limit = pageBounds(page, limit)
+	return s.withdrawalRepo.FindByUserID(ctx, userID, limit, (page-1)*limit)
+}
+
+// ListWithdrawals lists every user's withdrawals for admins, filtered by status when given
+func (s *walletService) ListWithdrawals(ctx context.Context, status string, page, limit int) ([]domain.Withdrawal, int64, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when listing withdrawals")
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	page, limit = pageBounds(page, limit)
+	return s.withdrawalRepo.FindByStatus(ctx, strings.ToUpper(status), limit, (page-1)*limit)
+}
+
+func (s *walletService) ApproveWithdrawal(ctx context.Context, adminID uint, id uint64) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when approving withdrawal")
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	return s.disburse(ctx, id, fmt.Sprintf("admin:%d", adminID))
+}
+
+// RejectWithdrawal fails a withdrawal still waiting for approval and gives
+// the money back to the wallet
+func (s *walletService) RejectWithdrawal(ctx context.Context, adminID uint, id uint64, reason string) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when rejecting withdrawal")
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if reason == "" {
+		return domain.Withdrawal{}, errors.New("reason is required")
+	}
+
+	actor := fmt.Sprintf("admin:%d", adminID)
+	var withdrawal domain.Withdrawal
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		withdrawal, err = s.withdrawalRepo.LockByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if withdrawal.Status != domain.WithdrawalStatusRequested {
+			return fmt.Errorf("withdrawal is %s, only %s withdrawals can be rejected", withdrawal.Status, domain.WithdrawalStatusRequested)
+		}
+
+		withdrawal.ApprovedBy = actor
+		return s.failWithdrawal(ctx, &withdrawal, "rejected: "+reason, actor)
+	})
+	if err != nil {
+		logger.Error("Failed to reject withdrawal", err)
+		return domain.Withdrawal{}, err
+	}
+
+	logger.Info("Withdrawal rejected", "withdrawal", id, "by", actor)
+
+	return withdrawal, nil
+}
+
+// ReceiveDisbursementCallback applies a payout status pushed by the gateway.
+// Callbacks for withdrawals that are already COMPLETED or FAILED are ignored,
+// so redelivered callbacks are harmless.
+func (s *walletService) ReceiveDisbursementCallback(ctx context.Context, disbursement domain.Disbursement) error {
+	if err := ctx.Err(); err != nil {
+		logger.Error("context error when receiving disbursement callback")
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	id, err := withdrawalID(disbursement.ExternalID)
+	if err != nil {
+		logger.Error("Invalid disbursement callback", err)
+		return err
+	}
+
+	_, err = s.applyDisbursement(ctx, id, disbursement, s.disbursement.Name())
+	if err != nil {
+		logger.Error("Failed to apply disbursement callback", err)
+		return err
+	}
+
+	return nil
+}
+
+// SyncWithdrawals is the safety net for payout callbacks that never arrived.
+// It asks the gateway about every withdrawal PROCESSING since before
+// olderThan, and sends again the ones whose first attempt never got an
+// answer; the idempotency key stops them being paid twice.
+func (s *walletService) SyncWithdrawals(ctx context.Context, olderThan time.Duration) error {
+	stale, err := s.withdrawalRepo.GetStaleWithdrawals(ctx, domain.WithdrawalStatusProcessing, time.Now().Add(-olderThan), syncBatch)
+	if err != nil {
+		return err
+	}
+
+	var synced, failed int
+	for _, withdrawal := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+		if withdrawal.Gateway != "" && withdrawal.Gateway != s.disbursement.Name() {
+			continue
+		}
+
+		if withdrawal.DisbursementID == "" {
+			_, err = s.disburse(ctx, withdrawal.ID, "")
+		} else {
+			var disbursement domain.Disbursement
+			disbursement, err = s.disbursement.GetDisbursement(ctx, withdrawal.DisbursementID)
+			if err == nil {
+				_, err = s.applyDisbursement(ctx, withdrawal.ID, disbursement, "reconciler")
+			}
+		}
+		if err != nil {
+			failed++
+			logger.Warn("Failed to sync withdrawal", "withdrawal", withdrawal.ID, "error", err)
+			continue
+		}
+		synced++
+	}
+
+	if len(stale) > 0 {
+		logger.Info("Withdrawal sync finished", "checked", len(stale), "synced", synced, "failed", failed)
+	}
+
+	return nil
+}
+
+// disburse moves a REQUESTED withdrawal to PROCESSING and sends it to the
+// gateway. The status change is committed before the gateway is called, so
+// two approvals of the same withdrawal cannot both send it. A PROCESSING
+// withdrawal without a disbursement id is sent again, that is how the sync
+// job retries an attempt that got no answer. approvedBy is empty on retries.
+func (s *walletService) disburse(ctx context.Context, id uint64, approvedBy string) (domain.Withdrawal, error) {
+	var withdrawal domain.Withdrawal
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		withdrawal, err = s.withdrawalRepo.LockByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		retry := withdrawal.Status == domain.WithdrawalStatusProcessing && withdrawal.DisbursementID == "" && approvedBy == ""
+		if withdrawal.Status != domain.WithdrawalStatusRequested && !retry {
+			return fmt.Errorf("withdrawal is %s, only %s withdrawals can be approved", withdrawal.Status, domain.WithdrawalStatusRequested)
+		}
+		if retry {
+			return nil
+		}
+
+		withdrawal.Status = domain.WithdrawalStatusProcessing
+		withdrawal.Gateway = s.disbursement.Name()
+		withdrawal.ApprovedBy = approvedBy
+		return s.withdrawalRepo.Update(ctx, withdrawal)
+	})
+	if err != nil {
+		logger.Error("Failed to start withdrawal", err)
+		return domain.Withdrawal{}, err
+	}
+
+	withdrawal, err = s.withdrawalRepo.FindByID(ctx, id)
+	if err != nil {
+		return domain.Withdrawal{}, err
+	}
+	if withdrawal.BankAccount == nil {
+		return domain.Withdrawal{}, fmt.Errorf("withdrawal %d has no bank account", id)
+	}
+
+	disbursement, err := s.disbursement.CreateDisbursement(ctx, domain.DisbursementRequest{
+		ExternalID:        fmt.Sprintf("%s%d", withdrawalExternalIDPrefix, withdrawal.ID),
+		Amount:            withdrawal.Amount,
+		BankCode:          withdrawal.BankAccount.BankCode,
+		AccountNumber:     withdrawal.BankAccount.AccountNumber,
+		AccountHolderName: withdrawal.BankAccount.AccountHolderName,
+		Description:       fmt.Sprintf("MyGreenMarket wallet withdrawal %d", withdrawal.ID),
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrDisbursementRejected) {
+			return s.applyDisbursement(ctx, id, domain.Disbursement{Status: "FAILED", FailureCode: err.Error()}, s.disbursement.Name())
+		}
+
+		// The payout may or may not have been sent, it stays PROCESSING for the sync job
+		logger.Warn("Disbursement got no answer, leaving it to the sync job", "withdrawal", id, "error", err)
+		return withdrawal, nil
+	}
+
+	return s.applyDisbursement(ctx, id, disbursement, s.disbursement.Name())
+}
+
+// applyDisbursement records what the gateway reported about a payout. A
+// FAILED payout credits the amount back to the wallet.
+func (s *walletService) applyDisbursement(ctx context.Context, id uint64, disbursement domain.Disbursement, actor string) (domain.Withdrawal, error) {
+	err := s.txManager.WithinTransaction(ctx, func(ctx context.Context) error {
+		withdrawal, err := s.withdrawalRepo.LockByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		switch withdrawal.Status {
+		case domain.WithdrawalStatusCompleted, domain.WithdrawalStatusFailed:
+			return nil
+		case domain.WithdrawalStatusRequested:
+			return fmt.Errorf("withdrawal %d was not sent yet", id)
+		}
+		if disbursement.ID != "" {
+			if withdrawal.DisbursementID != "" && withdrawal.DisbursementID != disbursement.ID {
+				return fmt.Errorf("disbursement %s does not belong to withdrawal %d", disbursement.ID, id)
+			}
+			withdrawal.DisbursementID = disbursement.ID
+		}
+
+		switch disbursement.Status {
+		case "COMPLETED":
+			withdrawal.Status = domain.WithdrawalStatusCompleted
+		case "FAILED":
+			reason := disbursement.FailureCode
+			if reason == "" {
+				reason = "disbursement failed"
+			}
+			return s.failWithdrawal(ctx, &withdrawal, reason, actor)
+		}
+
+		return s.withdrawalRepo.Update(ctx, withdrawal)
+	})
+	if err != nil {
+		return domain.Withdrawal{}, err
+	}
+
+	withdrawal, err := s.withdrawalRepo.FindByID(ctx, id)
+	if err != nil {
+		return domain.Withdrawal{}, err
+	}
+
+	logger.Info("Withdrawal updated", "withdrawal", id, "status", withdrawal.Status)
+
+	return withdrawal, nil
+}
+
+// failWithdrawal marks the withdrawal FAILED and reverses its wallet debit.
+// Must run in a transaction holding the withdrawal's lock.
+func (s *walletService) failWithdrawal(ctx context.Context, withdrawal *domain.Withdrawal, reason, actor string) error {
+	withdrawal.Status = domain.WithdrawalStatusFailed
+	withdrawal.FailureReason = reason
+	if err := s.withdrawalRepo.Update(ctx, *withdrawal); err != nil {
+		return err
+	}
+
+	_, err := s.walletRepo.Post(ctx, domain.WalletPosting{
+		UserID:        withdrawal.UserID,
+		Direction:     domain.WalletDirectionCredit,
+		EntryType:     domain.WalletEntryWithdrawalReversal,
+		Amount:        withdrawal.Amount,
+		ContraAccount: domain.LedgerAccountPayouts,
+		Reference:     fmt.Sprintf("withdrawal:%d", withdrawal.ID),
+		Description:   fmt.Sprintf("withdrawal %d failed: %s", withdrawal.ID, reason),
+		CreatedBy:     actor,
+	})
+
+	return err
+}
+
+// withdrawalID reads the withdrawal id back out of a disbursement external id
+func withdrawalID(externalID string) (uint64, error) {
+	if !strings.HasPrefix(externalID, withdrawalExternalIDPrefix) {
+		return 0, fmt.Errorf("external id %q is not a withdrawal", externalID)
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(externalID, withdrawalExternalIDPrefix), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("external id %q is not a withdrawal", externalID)
+	}
+
+	return id, nil
+}
+
+func pageBounds(page, limit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultStatementLimit
+	}
+	if limit > maxStatementLimit {
+		limit = maxStatementLimit
+	}
+
+	return page, limit
+}
@@ -0,0 +1,377 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"myGreenMarket/domain"
+	"myGreenMarket/internal/repository/stubdisbursement"
+	"myGreenMarket/pkg/logger"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("development")
+	os.Exit(m.Run())
+}
+
+const testUser = uint(1)
+
+var (
+	goodAccount    = domain.BankAccount{ID: 1, UserID: testUser, BankCode: "BCA", AccountNumber: "1234567890", AccountHolderName: "Budi"}
+	failingAccount = domain.BankAccount{ID: 2, UserID: testUser, BankCode: "BCA", AccountNumber: stubdisbursement.FailingAccountPrefix + "1234", AccountHolderName: "Budi"}
+)
+
+func TestWithdrawalTransitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		account     domain.BankAccount
+		amount      domain.Money
+		gatewayDown bool
+		// then runs after the withdrawal was requested
+		then        func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal)
+		wantErr     bool
+		wantStatus  string
+		wantBalance domain.Money
+	}{
+		{
+			name:        "small payout completes straight away",
+			account:     goodAccount,
+			amount:      domain.IDR(50000),
+			wantStatus:  domain.WithdrawalStatusCompleted,
+			wantBalance: domain.IDR(50000),
+		},
+		{
+			name:        "failed payout is credited back",
+			account:     failingAccount,
+			amount:      domain.IDR(50000),
+			wantStatus:  domain.WithdrawalStatusFailed,
+			wantBalance: domain.IDR(100000),
+		},
+		{
+			name:        "more than the wallet holds",
+			account:     goodAccount,
+			amount:      domain.IDR(150000),
+			wantErr:     true,
+			wantBalance: domain.IDR(100000),
+		},
+		{
+			name:        "large payout waits for approval",
+			account:     goodAccount,
+			amount:      domain.IDR(80000),
+			wantStatus:  domain.WithdrawalStatusRequested,
+			wantBalance: domain.IDR(20000),
+		},
+		{
+			name:    "approved payout completes",
+			account: goodAccount,
+			amount:  domain.IDR(80000),
+			then: func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal) {
+				if _, err := env.service.ApproveWithdrawal(context.Background(), 9, withdrawal.ID); err != nil {
+					t.Fatalf("ApproveWithdrawal error: %v", err)
+				}
+				if _, err := env.service.ApproveWithdrawal(context.Background(), 9, withdrawal.ID); err == nil {
+					t.Error("second approval did not fail")
+				}
+			},
+			wantStatus:  domain.WithdrawalStatusCompleted,
+			wantBalance: domain.IDR(20000),
+		},
+		{
+			name:    "rejected payout is credited back",
+			account: goodAccount,
+			amount:  domain.IDR(80000),
+			then: func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal) {
+				if _, err := env.service.RejectWithdrawal(context.Background(), 9, withdrawal.ID, "suspicious"); err != nil {
+					t.Fatalf("RejectWithdrawal error: %v", err)
+				}
+				if _, err := env.service.ApproveWithdrawal(context.Background(), 9, withdrawal.ID); err == nil {
+					t.Error("approving a rejected withdrawal did not fail")
+				}
+			},
+			wantStatus:  domain.WithdrawalStatusFailed,
+			wantBalance: domain.IDR(100000),
+		},
+		{
+			name:        "unanswered payout stays processing",
+			account:     goodAccount,
+			amount:      domain.IDR(50000),
+			gatewayDown: true,
+			wantStatus:  domain.WithdrawalStatusProcessing,
+			wantBalance: domain.IDR(50000),
+		},
+		{
+			name:        "sync sends an unanswered payout again",
+			account:     goodAccount,
+			amount:      domain.IDR(50000),
+			gatewayDown: true,
+			then: func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal) {
+				env.gateway.down = false
+				if err := env.service.SyncWithdrawals(context.Background(), 0); err != nil {
+					t.Fatalf("SyncWithdrawals error: %v", err)
+				}
+			},
+			wantStatus:  domain.WithdrawalStatusCompleted,
+			wantBalance: domain.IDR(50000),
+		},
+		{
+			name:    "redelivered callback is ignored",
+			account: goodAccount,
+			amount:  domain.IDR(50000),
+			then: func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal) {
+				err := env.service.ReceiveDisbursementCallback(context.Background(), domain.Disbursement{
+					ID:          withdrawal.DisbursementID,
+					ExternalID:  "withdrawal-1",
+					Status:      "FAILED",
+					FailureCode: "LATE",
+				})
+				if err != nil {
+					t.Fatalf("ReceiveDisbursementCallback error: %v", err)
+				}
+			},
+			wantStatus:  domain.WithdrawalStatusCompleted,
+			wantBalance: domain.IDR(50000),
+		},
+		{
+			name:        "callback completes a processing payout",
+			account:     goodAccount,
+			amount:      domain.IDR(50000),
+			gatewayDown: true,
+			then: func(t *testing.T, env *withdrawalEnv, withdrawal domain.Withdrawal) {
+				err := env.service.ReceiveDisbursementCallback(context.Background(), domain.Disbursement{
+					ID:         "remote-1",
+					ExternalID: "withdrawal-1",
+					Status:     "COMPLETED",
+				})
+				if err != nil {
+					t.Fatalf("ReceiveDisbursementCallback error: %v", err)
+				}
+			},
+			wantStatus:  domain.WithdrawalStatusCompleted,
+			wantBalance: domain.IDR(50000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newWithdrawalEnv(domain.IDR(100000), domain.IDR(75000))
+			env.gateway.down = tt.gatewayDown
+
+			withdrawal, err := env.service.RequestWithdrawal(context.Background(), testUser, tt.account.ID, tt.amount)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("RequestWithdrawal = %+v, want an error", withdrawal)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("RequestWithdrawal error: %v", err)
+				}
+				if tt.then != nil {
+					tt.then(t, env, withdrawal)
+				}
+
+				got, err := env.withdrawals.FindByID(context.Background(), withdrawal.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Status != tt.wantStatus {
+					t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+				}
+				if got.Status == domain.WithdrawalStatusCompleted && got.DisbursementID == "" {
+					t.Error("completed withdrawal has no disbursement id")
+				}
+				if got.Status == domain.WithdrawalStatusFailed && got.FailureReason == "" {
+					t.Error("failed withdrawal has no failure reason")
+				}
+			}
+
+			if balance := env.wallet.balances[testUser]; balance.Cmp(tt.wantBalance) != 0 {
+				t.Errorf("wallet balance = %s, want %s", balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestWithdrawalID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{in: "withdrawal-42", want: 42},
+		{in: "withdrawal-", wantErr: true},
+		{in: "withdrawal-x", wantErr: true},
+		{in: "payment-42", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := withdrawalID(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("withdrawalID(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+type withdrawalEnv struct {
+	service     *walletService
+	wallet      *fakeWalletRepo
+	withdrawals *fakeWithdrawalRepo
+	gateway     *flakyDisbursementGateway
+}
+
+func newWithdrawalEnv(balance, approvalThreshold domain.Money) *withdrawalEnv {
+	accounts := &fakeBankAccountRepo{accounts: map[uint64]domain.BankAccount{
+		goodAccount.ID:    goodAccount,
+		failingAccount.ID: failingAccount,
+	}}
+	env := &withdrawalEnv{
+		wallet:      &fakeWalletRepo{balances: map[uint]domain.Money{testUser: balance}},
+		withdrawals: &fakeWithdrawalRepo{accounts: accounts, withdrawals: map[uint64]domain.Withdrawal{}},
+		gateway:     &flakyDisbursementGateway{StubDisbursementGateway: stubdisbursement.NewStubDisbursementGateway()},
+	}
+	env.service = NewWalletService(env.wallet, nil, accounts, env.withdrawals, env.gateway, fakeTransactor{}, approvalThreshold)
+
+	return env
+}
+
+// flakyDisbursementGateway is the stub gateway with an outage switch
+type flakyDisbursementGateway struct {
+	*stubdisbursement.StubDisbursementGateway
+	down bool
+}
+
+func (g *flakyDisbursementGateway) CreateDisbursement(ctx context.Context, disbursement domain.DisbursementRequest) (domain.Disbursement, error) {
+	if g.down {
+		return domain.Disbursement{}, errors.New("gateway timeout")
+	}
+
+	return g.StubDisbursementGateway.CreateDisbursement(ctx, disbursement)
+}
+
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type fakeWalletRepo struct {
+	balances map[uint]domain.Money
+}
+
+func (r *fakeWalletRepo) Post(ctx context.Context, posting domain.WalletPosting) (domain.WalletLedgerEntry, error) {
+	balance := r.balances[posting.UserID]
+	if posting.Direction == domain.WalletDirectionDebit {
+		if balance.LessThan(posting.Amount) {
+			return domain.WalletLedgerEntry{}, domain.ErrInsufficientBalance
+		}
+		balance = balance.Sub(posting.Amount)
+	} else {
+		balance = balance.Add(posting.Amount)
+	}
+	r.balances[posting.UserID] = balance
+
+	return domain.WalletLedgerEntry{
+		UserID:       &posting.UserID,
+		Direction:    posting.Direction,
+		EntryType:    posting.EntryType,
+		Amount:       posting.Amount,
+		BalanceAfter: &balance,
+		Reference:    posting.Reference,
+	}, nil
+}
+
+func (r *fakeWalletRepo) Transfer(ctx context.Context, transfer domain.LedgerTransfer) error {
+	return nil
+}
+
+func (r *fakeWalletRepo) FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.WalletLedgerEntry, int64, error) {
+	return nil, 0, nil
+}
+
+type fakeBankAccountRepo struct {
+	accounts map[uint64]domain.BankAccount
+}
+
+func (r *fakeBankAccountRepo) Create(ctx context.Context, account domain.BankAccount) (domain.BankAccount, error) {
+	account.ID = uint64(len(r.accounts) + 1)
+	r.accounts[account.ID] = account
+	return account, nil
+}
+
+func (r *fakeBankAccountRepo) FindByUserID(ctx context.Context, userID uint) ([]domain.BankAccount, error) {
+	var accounts []domain.BankAccount
+	for _, account := range r.accounts {
+		if account.UserID == userID {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+func (r *fakeBankAccountRepo) FindByID(ctx context.Context, id uint64, userID uint) (domain.BankAccount, error) {
+	account, ok := r.accounts[id]
+	if !ok || account.UserID != userID {
+		return domain.BankAccount{}, errors.New("bank account not found")
+	}
+	return account, nil
+}
+
+func (r *fakeBankAccountRepo) Delete(ctx context.Context, id uint64, userID uint) error {
+	delete(r.accounts, id)
+	return nil
+}
+
+type fakeWithdrawalRepo struct {
+	accounts    *fakeBankAccountRepo
+	withdrawals map[uint64]domain.Withdrawal
+}
+
+func (r *fakeWithdrawalRepo) Create(ctx context.Context, withdrawal domain.Withdrawal) (domain.Withdrawal, error) {
+	withdrawal.ID = uint64(len(r.withdrawals) + 1)
+	r.withdrawals[withdrawal.ID] = withdrawal
+	return withdrawal, nil
+}
+
+func (r *fakeWithdrawalRepo) Update(ctx context.Context, withdrawal domain.Withdrawal) error {
+	if _, ok := r.withdrawals[withdrawal.ID]; !ok {
+		return errors.New("withdrawal not found")
+	}
+	withdrawal.BankAccount = nil
+	r.withdrawals[withdrawal.ID] = withdrawal
+	return nil
+}
+
+// FindByID loads the bank account with the withdrawal, like the postgres repository
+func (r *fakeWithdrawalRepo) FindByID(ctx context.Context, id uint64) (domain.Withdrawal, error) {
+	withdrawal, ok := r.withdrawals[id]
+	if !ok {
+		return domain.Withdrawal{}, errors.New("withdrawal not found")
+	}
+	if account, ok := r.accounts.accounts[withdrawal.BankAccountID]; ok {
+		withdrawal.BankAccount = &account
+	}
+	return withdrawal, nil
+}
+
+func (r *fakeWithdrawalRepo) LockByID(ctx context.Context, id uint64) (domain.Withdrawal, error) {
+	return r.FindByID(ctx, id)
+}
+
+func (r *fakeWithdrawalRepo) FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.Withdrawal, int64, error) {
+	return nil, 0, nil
+}
+
+func (r *fakeWithdrawalRepo) FindByStatus(ctx context.Context, status string, limit, offset int) ([]domain.Withdrawal, int64, error) {
+	return nil, 0, nil
+}
+
+func (r *fakeWithdrawalRepo) GetStaleWithdrawals(ctx context.Context, status string, before time.Time, limit int) ([]domain.Withdrawal, error) {
+	var stale []domain.Withdrawal
+	for _, withdrawal := range r.withdrawals {
+		if withdrawal.Status == status && !withdrawal.UpdatedAt.After(before) {
+			stale = append(stale, withdrawal)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// ALTER TABLE public.products ADD COLUMN reorder_threshold NUMERIC CHECK (reorder_threshold >= 0);
+//
+// CREATE TABLE public.stock_alerts (
+//     id           BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     product_id   BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+//     kind         TEXT NOT NULL,
+//     batch_id     BIGINT REFERENCES stock_batches(id) ON DELETE CASCADE,
+//     quantity     NUMERIC NOT NULL,
+//     threshold    NUMERIC,
+//     expires_at   TIMESTAMPTZ,
+//     message      TEXT NOT NULL,
+//     notified_at  TIMESTAMPTZ,
+//     resolved_at  TIMESTAMPTZ,
+//     created_at   TIMESTAMPTZ DEFAULT NOW()
+// );
+// -- At most one open alert per item, a condition is reported again only after it cleared
+// CREATE UNIQUE INDEX idx_stock_alerts_open ON public.stock_alerts (product_id, kind, COALESCE(batch_id, 0)) WHERE resolved_at IS NULL;
+
+type AlertKind string
+
+const (
+	// AlertKindLowStock is a product at or below its reorder threshold
+	AlertKindLowStock AlertKind = "LOW_STOCK"
+	// AlertKindOutOfStock is a product with a reorder threshold and nothing left on sale
+	AlertKindOutOfStock AlertKind = "OUT_OF_STOCK"
+	// AlertKindExpiring is a batch with stock left that expires soon
+	AlertKindExpiring AlertKind = "EXPIRING"
+)
+
+// StockAlert is one low-stock or expiring item in the admin alert feed. It
+// stays open while the condition holds and is resolved once it clears, so an
+// item is reported once however many evaluations see it.
+type StockAlert struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID  uint64     `gorm:"column:product_id;not null" json:"product_id"`
+	Kind       AlertKind  `gorm:"column:kind;type:text" json:"kind"`
+	BatchID    *uint64    `gorm:"column:batch_id" json:"batch_id,omitempty"`
+	Quantity   float64    `gorm:"column:quantity;type:numeric" json:"quantity"`
+	Threshold  *float64   `gorm:"column:threshold;type:numeric" json:"threshold,omitempty"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	Message    string     `gorm:"column:message;type:text" json:"message"`
+	NotifiedAt *time.Time `gorm:"column:notified_at" json:"notified_at,omitempty"`
+	ResolvedAt *time.Time `gorm:"column:resolved_at" json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (StockAlert) TableName() string {
+	return "stock_alerts"
+}
+
+// Key identifies the item the alert is about, open alerts never share one
+func (a StockAlert) Key() string {
+	var batchID uint64
+	if a.BatchID != nil {
+		batchID = *a.BatchID
+	}
+
+	return fmt.Sprintf("%s:%d:%d", a.Kind, a.ProductID, batchID)
+}
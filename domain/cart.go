@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.cart_items (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     user_id         BIGINT NOT NULL REFERENCES users(id),
+//     product_id      BIGINT NOT NULL REFERENCES products(id),
+//     quantity        INT NOT NULL,
+//     created_at      TIMESTAMPTZ DEFAULT NOW(),
+//     updated_at      TIMESTAMPTZ DEFAULT NOW(),
+//     UNIQUE (user_id, product_id)
+// );
+
+type CartItem struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint      `gorm:"column:user_id;not null" json:"user_id"`
+	ProductID   uint64    `gorm:"column:product_id;not null" json:"product_id"`
+	Quantity    int       `gorm:"column:quantity;not null" json:"quantity"`
+	ProductName string    `gorm:"-" json:"product_name"`
+	PriceEach   Money     `gorm:"-" json:"price_each"`
+	Subtotal    Money     `gorm:"-" json:"subtotal"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (CartItem) TableName() string {
+	return "cart_items"
+}
+
+type Cart struct {
+	UserID uint       `json:"user_id"`
+	Items  []CartItem `json:"items"`
+	Total  Money      `json:"total"`
+}
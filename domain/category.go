@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"strings"
 	"time"
+	"unicode"
 )
 
 // CREATE TABLE public.category (
@@ -9,13 +11,60 @@ import (
 //     product_category    TEXT NOT NULL,
 //     created_at          TIMESTAMPTZ DEFAULT NOW()
 // );
+//
+// ALTER TABLE public.categories
+//     ADD COLUMN parent_id BIGINT REFERENCES categories(category_id) ON DELETE RESTRICT,
+//     ADD COLUMN slug      TEXT;
+// -- Categories products use that were never created
+// INSERT INTO public.categories (product_category)
+// SELECT DISTINCT p.product_category FROM public.products p
+// WHERE p.product_category <> '' AND NOT EXISTS (SELECT 1 FROM public.categories c WHERE c.product_category = p.product_category);
+// UPDATE public.categories SET slug = TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(product_category, '[^[:alnum:]]+', '-', 'g')));
+// ALTER TABLE public.categories ALTER COLUMN slug SET NOT NULL;
+// CREATE UNIQUE INDEX idx_categories_slug ON public.categories (slug);
+// CREATE INDEX idx_categories_parent ON public.categories (parent_id);
+//
+// ALTER TABLE public.products ADD COLUMN category_id BIGINT REFERENCES categories(category_id) ON DELETE RESTRICT;
+// UPDATE public.products p SET category_id = c.category_id FROM public.categories c WHERE c.product_category = p.product_category;
+// CREATE INDEX idx_products_category_id ON public.products (category_id);
 
+// Category groups products, ParentID nests it under another category. Slug
+// is the category's unique URL name.
 type Category struct {
 	CategoryID      uint64    `gorm:"primaryKey;column:category_id;autoIncrement"`
 	ProductCategory string    `gorm:"column:product_category;type:text;not null"`
+	ParentID        *uint64   `gorm:"column:parent_id"`
+	Slug            string    `gorm:"column:slug;type:text;not null"`
 	CreatedAt       time.Time `gorm:"column:created_at"`
 }
 
 func (Category) TableName() string {
 	return "categories"
 }
+
+// CategoryNode is a category in the category tree. ProductCount counts the
+// products in the category and in every category under it.
+type CategoryNode struct {
+	Category
+	ProductCount int64
+	Children     []CategoryNode
+}
+
+// Slugify turns a category name into a slug, "Sayur & Buah" is "sayur-buah"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Sayur & Buah", want: "sayur-buah"},
+		{in: "Sayur", want: "sayur"},
+		{in: "  Daging   Sapi  ", want: "daging-sapi"},
+		{in: "Buah-Buahan Lokal!", want: "buah-buahan-lokal"},
+		{in: "Telur 10 Butir", want: "telur-10-butir"},
+		{in: "Café Crème", want: "café-crème"},
+		{in: "&&", want: ""},
+		{in: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Slugify(tt.in); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
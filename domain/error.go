@@ -1,7 +1,34 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrProductNotFound = errors.New("product not found")
+	ErrProductNotFound     = errors.New("product not found")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrNoActiveReservation = errors.New("order has no active stock reservation")
+	ErrInsufficientBalance = errors.New("insufficient wallet balance")
+	ErrInvoiceNotFound     = errors.New("invoice not found")
+	ErrCategoryNotFound    = errors.New("category not found")
+	// ErrCategoryInUse means a category still has products, they have to be moved first
+	ErrCategoryInUse = errors.New("category still has products")
+	// ErrInvalidProductQuery wraps why a product search was refused
+	ErrInvalidProductQuery = errors.New("invalid product query")
+	// ErrRefundRejected means the gateway refused a refund, no money was returned
+	ErrRefundRejected = errors.New("refund rejected")
+	// ErrDisbursementRejected means the gateway refused a payout, it was never sent
+	ErrDisbursementRejected = errors.New("disbursement rejected")
 )
+
+// InvalidTransitionError is returned when an order is asked to move to a
+// status the transition table does not allow
+type InvalidTransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order cannot move from %s to %s", e.From, e.To)
+}
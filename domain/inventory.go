@@ -0,0 +1,178 @@
+package domain
+
+import (
+	"math"
+	"time"
+)
+
+// CREATE TABLE public.stock_batches (
+//     id                   BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     product_id           BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+//     quantity             NUMERIC NOT NULL CHECK (quantity > 0),
+//     expires_at           TIMESTAMPTZ NOT NULL,
+//     written_off_at       TIMESTAMPTZ,
+//     written_off_quantity NUMERIC NOT NULL DEFAULT 0,
+//     created_at           TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX idx_stock_batches_open ON public.stock_batches (product_id, expires_at) WHERE written_off_at IS NULL;
+//
+// ALTER TABLE public.stock_batches
+//     ADD COLUMN received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+//     ADD COLUMN cost_price  BIGINT NOT NULL DEFAULT 0,
+//     ADD COLUMN remaining   NUMERIC NOT NULL DEFAULT 0 CHECK (remaining >= 0);
+// -- Open batches start with what was left of them when earliest expiring units sold first
+// UPDATE public.stock_batches b
+// SET received_at = b.created_at,
+//     remaining = GREATEST(0, LEAST(b.quantity, p.quantity - COALESCE((
+//         SELECT SUM(l.quantity) FROM public.stock_batches l
+//         WHERE l.product_id = b.product_id AND l.written_off_at IS NULL
+//           AND (l.expires_at, l.id) > (b.expires_at, b.id)), 0)))
+// FROM public.products p
+// WHERE p.id = b.product_id AND b.written_off_at IS NULL;
+//
+// CREATE TABLE public.stock_reservation_batches (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     reservation_id  BIGINT NOT NULL REFERENCES stock_reservations(id) ON DELETE CASCADE,
+//     batch_id        BIGINT NOT NULL REFERENCES stock_batches(id),
+//     quantity        NUMERIC NOT NULL
+// );
+// CREATE INDEX idx_stock_reservation_batches_reservation ON public.stock_reservation_batches (reservation_id);
+//
+// CREATE TABLE public.inventory_movements (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     product_id      BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+//     quantity        NUMERIC NOT NULL,
+//     reason          TEXT NOT NULL,
+//     actor           TEXT NOT NULL,
+//     order_id        BIGINT REFERENCES orders(id),
+//     batch_id        BIGINT REFERENCES stock_batches(id),
+//     note            TEXT,
+//     created_at      TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX idx_inventory_movements_product ON public.inventory_movements (product_id, created_at DESC);
+// -- Opening balance, so every product's movements add up to its quantity
+// INSERT INTO public.inventory_movements (product_id, quantity, reason, actor, note)
+// SELECT id, quantity, 'CORRECTION', 'system', 'opening balance' FROM public.products WHERE quantity <> 0;
+
+// StockBatch is one delivery of a product. Quantity is what was received,
+// Remaining is what is still on sale; products.quantity counts Remaining of
+// every open batch plus any stock that predates batches. A batch is closed
+// once it expires and its Remaining is written off.
+type StockBatch struct {
+	ID                 uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID          uint64     `gorm:"column:product_id;not null" json:"product_id"`
+	Quantity           float64    `gorm:"column:quantity;type:numeric" json:"quantity"`
+	Remaining          float64    `gorm:"column:remaining;type:numeric" json:"remaining"`
+	CostPrice          Money      `gorm:"column:cost_price;type:bigint" json:"cost_price"`
+	ReceivedAt         time.Time  `gorm:"column:received_at" json:"received_at"`
+	ExpiresAt          time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	WrittenOffAt       *time.Time `gorm:"column:written_off_at" json:"written_off_at,omitempty"`
+	WrittenOffQuantity float64    `gorm:"column:written_off_quantity;type:numeric" json:"written_off_quantity"`
+	CreatedAt          time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (StockBatch) TableName() string {
+	return "stock_batches"
+}
+
+// DaysLeft is the number of started days until the batch expires, zero or
+// less once it has
+func (b StockBatch) DaysLeft(at time.Time) int {
+	left := b.ExpiresAt.Sub(at)
+	if left <= 0 {
+		return 0
+	}
+
+	return int((left + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+func (b StockBatch) IsExpired(at time.Time) bool {
+	return !at.Before(b.ExpiresAt)
+}
+
+// RemainingCost is what the units still in the batch cost to buy
+func (b StockBatch) RemainingCost() Money {
+	return NewMoney(int64(math.Round(float64(b.CostPrice.Minor()) * b.Remaining)))
+}
+
+// StockAllocation is the part of a reservation taken from one batch. Units
+// taken from stock that predates batches have no allocation.
+type StockAllocation struct {
+	ID            uint64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReservationID int     `gorm:"column:reservation_id;not null" json:"reservation_id"`
+	BatchID       uint64  `gorm:"column:batch_id;not null" json:"batch_id"`
+	Quantity      float64 `gorm:"column:quantity;type:numeric" json:"quantity"`
+}
+
+func (StockAllocation) TableName() string {
+	return "stock_reservation_batches"
+}
+
+// BatchAdjustment corrects a batch's details, nil fields are left as they
+// are. Its stock changes through a StockAdjustment.
+type BatchAdjustment struct {
+	ExpiresAt *time.Time
+	CostPrice *Money
+}
+
+type MovementReason string
+
+const (
+	// MovementReasonSale is stock reserved for an order, released again by MovementReasonRelease
+	MovementReasonSale       MovementReason = "SALE"
+	MovementReasonRelease    MovementReason = "RELEASE"
+	MovementReasonRestock    MovementReason = "RESTOCK"
+	MovementReasonWriteOff   MovementReason = "WRITE_OFF"
+	MovementReasonReturn     MovementReason = "RETURN"
+	MovementReasonCorrection MovementReason = "CORRECTION"
+)
+
+// IsManual reports whether an admin may record the reason through a stock
+// adjustment, sales and releases only come from orders
+func (r MovementReason) IsManual() bool {
+	switch r {
+	case MovementReasonRestock, MovementReasonWriteOff, MovementReasonReturn, MovementReasonCorrection:
+		return true
+	}
+
+	return false
+}
+
+// InventoryMovement is one change to a product's stock on sale. Quantity is
+// negative for stock leaving sale. A product's movements add up to its
+// quantity.
+type InventoryMovement struct {
+	ID        uint64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID uint64         `gorm:"column:product_id;not null" json:"product_id"`
+	Quantity  float64        `gorm:"column:quantity;type:numeric" json:"quantity"`
+	Reason    MovementReason `gorm:"column:reason;type:text" json:"reason"`
+	Actor     string         `gorm:"column:actor;type:text" json:"actor"`
+	OrderID   *int           `gorm:"column:order_id" json:"order_id,omitempty"`
+	BatchID   *uint64        `gorm:"column:batch_id" json:"batch_id,omitempty"`
+	Note      string         `gorm:"column:note;type:text" json:"note,omitempty"`
+	CreatedAt time.Time      `gorm:"column:created_at" json:"created_at"`
+}
+
+func (InventoryMovement) TableName() string {
+	return "inventory_movements"
+}
+
+// StockAdjustment is a manual change to a product's stock. Added stock goes
+// to BatchID when set and outside batches otherwise; removed stock comes from
+// BatchID when set and first-expiry-first-out otherwise.
+type StockAdjustment struct {
+	ProductID uint64
+	BatchID   *uint64
+	Quantity  float64
+	Reason    MovementReason
+	Note      string
+}
+
+// ExpiringStock is what is left of a product in batches expiring soon
+type ExpiringStock struct {
+	ProductID   uint64       `json:"product_id"`
+	ProductName string       `json:"product_name"`
+	Quantity    float64      `json:"quantity"`
+	CostValue   Money        `json:"cost_value"`
+	Batches     []StockBatch `json:"batches"`
+}
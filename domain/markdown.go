@@ -0,0 +1,68 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.markdown_rules (
+//     id               BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     days_left        INT NOT NULL CHECK (days_left >= 0),
+//     discount_percent NUMERIC NOT NULL CHECK (discount_percent > 0 AND discount_percent <= 100),
+//     product_category TEXT,
+//     created_at       TIMESTAMPTZ DEFAULT NOW()
+// );
+//
+// ALTER TABLE public.products ADD COLUMN markdown_rule_id BIGINT REFERENCES markdown_rules(id) ON DELETE SET NULL;
+
+// MarkdownRule takes DiscountPercent off products whose earliest batch has
+// DaysLeft days or fewer to go. A rule with a ProductCategory only covers
+// that category. When several rules match, the biggest discount wins, so
+// "30% at 2 days, 60% at 1 day" is two rules.
+type MarkdownRule struct {
+	ID              uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	DaysLeft        int       `gorm:"column:days_left" json:"days_left"`
+	DiscountPercent float64   `gorm:"column:discount_percent;type:numeric" json:"discount_percent"`
+	ProductCategory string    `gorm:"column:product_category;type:text" json:"product_category,omitempty"`
+	CreatedAt       time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (MarkdownRule) TableName() string {
+	return "markdown_rules"
+}
+
+func (r MarkdownRule) AppliesTo(product Product, daysLeft int) bool {
+	if r.ProductCategory != "" && r.ProductCategory != product.ProductCategory {
+		return false
+	}
+
+	return daysLeft <= r.DaysLeft
+}
+
+type MarkdownAction string
+
+const (
+	// MarkdownActionApply puts the product on green tag at the rule's discount
+	MarkdownActionApply MarkdownAction = "MARKDOWN"
+	// MarkdownActionClear takes a markdown set by an earlier run off again
+	MarkdownActionClear MarkdownAction = "CLEAR"
+	// MarkdownActionKeep leaves the price alone, expired batches may still be written off
+	MarkdownActionKeep MarkdownAction = "KEEP"
+)
+
+type BatchWriteOff struct {
+	BatchID   uint64    `json:"batch_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Quantity  float64   `json:"quantity"`
+}
+
+// MarkdownOutcome is what a markdown run does to one product
+type MarkdownOutcome struct {
+	ProductID   uint64          `json:"product_id"`
+	ProductName string          `json:"product_name"`
+	Action      MarkdownAction  `json:"action"`
+	RuleID      *uint64         `json:"rule_id,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+	DaysLeft    *int            `json:"days_left,omitempty"`
+	IsGreenTag  bool            `json:"is_green_tag"`
+	SalePrice   Money           `json:"sale_price"`
+	Discount    float64         `json:"discount"`
+	WriteOffs   []BatchWriteOff `json:"write_offs,omitempty"`
+}
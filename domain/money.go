@@ -0,0 +1,244 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of every amount the store keeps, amounts are
+// stored and sent without one
+const DefaultCurrency = "IDR"
+
+// minorPerMajor is how many minor units make one major unit, 100 sen to a rupiah
+const minorPerMajor = 100
+
+// Migrating the NUMERIC money columns to integer minor units:
+//
+// ALTER TABLE public.users ALTER COLUMN wallet TYPE BIGINT USING ROUND(wallet * 100);
+// ALTER TABLE public.products
+//     ALTER COLUMN normal_price TYPE BIGINT USING ROUND(normal_price * 100),
+//     ALTER COLUMN sale_price   TYPE BIGINT USING ROUND(sale_price * 100);
+// ALTER TABLE public.orders ALTER COLUMN total_amount TYPE BIGINT USING ROUND(total_amount * 100);
+// ALTER TABLE public.order_items
+//     ALTER COLUMN price_each TYPE BIGINT USING ROUND(price_each * 100),
+//     ALTER COLUMN subtotal   TYPE BIGINT USING ROUND(subtotal * 100);
+// ALTER TABLE public.payments
+//     ALTER COLUMN amount         TYPE BIGINT USING ROUND(amount * 100),
+//     ALTER COLUMN wallet_amount  TYPE BIGINT USING ROUND(wallet_amount * 100),
+//     ALTER COLUMN gateway_amount TYPE BIGINT USING ROUND(gateway_amount * 100);
+// ALTER TABLE public.wallet_ledger
+//     ALTER COLUMN amount        TYPE BIGINT USING ROUND(amount * 100),
+//     ALTER COLUMN balance_after TYPE BIGINT USING ROUND(balance_after * 100);
+// ALTER TABLE public.withdrawals ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100);
+
+// Money is an amount of rupiah in integer minor units, the store only deals in
+// DefaultCurrency. It is stored as a BIGINT of minor units and written to JSON
+// as a number of major units, so API amounts keep their shape: 15000.5 rupiah
+// is 1500050 minor units and marshals to 15000.50.
+//
+// Taking another currency means storing and sending it with every amount
+// first, Money does not carry one.
+type Money struct {
+	minor int64
+}
+
+// NewMoney returns minor units of rupiah
+func NewMoney(minor int64) Money {
+	return Money{minor: minor}
+}
+
+// IDR returns a whole number of rupiah
+func IDR(rupiah int64) Money {
+	return Money{minor: rupiah * minorPerMajor}
+}
+
+// ParseMoney reads a decimal amount of major units such as "15000.50". It
+// fails on amounts finer than one minor unit instead of rounding them.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	amount, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	amount.Mul(amount, big.NewRat(minorPerMajor, 1))
+	if !amount.IsInt() {
+		return Money{}, fmt.Errorf("amount %q has more than 2 decimal places", s)
+	}
+	if !amount.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q is too large", s)
+	}
+
+	return Money{minor: amount.Num().Int64()}, nil
+}
+
+// Minor is the amount in minor units
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{minor: m.minor + other.minor}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{minor: m.minor - other.minor}
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{minor: m.minor * quantity}
+}
+
+// Percent returns percent of the amount, rounded to the nearest minor unit
+func (m Money) Percent(percent float64) Money {
+	return Money{minor: int64(math.Round(float64(m.minor) * percent / 100))}
+}
+
+func (m Money) Neg() Money {
+	return Money{minor: -m.minor}
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than other
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m.minor < other.minor:
+		return -1
+	case m.minor > other.minor:
+		return 1
+	}
+
+	return 0
+}
+
+func (m Money) LessThan(other Money) bool {
+	return m.Cmp(other) < 0
+}
+
+func (m Money) GreaterThan(other Money) bool {
+	return m.Cmp(other) > 0
+}
+
+// Min returns the smaller of m and other
+func (m Money) Min(other Money) Money {
+	if other.LessThan(m) {
+		return other
+	}
+
+	return m
+}
+
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+// IsWhole reports whether the amount has no minor units, gateways that only
+// take whole rupiah need this
+func (m Money) IsWhole() bool {
+	return m.minor%minorPerMajor == 0
+}
+
+// Round rounds to whole major units, halves away from zero
+func (m Money) Round() Money {
+	rest := m.minor % minorPerMajor
+	minor := m.minor - rest
+	if rest >= minorPerMajor/2 {
+		minor += minorPerMajor
+	} else if rest <= -minorPerMajor/2 {
+		minor -= minorPerMajor
+	}
+
+	return Money{minor: minor}
+}
+
+// Decimal formats the amount in major units, whole amounts without decimals
+func (m Money) Decimal() string {
+	sign := ""
+	minor := m.minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	major := strconv.FormatInt(minor/minorPerMajor, 10)
+	if minor%minorPerMajor == 0 {
+		return sign + major
+	}
+
+	return fmt.Sprintf("%s%s.%02d", sign, major, minor%minorPerMajor)
+}
+
+func (m Money) String() string {
+	return DefaultCurrency + " " + m.Decimal()
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON takes a number or a string of major units
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		return nil
+	}
+
+	var quoted string
+	if err := json.Unmarshal(data, &quoted); err == nil {
+		raw = quoted
+	}
+
+	parsed, err := ParseMoney(raw)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+
+	return nil
+}
+
+// Value stores the amount as minor units
+func (m Money) Value() (driver.Value, error) {
+	return m.minor, nil
+}
+
+// Scan reads minor units
+func (m *Money) Scan(value interface{}) error {
+	var minor int64
+	switch v := value.(type) {
+	case nil:
+	case int64:
+		minor = v
+	case []byte:
+		parsed, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("scan money: %w", err)
+		}
+		minor = parsed
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("scan money: %w", err)
+		}
+		minor = parsed
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", value)
+	}
+
+	*m = Money{minor: minor}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{name: "whole", in: "15000", want: 1500000},
+		{name: "two decimals", in: "15000.50", want: 1500050},
+		{name: "one decimal", in: "0.5", want: 50},
+		{name: "surrounding spaces", in: " 12 ", want: 1200},
+		{name: "negative", in: "-3.25", want: -325},
+		{name: "finer than sen", in: "1.005", wantErr: true},
+		{name: "not a number", in: "abc", wantErr: true},
+		{name: "empty", in: "", wantErr: true},
+		{name: "too large", in: "100000000000000000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error: %v", tt.in, err)
+			}
+			if got.Minor() != tt.want {
+				t.Errorf("ParseMoney(%q) = %d minor units, want %d", tt.in, got.Minor(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want int64
+	}{
+		{name: "add", got: IDR(10).Add(NewMoney(50)), want: 1050},
+		{name: "sub below zero", got: IDR(1).Sub(IDR(3)), want: -200},
+		{name: "mul", got: NewMoney(1250).Mul(3), want: 3750},
+		{name: "percent rounds to sen", got: NewMoney(999).Percent(10), want: 100},
+		{name: "neg", got: IDR(5).Neg(), want: -500},
+		{name: "min", got: IDR(7).Min(IDR(3)), want: 300},
+		{name: "zero value adds as default currency", got: Money{}.Add(IDR(2)), want: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.Minor() != tt.want {
+				t.Errorf("got %d minor units, want %d", tt.got.Minor(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want int64
+	}{
+		{in: 1049, want: 1000},
+		{in: 1050, want: 1100},
+		{in: 1099, want: 1100},
+		{in: 1000, want: 1000},
+		{in: -1049, want: -1000},
+		{in: -1050, want: -1100},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.in).Round().Minor(); got != tt.want {
+			t.Errorf("NewMoney(%d).Round() = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyCmp(t *testing.T) {
+	tests := []struct {
+		a, b Money
+		want int
+	}{
+		{a: IDR(1), b: IDR(2), want: -1},
+		{a: IDR(2), b: IDR(1), want: 1},
+		{a: IDR(2), b: NewMoney(200), want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Cmp(tt.b); got != tt.want {
+			t.Errorf("%s.Cmp(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		in      Money
+		decimal string
+		str     string
+	}{
+		{in: IDR(15000), decimal: "15000", str: "IDR 15000"},
+		{in: NewMoney(1500050), decimal: "15000.50", str: "IDR 15000.50"},
+		{in: NewMoney(-5), decimal: "-0.05", str: "IDR -0.05"},
+		{in: Money{}, decimal: "0", str: "IDR 0"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.Decimal(); got != tt.decimal {
+			t.Errorf("Decimal() = %q, want %q", got, tt.decimal)
+		}
+		if got := tt.in.String(); got != tt.str {
+			t.Errorf("String() = %q, want %q", got, tt.str)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int64
+	}{
+		{name: "number", in: `15000.5`, want: 1500050},
+		{name: "string", in: `"250"`, want: 25000},
+		{name: "null", in: `null`, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			if err := json.Unmarshal([]byte(tt.in), &m); err != nil {
+				t.Fatalf("Unmarshal(%s) error: %v", tt.in, err)
+			}
+			if m.Minor() != tt.want {
+				t.Errorf("Unmarshal(%s) = %d minor units, want %d", tt.in, m.Minor(), tt.want)
+			}
+		})
+	}
+
+	out, err := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{Amount: NewMoney(1500050)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":15000.50}` {
+		t.Errorf("Marshal = %s", out)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		in      interface{}
+		want    int64
+		wantErr bool
+	}{
+		{in: int64(1234), want: 1234},
+		{in: []byte("99"), want: 99},
+		{in: "7", want: 7},
+		{in: nil, want: 0},
+		{in: 1.5, wantErr: true},
+		{in: "1.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		err := m.Scan(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Scan(%v) did not fail", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Scan(%v) error: %v", tt.in, err)
+			continue
+		}
+		if m.Minor() != tt.want {
+			t.Errorf("Scan(%v) = %s (%d minor), want %d minor", tt.in, m, m.Minor(), tt.want)
+		}
+	}
+}
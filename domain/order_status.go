@@ -0,0 +1,88 @@
+package domain
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderStatusPending         OrderStatus = "PENDING"
+	OrderStatusAwaitingPayment OrderStatus = "AWAITING_PAYMENT"
+	OrderStatusPaid            OrderStatus = "PAID"
+	OrderStatusPacked          OrderStatus = "PACKED"
+	OrderStatusReadyForPickup  OrderStatus = "READY_FOR_PICKUP"
+	OrderStatusShipped         OrderStatus = "SHIPPED"
+	OrderStatusCompleted       OrderStatus = "COMPLETED"
+	OrderStatusCancelled       OrderStatus = "CANCELLED"
+	OrderStatusExpired         OrderStatus = "EXPIRED"
+	OrderStatusRefunded        OrderStatus = "REFUNDED"
+	// OrderStatusPartiallyRefunded orders still go through fulfilment for the lines not refunded
+	OrderStatusPartiallyRefunded OrderStatus = "PARTIALLY_REFUNDED"
+)
+
+// orderTransitions lists every status an order may move to from a given status.
+// Statuses without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:         {OrderStatusAwaitingPayment, OrderStatusPaid, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusAwaitingPayment: {OrderStatusPaid, OrderStatusPending, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusPaid:            {OrderStatusPacked, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusPacked:          {OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusReadyForPickup:  {OrderStatusCompleted, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusShipped:         {OrderStatusCompleted, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusCompleted:       {OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusPartiallyRefunded: {
+		OrderStatusPartiallyRefunded, OrderStatusRefunded,
+		OrderStatusPacked, OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusCompleted,
+	},
+}
+
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusAwaitingPayment, OrderStatusPaid, OrderStatusPacked,
+		OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusCompleted,
+		OrderStatusCancelled, OrderStatusExpired, OrderStatusRefunded, OrderStatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+// IsFulfilment reports whether s is a step of packing and handing over a paid order
+func (s OrderStatus) IsFulfilment() bool {
+	switch s {
+	case OrderStatusPacked, OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusCompleted:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CREATE TABLE public.order_status_history (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     order_id        BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+//     from_status     TEXT,
+//     to_status       TEXT NOT NULL,
+//     actor           TEXT NOT NULL,
+//     reason          TEXT,
+//     created_at      TIMESTAMPTZ DEFAULT NOW()
+// );
+
+type OrderStatusHistory struct {
+	ID         int         `json:"id"`
+	OrderID    int         `json:"order_id"`
+	FromStatus OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus `json:"to_status"`
+	Actor      string      `json:"actor"`
+	Reason     string      `json:"reason"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
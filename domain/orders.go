@@ -2,15 +2,55 @@ package domain
 
 import "time"
 
+// CREATE TABLE public.order_items (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     order_id        BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+//     product_id      BIGINT NOT NULL,
+//     product_name    TEXT,
+//     quantity        INT NOT NULL,
+//     price_each      NUMERIC NOT NULL,
+//     subtotal        NUMERIC NOT NULL
+// );
+//
+// ALTER TABLE public.orders ADD COLUMN total_amount NUMERIC NOT NULL DEFAULT 0;
+// -- Every existing order becomes a single line order before its line columns go
+// INSERT INTO public.order_items (order_id, product_id, product_name, quantity, price_each, subtotal)
+// SELECT o.id, o.product_id, p.product_name, o.quantity, o.price_each, o.subtotal
+// FROM public.orders o LEFT JOIN public.products p ON p.id = o.product_id
+// WHERE o.product_id IS NOT NULL;
+// UPDATE public.orders SET total_amount = subtotal WHERE subtotal IS NOT NULL;
+// ALTER TABLE public.orders
+//     DROP COLUMN product_id,
+//     DROP COLUMN quantity,
+//     DROP COLUMN price_each,
+//     DROP COLUMN subtotal;
+// ALTER TABLE public.order_items ADD COLUMN refunded_quantity INT NOT NULL DEFAULT 0;
+
 type Orders struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	ProductID     int       `json:"product_id"`
-	Quantity      int       `json:"quantity"`
-	PriceEach     float64   `json:"price_each"`
-	Subtotal      float64   `json:"subtotal"`
-	OrderStatus   string    `json:"order_status"`
-	PaymentMethod string    `json:"payment_method"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            int         `json:"id"`
+	UserID        int         `json:"user_id"`
+	TotalAmount   Money       `json:"total_amount"`
+	OrderStatus   OrderStatus `json:"order_status"`
+	PaymentMethod string      `json:"payment_method"`
+	Items         []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+type OrderItem struct {
+	ID          int    `json:"id"`
+	OrderID     int    `json:"order_id"`
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	PriceEach   Money  `json:"price_each"`
+	Subtotal    Money  `json:"subtotal"`
+	// ListPrice, Discount and PriceSource snapshot how PriceEach was reached
+	// when the order was placed, see PriceBreakdown
+	ListPrice   Money       `json:"list_price"`
+	Discount    Money       `json:"discount"`
+	PriceSource PriceSource `json:"price_source"`
+	PromotionID *uint64     `json:"promotion_id,omitempty"`
+	// RefundedQuantity is how much of Quantity has been refunded so far
+	RefundedQuantity int `json:"refunded_quantity"`
 }
@@ -2,15 +2,45 @@ package domain
 
 import "time"
 
+// ALTER TABLE public.payments ADD COLUMN amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+// ALTER TABLE public.payments
+//     ADD COLUMN gateway           TEXT,
+//     ADD COLUMN invoice_id        TEXT,
+//     ADD COLUMN invoice_url       TEXT,
+//     ADD COLUMN invoice_expires_at TIMESTAMPTZ;
+// CREATE INDEX idx_payments_invoice_id ON public.payments (invoice_id);
+// ALTER TABLE public.payments ADD COLUMN parent_payment_id BIGINT REFERENCES payments(id);
+// ALTER TABLE public.payments
+//     ADD COLUMN wallet_amount  NUMERIC(12,2) NOT NULL DEFAULT 0,
+//     ADD COLUMN gateway_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+// ALTER TABLE public.payments ADD COLUMN refund JSONB;
+// -- An order has at most one open invoice
+// CREATE UNIQUE INDEX idx_payments_order_pending ON public.payments (order_id)
+//     WHERE payment_status = 'PENDING' AND payment_type = 'ORDER';
+
 type (
 	Payments struct {
-		ID            int       `json:"id"`
-		UserID        int       `json:"user_id"`
-		OrderID       *int      `json:"order_id"`
-		PaymentType   string    `json:"payment_type"`
-		PaymentStatus string    `json:"payment_status"`
-		PaymentMethod string    `json:"payment_method"`
-		CreatedAt     time.Time `json:"created_at"`
+		ID            int    `json:"id"`
+		UserID        int    `json:"user_id"`
+		OrderID       *int   `json:"order_id"`
+		PaymentType   string `json:"payment_type"`
+		PaymentStatus string `json:"payment_status"`
+		PaymentMethod string `json:"payment_method"`
+		Amount        Money  `json:"amount"`
+		// Gateway and the invoice fields are set once the gateway has opened an invoice
+		Gateway          string     `json:"gateway,omitempty"`
+		InvoiceID        string     `json:"invoice_id,omitempty"`
+		InvoiceURL       string     `json:"invoice_url,omitempty"`
+		InvoiceExpiresAt *time.Time `json:"invoice_expires_at,omitempty"`
+		// WalletAmount and GatewayAmount are the two legs of a SPLIT payment
+		WalletAmount  Money `json:"wallet_amount,omitempty"`
+		GatewayAmount Money `json:"gateway_amount,omitempty"`
+		// ParentPaymentID links a REFUND payment to the payment it gives money back from
+		ParentPaymentID *int `json:"parent_payment_id,omitempty"`
+		// Refund is what a REFUND payment gives back, it is booked on the
+		// order once the money has been returned
+		Refund    *RefundDetails `gorm:"column:refund;serializer:json" json:"refund,omitempty"`
+		CreatedAt time.Time      `json:"created_at"`
 	}
 
 	PaymentWithLink struct {
@@ -20,13 +50,86 @@ type (
 		PaymentStatus string    `json:"payment_status"`
 		PaymentMethod string    `json:"payment_method"`
 		PaymentLink   string    `json:"payment_link"`
+		Instructions  string    `json:"instructions,omitempty"`
+		WalletAmount  Money     `json:"wallet_amount,omitempty"`
+		GatewayAmount Money     `json:"gateway_amount,omitempty"`
 		CreatedAt     time.Time `json:"created_at"`
 	}
 
 	TopUp struct {
-		ID        int     `json:"id"`
-		UserID    uint    `json:"user_id"`
-		Amount    float64 `json:"amount"`
-		TopUpLink string  `json:"top_up_link"`
+		ID        int    `json:"id"`
+		UserID    uint   `json:"user_id"`
+		Amount    Money  `json:"amount"`
+		TopUpLink string `json:"top_up_link"`
+		// Instructions is set instead of TopUpLink by gateways without a payment page
+		Instructions string `json:"instructions,omitempty"`
 	}
 )
+
+// InvoiceRequest is what the payments service asks a payment gateway for
+type InvoiceRequest struct {
+	ExternalID  string
+	PayerEmail  string
+	Description string
+	Amount      Money
+	Duration    time.Duration
+	Items       []Item
+}
+
+// Invoice is a gateway invoice in the shape the payments service works with.
+// Gateways without a hosted payment page leave InvoiceURL empty and tell the
+// customer how to pay in Instructions.
+type Invoice struct {
+	ID            string    `json:"id"`
+	ExternalID    string    `json:"external_id"`
+	Status        string    `json:"status"`
+	Amount        Money     `json:"amount"`
+	PaymentMethod string    `json:"payment_method"`
+	InvoiceURL    string    `json:"invoice_url"`
+	Instructions  string    `json:"instructions"`
+	ExpiryDate    time.Time `json:"expiry_date"`
+}
+
+type RefundRequest struct {
+	InvoiceID   string
+	ReferenceID string
+	Amount      Money
+	Reason      string
+}
+
+type Refund struct {
+	ID          string `json:"id"`
+	InvoiceID   string `json:"invoice_id"`
+	ReferenceID string `json:"reference_id"`
+	Status      string `json:"status"`
+	Amount      Money  `json:"amount"`
+}
+
+// RefundLine refunds Quantity units of one product on the order
+type RefundLine struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// RefundDetails is kept on a REFUND payment until it is settled. Lines are
+// the quantities refunded per product.
+type RefundDetails struct {
+	Lines   []RefundLine `json:"lines"`
+	Restock bool         `json:"restock"`
+	Reason  string       `json:"reason,omitempty"`
+	Actor   string       `json:"actor"`
+}
+
+// OrderRefund asks for money back on a paid order. No Lines refunds
+// everything not refunded yet. ToWallet credits the customer's wallet, else
+// the money goes back the way it was paid. Restock returns the refunded
+// quantity to products.quantity.
+type OrderRefund struct {
+	OrderID  int
+	UserID   int
+	Actor    string
+	Lines    []RefundLine
+	ToWallet bool
+	Restock  bool
+	Reason   string
+}
@@ -0,0 +1,94 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.promotions (
+//     id               BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     name             TEXT NOT NULL,
+//     product_id       BIGINT REFERENCES products(id),
+//     product_category TEXT,
+//     discount_percent NUMERIC NOT NULL CHECK (discount_percent > 0 AND discount_percent <= 100),
+//     starts_at        TIMESTAMPTZ NOT NULL,
+//     ends_at          TIMESTAMPTZ,
+//     created_at       TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX promotions_active_idx ON public.promotions (starts_at, ends_at);
+//
+// ALTER TABLE public.order_items
+//     ADD COLUMN list_price   BIGINT NOT NULL DEFAULT 0,
+//     ADD COLUMN discount     BIGINT NOT NULL DEFAULT 0,
+//     ADD COLUMN price_source TEXT NOT NULL DEFAULT 'LIST',
+//     ADD COLUMN promotion_id BIGINT;
+// UPDATE public.order_items SET list_price = price_each WHERE list_price = 0;
+
+type PriceSource string
+
+const (
+	PriceSourceList      PriceSource = "LIST"
+	PriceSourceSalePrice PriceSource = "SALE_PRICE"
+	PriceSourceDiscount  PriceSource = "DISCOUNT"
+	PriceSourcePromotion PriceSource = "PROMOTION"
+)
+
+// Promotion takes DiscountPercent off the list price while it runs. It
+// applies to one product when ProductID is set, to a whole category when
+// ProductCategory is set and to every product when neither is. A nil EndsAt
+// runs until the promotion is deleted.
+type Promotion struct {
+	ID              uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name            string     `gorm:"column:name;type:text" json:"name"`
+	ProductID       *uint64    `gorm:"column:product_id" json:"product_id,omitempty"`
+	ProductCategory string     `gorm:"column:product_category;type:text" json:"product_category,omitempty"`
+	DiscountPercent float64    `gorm:"column:discount_percent;type:numeric" json:"discount_percent"`
+	StartsAt        time.Time  `gorm:"column:starts_at" json:"starts_at"`
+	EndsAt          *time.Time `gorm:"column:ends_at" json:"ends_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (Promotion) TableName() string {
+	return "promotions"
+}
+
+// AppliesTo reports whether the promotion covers the product
+func (p Promotion) AppliesTo(product Product) bool {
+	switch {
+	case p.ProductID != nil:
+		return *p.ProductID == product.ID
+	case p.ProductCategory != "":
+		return p.ProductCategory == product.ProductCategory
+	}
+
+	return true
+}
+
+// IsActive reports whether the promotion runs at the given time
+func (p Promotion) IsActive(at time.Time) bool {
+	return !at.Before(p.StartsAt) && (p.EndsAt == nil || at.Before(*p.EndsAt))
+}
+
+// PriceBreakdown is how a product's unit price was reached. UnitPrice is
+// ListPrice less Discount, Source says which rule gave the discount.
+type PriceBreakdown struct {
+	ProductID   uint64      `json:"product_id"`
+	ListPrice   Money       `json:"list_price"`
+	Discount    Money       `json:"discount"`
+	UnitPrice   Money       `json:"unit_price"`
+	Source      PriceSource `json:"source"`
+	PromotionID *uint64     `json:"promotion_id,omitempty"`
+}
+
+type PriceQuoteLine struct {
+	PriceBreakdown
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Subtotal    Money  `json:"subtotal"`
+}
+
+// PriceQuote prices a set of lines without reserving anything, Total is what
+// checking them out would cost right now
+type PriceQuote struct {
+	Lines         []PriceQuoteLine `json:"lines"`
+	ListTotal     Money            `json:"list_total"`
+	DiscountTotal Money            `json:"discount_total"`
+	Total         Money            `json:"total"`
+}
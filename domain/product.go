@@ -19,6 +19,9 @@ import (
 //     created_at      TIMESTAMPTZ DEFAULT NOW()
 // );
 
+// Product is a product on sale. Its ProductCategory is the name of the
+// category CategoryID points at, kept in step with it for the rules and
+// promotions that match on it.
 type Product struct {
 	ID              uint64    `gorm:"primaryKey;autoIncrement"`
 	ProductID       uint64    `gorm:"column:product_id"`
@@ -26,12 +29,20 @@ type Product struct {
 	IsGreenTag      bool      `gorm:"column:is_green_tag;default:false"`
 	ProductName     string    `gorm:"column:product_name;type:text"`
 	ProductCategory string    `gorm:"column:product_category;type:text"`
+	CategoryID      *uint64   `gorm:"column:category_id" json:",omitempty"`
 	Unit            string    `gorm:"column:unit;type:text"`
-	NormalPrice     float64   `gorm:"column:normal_price;type:numeric"`
-	SalePrice       float64   `gorm:"column:sale_price;type:numeric"`
+	NormalPrice     Money     `gorm:"column:normal_price;type:bigint"`
+	SalePrice       Money     `gorm:"column:sale_price;type:bigint"`
 	Discount        float64   `gorm:"column:discount;type:numeric"`
 	Quantity        float64   `gorm:"column:quantity;type:numeric"`
 	CreatedAt       time.Time `gorm:"column:created_at"`
+	// MarkdownRuleID is set while the markdown job has the product on green
+	// tag, so it knows to take the markdown off again
+	MarkdownRuleID *uint64      `gorm:"column:markdown_rule_id" json:",omitempty"`
+	Batches        []StockBatch `gorm:"foreignKey:ProductID" json:",omitempty"`
+	// ReorderThreshold raises a low-stock alert once Quantity drops to it,
+	// nil leaves the product out of low-stock alerts
+	ReorderThreshold *float64 `gorm:"column:reorder_threshold;type:numeric" json:",omitempty"`
 }
 
 // TODO: Apakah nambah fitur updated_at dan deleted_at
@@ -0,0 +1,60 @@
+package domain
+
+// ALTER TABLE public.products
+//     ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(product_name, ''))) STORED;
+// CREATE INDEX idx_products_search_vector ON public.products USING GIN (search_vector);
+// CREATE INDEX idx_products_category ON public.products (product_category);
+// CREATE INDEX idx_products_created_at ON public.products (created_at DESC, id DESC);
+
+type ProductSort string
+
+const (
+	ProductSortPriceAsc  ProductSort = "price_asc"
+	ProductSortPriceDesc ProductSort = "price_desc"
+	// ProductSortDiscount puts the biggest discount first
+	ProductSortDiscount ProductSort = "discount"
+	ProductSortNewest   ProductSort = "newest"
+	// ProductSortExpiry puts the product whose earliest batch expires soonest
+	// first, products without batches go last
+	ProductSortExpiry ProductSort = "expiry"
+)
+
+func (s ProductSort) IsValid() bool {
+	switch s {
+	case ProductSortPriceAsc, ProductSortPriceDesc, ProductSortDiscount, ProductSortNewest, ProductSortExpiry:
+		return true
+	}
+
+	return false
+}
+
+// ProductQuery narrows down and orders the product catalogue. Zero fields
+// don't filter. Price is what the product is on sale for, the sale price when
+// it has one and the normal price otherwise. Without a Sort, a Search orders
+// by relevance and no Search orders by newest. CategoryID takes in the
+// categories under it as well, Category matches the name only.
+type ProductQuery struct {
+	Search       string
+	Category     string
+	CategoryID   *uint64
+	GreenTagOnly bool
+	MinPrice     *Money
+	MaxPrice     *Money
+	MinDiscount  float64
+	InStockOnly  bool
+	Sort         ProductSort
+	Offset       int
+	Limit        int
+}
+
+// ProductPage is one page of a ProductQuery, Total counts every match
+type ProductPage struct {
+	Products []Product
+	Total    int64
+	Page     int
+	Limit    int
+}
+
+func (p ProductPage) HasNext() bool {
+	return int64(p.Page)*int64(p.Limit) < p.Total
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+const (
+	ReconcileActionPaid    = "PAID"
+	ReconcileActionExpired = "EXPIRED"
+	ReconcileActionPending = "STILL_PENDING"
+	ReconcileActionSkipped = "SKIPPED"
+	ReconcileActionFailed  = "FAILED"
+)
+
+// CREATE TABLE public.reconciliation_reports (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     triggered_by    TEXT NOT NULL,
+//     started_at      TIMESTAMPTZ NOT NULL,
+//     finished_at     TIMESTAMPTZ NOT NULL,
+//     checked         INT NOT NULL DEFAULT 0,
+//     paid            INT NOT NULL DEFAULT 0,
+//     expired         INT NOT NULL DEFAULT 0,
+//     still_pending   INT NOT NULL DEFAULT 0,
+//     skipped         INT NOT NULL DEFAULT 0,
+//     failed          INT NOT NULL DEFAULT 0,
+//     results         JSONB NOT NULL DEFAULT '[]'
+// );
+
+// ReconciliationReport is the outcome of one pass over stale PENDING
+// payments. Results holds one ReconciliationResult per payment, as JSON.
+type ReconciliationReport struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	TriggeredBy  string    `gorm:"column:triggered_by;not null" json:"triggered_by"`
+	StartedAt    time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt   time.Time `gorm:"column:finished_at" json:"finished_at"`
+	Checked      int       `gorm:"column:checked" json:"checked"`
+	Paid         int       `gorm:"column:paid" json:"paid"`
+	Expired      int       `gorm:"column:expired" json:"expired"`
+	StillPending int       `gorm:"column:still_pending" json:"still_pending"`
+	Skipped      int       `gorm:"column:skipped" json:"skipped"`
+	Failed       int       `gorm:"column:failed" json:"failed"`
+	Results      string    `gorm:"column:results;type:jsonb" json:"results"`
+}
+
+func (ReconciliationReport) TableName() string {
+	return "reconciliation_reports"
+}
+
+type ReconciliationResult struct {
+	PaymentID     int    `json:"payment_id"`
+	InvoiceID     string `json:"invoice_id"`
+	GatewayStatus string `json:"gateway_status"`
+	Action        string `json:"action"`
+	Error         string `json:"error,omitempty"`
+}
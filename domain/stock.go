@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+const (
+	ReservationStatusReserved  = "RESERVED"
+	ReservationStatusCommitted = "COMMITTED"
+	ReservationStatusReleased  = "RELEASED"
+)
+
+// CREATE TABLE public.stock_reservations (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     order_id        BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+//     product_id      BIGINT NOT NULL REFERENCES products(id),
+//     quantity        INT NOT NULL,
+//     status          TEXT NOT NULL DEFAULT 'RESERVED',
+//     created_at      TIMESTAMPTZ DEFAULT NOW(),
+//     updated_at      TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX idx_stock_reservations_order ON public.stock_reservations (order_id, status);
+
+// StockReservation holds quantity taken out of products.quantity for an order
+// until the order is paid (COMMITTED) or closed without payment (RELEASED).
+type StockReservation struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (StockReservation) TableName() string {
+	return "stock_reservations"
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// CREATE TABLE public.stock_subscriptions (
+//     id            BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     product_id    BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+//     user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+//     restocked_at  TIMESTAMPTZ,
+//     notified_at   TIMESTAMPTZ,
+//     created_at    TIMESTAMPTZ DEFAULT NOW()
+// );
+// -- One waiting subscription per customer and product, they may subscribe again once notified
+// CREATE UNIQUE INDEX idx_stock_subscriptions_open ON public.stock_subscriptions (product_id, user_id) WHERE notified_at IS NULL;
+// CREATE INDEX idx_stock_subscriptions_due ON public.stock_subscriptions (restocked_at) WHERE restocked_at IS NOT NULL AND notified_at IS NULL;
+
+// StockSubscription asks for a customer to be told when a sold out product
+// is back. RestockedAt is set when the product's stock goes from zero to
+// positive, NotifiedAt once the customer has been told, which ends the
+// subscription.
+type StockSubscription struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID   uint64     `gorm:"column:product_id;not null" json:"product_id"`
+	UserID      uint       `gorm:"column:user_id;not null" json:"user_id"`
+	RestockedAt *time.Time `gorm:"column:restocked_at" json:"restocked_at,omitempty"`
+	NotifiedAt  *time.Time `gorm:"column:notified_at" json:"notified_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at" json:"created_at"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	Product     Product    `gorm:"foreignKey:ProductID" json:"-"`
+}
+
+func (StockSubscription) TableName() string {
+	return "stock_subscriptions"
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// CREATE EXTENSION IF NOT EXISTS pg_trgm;
+// CREATE INDEX idx_products_name_trgm ON public.products USING GIN (product_name gin_trgm_ops);
+// CREATE INDEX idx_categories_name_trgm ON public.categories USING GIN (product_category gin_trgm_ops);
+//
+// CREATE TABLE public.search_misses (
+//     query         TEXT PRIMARY KEY,
+//     count         BIGINT NOT NULL DEFAULT 1,
+//     first_seen_at TIMESTAMPTZ DEFAULT NOW(),
+//     last_seen_at  TIMESTAMPTZ DEFAULT NOW()
+// );
+
+type SuggestionKind string
+
+const (
+	SuggestionKindProduct  SuggestionKind = "product"
+	SuggestionKindCategory SuggestionKind = "category"
+)
+
+// Suggestion is a product or category name that looks like what the customer
+// is typing. Score runs from 0 to 1, 1 for names starting with the query.
+// Highlighted is the name, HTML escaped, with the parts matching the query
+// in <mark> tags.
+type Suggestion struct {
+	Kind        SuggestionKind `json:"kind"`
+	ID          uint64         `json:"id"`
+	Text        string         `json:"text"`
+	Highlighted string         `json:"highlighted"`
+	Score       float64        `json:"score"`
+}
+
+// SearchMiss is a suggestion query that found nothing, kept for
+// merchandising to review
+type SearchMiss struct {
+	Query       string    `gorm:"column:query;primaryKey" json:"query"`
+	Count       int64     `gorm:"column:count" json:"count"`
+	FirstSeenAt time.Time `gorm:"column:first_seen_at" json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"column:last_seen_at" json:"last_seen_at"`
+}
+
+func (SearchMiss) TableName() string {
+	return "search_misses"
+}
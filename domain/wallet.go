@@ -0,0 +1,106 @@
+package domain
+
+import "time"
+
+const (
+	WalletDirectionCredit = "CREDIT"
+	WalletDirectionDebit  = "DEBIT"
+
+	WalletEntryTopUp        = "TOPUP"
+	WalletEntryOrderPayment = "ORDER_PAYMENT"
+	WalletEntryRefund       = "REFUND"
+	WalletEntryAdjustment   = "ADJUSTMENT"
+	// Split payments hold the wallet part until the gateway part is paid
+	WalletEntryHold        = "HOLD"
+	WalletEntryHoldRelease = "HOLD_RELEASE"
+	WalletEntryHoldCapture = "HOLD_CAPTURE"
+	// Withdrawals are debited up front and reversed if the payout fails
+	WalletEntryWithdrawal         = "WITHDRAWAL"
+	WalletEntryWithdrawalReversal = "WITHDRAWAL_REVERSAL"
+
+	// Contra accounts for the other side of every wallet movement
+	LedgerAccountGateway     = "system:gateway"
+	LedgerAccountSales       = "system:sales"
+	LedgerAccountRefunds     = "system:refunds"
+	LedgerAccountAdjustments = "system:adjustments"
+	LedgerAccountHolds       = "system:holds"
+	LedgerAccountPayouts     = "system:payouts"
+)
+
+// CREATE TABLE public.wallet_ledger (
+//     id              BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     transaction_id  TEXT NOT NULL,
+//     account         TEXT NOT NULL,
+//     user_id         BIGINT REFERENCES users(id),
+//     direction       TEXT NOT NULL CHECK (direction IN ('CREDIT', 'DEBIT')),
+//     entry_type      TEXT NOT NULL,
+//     amount          NUMERIC NOT NULL CHECK (amount > 0),
+//     balance_after   NUMERIC,
+//     reference       TEXT,
+//     description     TEXT,
+//     created_by      TEXT NOT NULL,
+//     created_at      TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX idx_wallet_ledger_account ON public.wallet_ledger (account, created_at DESC);
+// ALTER TABLE public.users ADD CONSTRAINT users_wallet_not_negative CHECK (wallet >= 0);
+//
+// Opening balances for wallets that existed before the ledger:
+// INSERT INTO public.wallet_ledger (transaction_id, account, user_id, direction, entry_type, amount, balance_after, description, created_by)
+// SELECT 'opening-' || id, 'user:' || id, id, 'CREDIT', 'ADJUSTMENT', wallet, wallet, 'opening balance', 'system'
+// FROM public.users WHERE wallet > 0;
+
+// WalletLedgerEntry is one immutable leg of a wallet transaction. Every
+// transaction writes two legs with the same TransactionID, one on the
+// customer's account and one on a system account, so the ledger always balances.
+type WalletLedgerEntry struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	TransactionID string    `gorm:"column:transaction_id;not null" json:"transaction_id"`
+	Account       string    `gorm:"column:account;not null" json:"account"`
+	UserID        *uint     `gorm:"column:user_id" json:"user_id,omitempty"`
+	Direction     string    `gorm:"column:direction;not null" json:"direction"`
+	EntryType     string    `gorm:"column:entry_type;not null" json:"entry_type"`
+	Amount        Money     `gorm:"column:amount;type:bigint;not null" json:"amount"`
+	BalanceAfter  *Money    `gorm:"column:balance_after;type:bigint" json:"balance_after,omitempty"`
+	Reference     string    `gorm:"column:reference" json:"reference"`
+	Description   string    `gorm:"column:description" json:"description"`
+	CreatedBy     string    `gorm:"column:created_by;not null" json:"created_by"`
+	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (WalletLedgerEntry) TableName() string {
+	return "wallet_ledger"
+}
+
+// WalletPosting describes a movement in or out of a customer's wallet.
+// Direction is seen from the customer's side: CREDIT adds to the balance.
+type WalletPosting struct {
+	UserID        uint
+	Direction     string
+	EntryType     string
+	Amount        Money
+	ContraAccount string
+	Reference     string
+	Description   string
+	CreatedBy     string
+}
+
+// LedgerTransfer moves money between two system accounts, without touching
+// any customer's balance
+type LedgerTransfer struct {
+	FromAccount string
+	ToAccount   string
+	EntryType   string
+	Amount      Money
+	Reference   string
+	Description string
+	CreatedBy   string
+}
+
+type WalletStatement struct {
+	UserID  uint                `json:"user_id"`
+	Balance Money               `json:"balance"`
+	Page    int                 `json:"page"`
+	Limit   int                 `json:"limit"`
+	Total   int64               `json:"total"`
+	Entries []WalletLedgerEntry `json:"entries"`
+}
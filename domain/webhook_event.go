@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+const (
+	WebhookEventReceived  = "RECEIVED"
+	WebhookEventProcessed = "PROCESSED"
+	WebhookEventFailed    = "FAILED"
+)
+
+// CREATE TABLE public.webhook_events (
+//     id                  BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     provider            TEXT NOT NULL,
+//     event_id            TEXT NOT NULL,
+//     event_status        TEXT NOT NULL,
+//     external_id         TEXT,
+//     payload             JSONB NOT NULL,
+//     processing_status   TEXT NOT NULL DEFAULT 'RECEIVED',
+//     attempts            INT NOT NULL DEFAULT 0,
+//     last_error          TEXT,
+//     received_at         TIMESTAMPTZ DEFAULT NOW(),
+//     processed_at        TIMESTAMPTZ,
+//     UNIQUE (provider, event_id, event_status)
+// );
+// CREATE INDEX idx_webhook_events_status ON public.webhook_events (processing_status, received_at);
+
+// WebhookEvent is the inbox row for one gateway callback. Xendit has no
+// separate event id, so a callback is identified by its invoice id together
+// with the invoice status it reports.
+type WebhookEvent struct {
+	ID               uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Provider         string     `gorm:"column:provider;not null" json:"provider"`
+	EventID          string     `gorm:"column:event_id;not null" json:"event_id"`
+	EventStatus      string     `gorm:"column:event_status;not null" json:"event_status"`
+	ExternalID       string     `gorm:"column:external_id" json:"external_id"`
+	Payload          string     `gorm:"column:payload;type:jsonb;not null" json:"payload"`
+	ProcessingStatus string     `gorm:"column:processing_status;not null" json:"processing_status"`
+	Attempts         int        `gorm:"column:attempts;not null" json:"attempts"`
+	LastError        string     `gorm:"column:last_error" json:"last_error"`
+	ReceivedAt       time.Time  `gorm:"column:received_at" json:"received_at"`
+	ProcessedAt      *time.Time `gorm:"column:processed_at" json:"processed_at"`
+}
+
+func (WebhookEvent) TableName() string {
+	return "webhook_events"
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// WithdrawalStatusRequested withdrawals are waiting for an admin when they are above the approval threshold
+	WithdrawalStatusRequested  = "REQUESTED"
+	WithdrawalStatusProcessing = "PROCESSING"
+	WithdrawalStatusCompleted  = "COMPLETED"
+	WithdrawalStatusFailed     = "FAILED"
+)
+
+// CREATE TABLE public.bank_accounts (
+//     id                  BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     user_id             BIGINT NOT NULL REFERENCES users(id),
+//     bank_code           TEXT NOT NULL,
+//     account_number      TEXT NOT NULL,
+//     account_holder_name TEXT NOT NULL,
+//     created_at          TIMESTAMPTZ DEFAULT NOW(),
+//     deleted_at          TIMESTAMPTZ
+// );
+// CREATE UNIQUE INDEX idx_bank_accounts_user_account ON public.bank_accounts (user_id, bank_code, account_number) WHERE deleted_at IS NULL;
+
+// BankAccount is an account in a user's bank account book, the only places
+// wallet money can be withdrawn to
+type BankAccount struct {
+	ID                uint64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID            uint           `gorm:"column:user_id;not null" json:"user_id"`
+	BankCode          string         `gorm:"column:bank_code;not null" json:"bank_code"`
+	AccountNumber     string         `gorm:"column:account_number;not null" json:"account_number"`
+	AccountHolderName string         `gorm:"column:account_holder_name;not null" json:"account_holder_name"`
+	CreatedAt         time.Time      `gorm:"column:created_at" json:"created_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`
+}
+
+func (BankAccount) TableName() string {
+	return "bank_accounts"
+}
+
+// CREATE TABLE public.withdrawals (
+//     id                  BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+//     user_id             BIGINT NOT NULL REFERENCES users(id),
+//     bank_account_id     BIGINT NOT NULL REFERENCES bank_accounts(id),
+//     amount              BIGINT NOT NULL CHECK (amount > 0),
+//     status              TEXT NOT NULL,
+//     gateway             TEXT,
+//     disbursement_id     TEXT,
+//     failure_reason      TEXT,
+//     approved_by         TEXT,
+//     created_at          TIMESTAMPTZ DEFAULT NOW(),
+//     updated_at          TIMESTAMPTZ DEFAULT NOW()
+// );
+// CREATE INDEX idx_withdrawals_status ON public.withdrawals (status, created_at);
+
+// Withdrawal moves wallet money to one of the user's bank accounts. The
+// wallet is debited when the withdrawal is requested and credited back if
+// the disbursement fails or is rejected.
+type Withdrawal struct {
+	ID             uint64       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         uint         `gorm:"column:user_id;not null" json:"user_id"`
+	BankAccountID  uint64       `gorm:"column:bank_account_id;not null" json:"bank_account_id"`
+	BankAccount    *BankAccount `gorm:"foreignKey:BankAccountID" json:"bank_account,omitempty"`
+	Amount         Money        `gorm:"column:amount;type:bigint;not null" json:"amount"`
+	Status         string       `gorm:"column:status;not null" json:"status"`
+	Gateway        string       `gorm:"column:gateway" json:"gateway,omitempty"`
+	DisbursementID string       `gorm:"column:disbursement_id" json:"disbursement_id,omitempty"`
+	FailureReason  string       `gorm:"column:failure_reason" json:"failure_reason,omitempty"`
+	ApprovedBy     string       `gorm:"column:approved_by" json:"approved_by,omitempty"`
+	CreatedAt      time.Time    `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time    `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Withdrawal) TableName() string {
+	return "withdrawals"
+}
+
+// DisbursementRequest asks a disbursement gateway to send money to a bank account
+type DisbursementRequest struct {
+	ExternalID        string
+	Amount            Money
+	BankCode          string
+	AccountNumber     string
+	AccountHolderName string
+	Description       string
+}
+
+// Disbursement is a gateway's view of a payout. Status is PENDING,
+// COMPLETED or FAILED.
+type Disbursement struct {
+	ID          string
+	ExternalID  string
+	Status      string
+	Amount      Money
+	FailureCode string
+}
@@ -9,10 +9,11 @@ type XenditResponse struct {
 	Status                    string                  `json:"status"`
 	MerchantName              string                  `json:"merchant_name"`
 	MerchantProfilePictureURL string                  `json:"merchant_profile_picture_url"`
-	Amount                    int64                   `json:"amount"`
+	Amount                    Money                   `json:"amount"`
 	Description               string                  `json:"description"`
 	ExpiryDate                time.Time               `json:"expiry_date"`
 	InvoiceURL                string                  `json:"invoice_url"`
+	PaymentMethod             string                  `json:"payment_method"`
 	AvailableBanks            []AvailableBank         `json:"available_banks"`
 	AvailableRetailOutlets    []AvailableRetailOutlet `json:"available_retail_outlets"`
 	AvailableEwallets         []AvailableEwallet      `json:"available_ewallets"`
@@ -67,7 +68,7 @@ type Customer struct {
 type Item struct {
 	Name     string `json:"name"`
 	Quantity int64  `json:"quantity"`
-	Price    int64  `json:"price"`
+	Price    Money  `json:"price"`
 	Category string `json:"category"`
 }
 
@@ -0,0 +1,138 @@
+package fakegateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// failingAccountPrefix fails every payout to an account number starting with
+// it, the same as the stub disbursement gateway
+const failingAccountPrefix = "000"
+
+type (
+	createDisbursementRequest struct {
+		ExternalID        string       `json:"external_id"`
+		Amount            domain.Money `json:"amount"`
+		BankCode          string       `json:"bank_code"`
+		AccountHolderName string       `json:"account_holder_name"`
+		AccountNumber     string       `json:"account_number"`
+		Description       string       `json:"description"`
+	}
+
+	// disbursement is both the API answer and the callback body, like Xendit's
+	disbursement struct {
+		ID                string       `json:"id"`
+		ExternalID        string       `json:"external_id"`
+		Amount            domain.Money `json:"amount"`
+		BankCode          string       `json:"bank_code"`
+		AccountHolderName string       `json:"account_holder_name"`
+		Description       string       `json:"disbursement_description"`
+		Status            string       `json:"status"`
+		FailureCode       string       `json:"failure_code,omitempty"`
+	}
+)
+
+// CreateDisbursement answers PENDING and sends the COMPLETED or FAILED
+// callback afterwards. A repeated external id gets the payout already made.
+func (s *Simulator) CreateDisbursement(c echo.Context) error {
+	var request createDisbursementRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"API_VALIDATION_ERROR", err.Error()})
+	}
+	if request.ExternalID == "" || !request.Amount.IsPositive() {
+		return c.JSON(http.StatusBadRequest, xenditError{"API_VALIDATION_ERROR", "external_id and a positive amount are required"})
+	}
+
+	s.mu.Lock()
+	for _, existing := range s.disbursements {
+		if existing.ExternalID == request.ExternalID {
+			res := *existing
+			s.mu.Unlock()
+			return c.JSON(http.StatusOK, res)
+		}
+	}
+	s.sequence++
+	payout := &disbursement{
+		ID:                fmt.Sprintf("fake-disb-%06d", s.sequence),
+		ExternalID:        request.ExternalID,
+		Amount:            request.Amount,
+		BankCode:          request.BankCode,
+		AccountHolderName: request.AccountHolderName,
+		Description:       request.Description,
+		Status:            "PENDING",
+	}
+	s.disbursements[payout.ID] = payout
+	res := *payout
+
+	payout.Status = "COMPLETED"
+	if strings.HasPrefix(request.AccountNumber, failingAccountPrefix) {
+		payout.Status = "FAILED"
+		payout.FailureCode = "INVALID_DESTINATION"
+	}
+	settled := *payout
+	s.mu.Unlock()
+
+	logger.Info("Simulated disbursement created", "id", res.ID, "external_id", res.ExternalID, "amount", res.Amount, "status", settled.Status)
+
+	go func() {
+		if err := s.sendDisbursementCallback(settled); err != nil {
+			logger.Error("Failed to deliver simulated disbursement callback", "id", settled.ID, "error", err)
+		}
+	}()
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Simulator) GetDisbursement(c echo.Context) error {
+	s.mu.Lock()
+	payout, ok := s.disbursements[c.Param("id")]
+	var res disbursement
+	if ok {
+		res = *payout
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return c.JSON(http.StatusNotFound, xenditError{"DIRECT_DISBURSEMENT_NOT_FOUND_ERROR", "Disbursement not found"})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Simulator) sendDisbursementCallback(payout disbursement) error {
+	if s.config.DisbursementCallbackURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(payout)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.config.DisbursementCallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-callback-token", s.config.CallbackToken)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("callback returned %d", res.StatusCode)
+	}
+
+	logger.Info("Simulated disbursement callback delivered", "id", payout.ID, "status", payout.Status)
+	return nil
+}
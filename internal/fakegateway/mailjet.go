@@ -0,0 +1,113 @@
+package fakegateway
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	mailjetAddress struct {
+		Email string `json:"Email"`
+		Name  string `json:"Name"`
+	}
+
+	mailjetMessage struct {
+		From     mailjetAddress   `json:"From"`
+		To       []mailjetAddress `json:"To"`
+		Subject  string           `json:"Subject"`
+		TextPart string           `json:"TextPart"`
+		HTMLPart string           `json:"HTMLPart"`
+	}
+
+	mailjetSendRequest struct {
+		Messages []mailjetMessage `json:"Messages"`
+	}
+
+	// CapturedEmail is one message accepted by the fake Mailjet API
+	CapturedEmail struct {
+		ID         int       `json:"id"`
+		FromEmail  string    `json:"from_email"`
+		FromName   string    `json:"from_name"`
+		To         []string  `json:"to"`
+		Subject    string    `json:"subject"`
+		TextPart   string    `json:"text_part"`
+		HTMLPart   string    `json:"html_part"`
+		ReceivedAt time.Time `json:"received_at"`
+	}
+)
+
+func (s *Simulator) SendEmail(c echo.Context) error {
+	var request mailjetSendRequest
+	if err := c.Bind(&request); err != nil || len(request.Messages) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"ErrorMessage": "Messages is required",
+			"StatusCode":   http.StatusBadRequest,
+		})
+	}
+
+	results := make([]map[string]interface{}, 0, len(request.Messages))
+
+	s.mu.Lock()
+	for _, message := range request.Messages {
+		to := make([]string, 0, len(message.To))
+		for _, address := range message.To {
+			to = append(to, address.Email)
+		}
+
+		email := CapturedEmail{
+			ID:         len(s.emails) + 1,
+			FromEmail:  message.From.Email,
+			FromName:   message.From.Name,
+			To:         to,
+			Subject:    message.Subject,
+			TextPart:   message.TextPart,
+			HTMLPart:   message.HTMLPart,
+			ReceivedAt: time.Now().UTC(),
+		}
+		s.emails = append(s.emails, email)
+		results = append(results, map[string]interface{}{
+			"Status": "success",
+			"To":     message.To,
+		})
+	}
+	s.mu.Unlock()
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"Messages": results})
+}
+
+// ListEmails returns the captured emails, newest first. ?to= filters by recipient.
+func (s *Simulator) ListEmails(c echo.Context) error {
+	to := c.QueryParam("to")
+
+	s.mu.Lock()
+	emails := make([]CapturedEmail, 0, len(s.emails))
+	for i := len(s.emails) - 1; i >= 0; i-- {
+		if to != "" && !contains(s.emails[i].To, to) {
+			continue
+		}
+		emails = append(emails, s.emails[i])
+	}
+	s.mu.Unlock()
+
+	return c.JSON(http.StatusOK, emails)
+}
+
+func (s *Simulator) ClearEmails(c echo.Context) error {
+	s.mu.Lock()
+	s.emails = nil
+	s.mu.Unlock()
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func contains(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+
+	return false
+}
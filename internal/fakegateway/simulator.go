@@ -0,0 +1,87 @@
+// Package fakegateway is a local stand-in for the Xendit and Mailjet APIs, so
+// payments and emails can be worked on without sandbox keys or internet
+// access. It runs on its own from app/fake-gateways or mounted on the API
+// server in development.
+package fakegateway
+
+import (
+	"myGreenMarket/domain"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Config struct {
+	// BaseURL is where the simulator is reachable, it is used for invoice page links
+	BaseURL string
+	// CallbackURL receives the invoice callbacks, normally /api/v1/webhook/handler
+	CallbackURL string
+	// DisbursementCallbackURL receives the payout callbacks, normally /api/v1/webhook/disbursement
+	DisbursementCallbackURL string
+	// CallbackToken is sent as x-callback-token, it must match XENDIT_CALLBACK_TOKEN
+	CallbackToken string
+}
+
+type Simulator struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	invoices      map[string]*domain.XenditResponse
+	order         []string
+	refunds       map[string]*refund
+	disbursements map[string]*disbursement
+	emails        []CapturedEmail
+	sequence      int
+}
+
+func New(cfg Config) *Simulator {
+	return &Simulator{
+		config:        cfg,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		invoices:      make(map[string]*domain.XenditResponse),
+		refunds:       make(map[string]*refund),
+		disbursements: make(map[string]*disbursement),
+	}
+}
+
+// Register mounts the fake Xendit API, the invoice pages and the fake Mailjet
+// API on g. The paths match the real services, so XENDIT_URL and
+// MAILJET_BASE_URL only need to point at the simulator.
+func (s *Simulator) Register(g *echo.Group) {
+	// Xendit API used by XenditRepository
+	g.POST("/v2/invoices", s.CreateInvoice, requireBasicAuth)
+	g.GET("/v2/invoices/:id", s.GetInvoice, requireBasicAuth)
+	g.POST("/invoices/:id/expire!", s.ExpireInvoice, requireBasicAuth)
+	g.POST("/refunds", s.CreateRefund, requireBasicAuth)
+	g.GET("/refunds/:id", s.GetRefund, requireBasicAuth)
+	g.POST("/disbursements", s.CreateDisbursement, requireBasicAuth)
+	g.GET("/disbursements/:id", s.GetDisbursement, requireBasicAuth)
+
+	// Controls for marking invoices paid or expired
+	g.GET("/invoices", s.ListInvoices)
+	g.GET("/invoices/:id", s.InvoicePage)
+	g.POST("/invoices/:id/pay", s.PayInvoice)
+	g.POST("/invoices/:id/expire", s.ExpireInvoiceAndNotify)
+
+	// Mailjet API used by MailjetRepository
+	g.POST("/v3.1/send", s.SendEmail, requireBasicAuth)
+	g.GET("/emails", s.ListEmails)
+	g.DELETE("/emails", s.ClearEmails)
+}
+
+// requireBasicAuth rejects calls without credentials, the way both real APIs do
+func requireBasicAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if username, _, ok := c.Request().BasicAuth(); !ok || username == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{
+				"error_code": "INVALID_API_KEY",
+				"message":    "API key is missing",
+			})
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,372 @@
+package fakegateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	createInvoiceRequest struct {
+		ExternalID         string          `json:"external_id"`
+		Amount             domain.Money    `json:"amount"`
+		Description        string          `json:"description"`
+		InvoiceDuration    int64           `json:"invoice_duration"`
+		Customer           domain.Customer `json:"customer"`
+		SuccessRedirectURL string          `json:"success_redirect_url"`
+		FailureRedirectURL string          `json:"failure_redirect_url"`
+		Currency           string          `json:"currency"`
+		Items              []domain.Item   `json:"items"`
+	}
+
+	createRefundRequest struct {
+		InvoiceID   string       `json:"invoice_id"`
+		ReferenceID string       `json:"reference_id"`
+		Amount      domain.Money `json:"amount"`
+		Reason      string       `json:"reason"`
+	}
+
+	// refund is the API answer for refunds
+	refund struct {
+		ID          string       `json:"id"`
+		InvoiceID   string       `json:"invoice_id"`
+		ReferenceID string       `json:"reference_id"`
+		Status      string       `json:"status"`
+		Amount      domain.Money `json:"amount"`
+		Reason      string       `json:"reason"`
+		Currency    string       `json:"currency"`
+	}
+
+	// invoiceCallback is the body Xendit posts to the invoice callback URL
+	invoiceCallback struct {
+		ID                 string        `json:"id"`
+		ExternalID         string        `json:"external_id"`
+		UserID             string        `json:"user_id"`
+		IsHigh             bool          `json:"is_high"`
+		Status             string        `json:"status"`
+		MerchantName       string        `json:"merchant_name"`
+		Amount             domain.Money  `json:"amount"`
+		PaidAmount         *domain.Money `json:"paid_amount,omitempty"`
+		PayerEmail         string        `json:"payer_email"`
+		Description        string        `json:"description"`
+		PaymentMethod      string        `json:"payment_method,omitempty"`
+		PaymentChannel     string        `json:"payment_channel,omitempty"`
+		PaymentDestination string        `json:"payment_destination,omitempty"`
+		PaidAt             *time.Time    `json:"paid_at,omitempty"`
+		Created            time.Time     `json:"created"`
+		Updated            time.Time     `json:"updated"`
+		Currency           string        `json:"currency"`
+		Items              []domain.Item `json:"items"`
+		SuccessRedirectURL string        `json:"success_redirect_url"`
+		FailureRedirectURL string        `json:"failure_redirect_url"`
+	}
+
+	xenditError struct {
+		ErrorCode string `json:"error_code"`
+		Message   string `json:"message"`
+	}
+)
+
+func (s *Simulator) CreateInvoice(c echo.Context) error {
+	var request createInvoiceRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"API_VALIDATION_ERROR", err.Error()})
+	}
+	if request.ExternalID == "" || !request.Amount.IsPositive() {
+		return c.JSON(http.StatusBadRequest, xenditError{"API_VALIDATION_ERROR", "external_id and a positive amount are required"})
+	}
+
+	duration := time.Duration(request.InvoiceDuration) * time.Second
+	if duration <= 0 {
+		duration = 24 * time.Hour
+	}
+	currency := request.Currency
+	if currency == "" {
+		currency = "IDR"
+	}
+
+	s.mu.Lock()
+	s.sequence++
+	id := fmt.Sprintf("fake-inv-%06d", s.sequence)
+	now := time.Now().UTC()
+	invoice := &domain.XenditResponse{
+		ID:                 id,
+		ExternalID:         request.ExternalID,
+		UserID:             "fake-merchant",
+		Status:             "PENDING",
+		MerchantName:       "MyGreenMarket (simulated)",
+		Amount:             request.Amount,
+		Description:        request.Description,
+		ExpiryDate:         now.Add(duration),
+		InvoiceURL:         s.config.BaseURL + "/invoices/" + id,
+		SuccessRedirectURL: request.SuccessRedirectURL,
+		FailureRedirectURL: request.FailureRedirectURL,
+		Created:            now,
+		Updated:            now,
+		Currency:           currency,
+		Items:              request.Items,
+		Customer:           request.Customer,
+	}
+	s.invoices[id] = invoice
+	s.order = append(s.order, id)
+	res := *invoice
+	s.mu.Unlock()
+
+	logger.Info("Simulated invoice created", "id", id, "external_id", request.ExternalID, "amount", request.Amount)
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Simulator) GetInvoice(c echo.Context) error {
+	invoice, ok := s.invoice(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, xenditError{"INVOICE_NOT_FOUND_ERROR", "Invoice not found"})
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+// ExpireInvoice is the API call, it answers like Xendit and sends the EXPIRED callback
+func (s *Simulator) ExpireInvoice(c echo.Context) error {
+	if _, ok := s.invoice(c.Param("id")); !ok {
+		return c.JSON(http.StatusNotFound, xenditError{"INVOICE_NOT_FOUND_ERROR", "Invoice not found"})
+	}
+
+	invoice, err := s.settle(c.Param("id"), "EXPIRED", "")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"INVALID_INVOICE_STATUS", err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+// CreateRefund succeeds right away. A repeated reference id gets the refund
+// already made, like Xendit's idempotency key.
+func (s *Simulator) CreateRefund(c echo.Context) error {
+	var request createRefundRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"API_VALIDATION_ERROR", err.Error()})
+	}
+
+	invoice, ok := s.invoice(request.InvoiceID)
+	if !ok {
+		return c.JSON(http.StatusNotFound, xenditError{"INVOICE_NOT_FOUND_ERROR", "Invoice not found"})
+	}
+	if invoice.Status != "PAID" && invoice.Status != "SETTLED" {
+		return c.JSON(http.StatusBadRequest, xenditError{"INVALID_PAYMENT_STATUS", "Only paid invoices can be refunded"})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if request.ReferenceID != "" {
+		for _, existing := range s.refunds {
+			if existing.ReferenceID == request.ReferenceID {
+				return c.JSON(http.StatusOK, *existing)
+			}
+		}
+	}
+
+	s.sequence++
+	created := &refund{
+		ID:          fmt.Sprintf("fake-rfd-%06d", s.sequence),
+		InvoiceID:   invoice.ID,
+		ReferenceID: request.ReferenceID,
+		Status:      "SUCCEEDED",
+		Amount:      request.Amount,
+		Reason:      request.Reason,
+		Currency:    invoice.Currency,
+	}
+	s.refunds[created.ID] = created
+
+	return c.JSON(http.StatusOK, *created)
+}
+
+func (s *Simulator) GetRefund(c echo.Context) error {
+	s.mu.Lock()
+	found, ok := s.refunds[c.Param("id")]
+	var res refund
+	if ok {
+		res = *found
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return c.JSON(http.StatusNotFound, xenditError{"DATA_NOT_FOUND", "Refund not found"})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Simulator) ListInvoices(c echo.Context) error {
+	s.mu.Lock()
+	invoices := make([]domain.XenditResponse, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		invoices = append(invoices, *s.invoices[s.order[i]])
+	}
+	s.mu.Unlock()
+
+	return c.JSON(http.StatusOK, invoices)
+}
+
+var invoicePage = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Invoice {{.ID}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto">
+<h1>Simulated invoice</h1>
+<p><b>{{.ID}}</b> &middot; {{.ExternalID}}</p>
+<p>{{.Description}}</p>
+<table>
+{{range .Items}}<tr><td>{{.Name}}</td><td>x{{.Quantity}}</td><td>{{.Price}}</td></tr>{{end}}
+</table>
+<p>Total {{.Currency}} {{.Amount.Decimal}}, status <b>{{.Status}}</b>, expires {{.ExpiryDate.Format "2006-01-02 15:04:05"}}</p>
+{{if eq .Status "PENDING"}}
+<form method="post" action="{{.ID}}/pay">
+<select name="payment_method">
+<option>BANK_TRANSFER</option><option>EWALLET</option><option>CREDIT_CARD</option><option>QR_CODE</option>
+</select>
+<button type="submit">Mark PAID</button>
+</form>
+<form method="post" action="{{.ID}}/expire"><button type="submit">Mark EXPIRED</button></form>
+{{end}}
+</body>
+</html>`))
+
+func (s *Simulator) InvoicePage(c echo.Context) error {
+	invoice, ok := s.invoice(c.Param("id"))
+	if !ok {
+		return c.String(http.StatusNotFound, "invoice not found")
+	}
+
+	var page bytes.Buffer
+	if err := invoicePage.Execute(&page, invoice); err != nil {
+		return err
+	}
+
+	return c.HTMLBlob(http.StatusOK, page.Bytes())
+}
+
+func (s *Simulator) PayInvoice(c echo.Context) error {
+	method := c.FormValue("payment_method")
+	if method == "" {
+		method = "BANK_TRANSFER"
+	}
+
+	invoice, err := s.settle(c.Param("id"), "PAID", method)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"INVALID_INVOICE_STATUS", err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+func (s *Simulator) ExpireInvoiceAndNotify(c echo.Context) error {
+	invoice, err := s.settle(c.Param("id"), "EXPIRED", "")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, xenditError{"INVALID_INVOICE_STATUS", err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, invoice)
+}
+
+func (s *Simulator) invoice(id string) (domain.XenditResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok {
+		return domain.XenditResponse{}, false
+	}
+
+	return *invoice, true
+}
+
+// settle moves a pending invoice to PAID or EXPIRED and fires the callback
+func (s *Simulator) settle(id, status, method string) (domain.XenditResponse, error) {
+	s.mu.Lock()
+	invoice, ok := s.invoices[id]
+	if !ok {
+		s.mu.Unlock()
+		return domain.XenditResponse{}, fmt.Errorf("invoice %s not found", id)
+	}
+	if invoice.Status != "PENDING" {
+		s.mu.Unlock()
+		return domain.XenditResponse{}, fmt.Errorf("invoice %s is already %s", id, invoice.Status)
+	}
+	invoice.Status = status
+	invoice.PaymentMethod = method
+	invoice.Updated = time.Now().UTC()
+	settled := *invoice
+	s.mu.Unlock()
+
+	// Xendit calls back after answering, the caller may still hold locks
+	// the callback handler needs
+	go func() {
+		if err := s.sendCallback(settled); err != nil {
+			logger.Error("Failed to deliver simulated callback", "id", id, "error", err)
+		}
+	}()
+
+	return settled, nil
+}
+
+func (s *Simulator) sendCallback(invoice domain.XenditResponse) error {
+	if s.config.CallbackURL == "" {
+		return nil
+	}
+
+	callback := invoiceCallback{
+		ID:                 invoice.ID,
+		ExternalID:         invoice.ExternalID,
+		UserID:             invoice.UserID,
+		Status:             invoice.Status,
+		MerchantName:       invoice.MerchantName,
+		Amount:             invoice.Amount,
+		PayerEmail:         invoice.Customer.Email,
+		Description:        invoice.Description,
+		Created:            invoice.Created,
+		Updated:            invoice.Updated,
+		Currency:           invoice.Currency,
+		Items:              invoice.Items,
+		SuccessRedirectURL: invoice.SuccessRedirectURL,
+		FailureRedirectURL: invoice.FailureRedirectURL,
+	}
+	if invoice.Status == "PAID" {
+		paidAt := invoice.Updated
+		callback.PaidAt = &paidAt
+		paidAmount := invoice.Amount
+		callback.PaidAmount = &paidAmount
+		callback.PaymentMethod = invoice.PaymentMethod
+		callback.PaymentChannel = "SIMULATOR"
+		callback.PaymentDestination = "SIMULATOR"
+	}
+
+	body, err := json.Marshal(callback)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-callback-token", s.config.CallbackToken)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("callback returned %d", res.StatusCode)
+	}
+
+	logger.Info("Simulated callback delivered", "id", invoice.ID, "status", invoice.Status)
+	return nil
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"myGreenMarket/pkg/logger"
+	"net"
+	"net/http"
+	"strings"
+
+	jsonres "myGreenMarket/pkg/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// XenditCallbackAuth verifies the x-callback-token header Xendit sends with
+// every callback. When allowedIPs is not empty the caller must also come from
+// one of those IPs or CIDR ranges.
+// The caller's IP is c.RealIP(), see ClientIPExtractor for which headers it
+// may come from.
+func XenditCallbackAuth(callbackToken string, allowedIPs []string) echo.MiddlewareFunc {
+	allowedNets := parseNets(allowedIPs, "webhook allowlist")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			remoteIP := c.RealIP()
+
+			if len(allowedNets) > 0 && !ipAllowed(remoteIP, allowedNets) {
+				logger.Warn("Rejected webhook from address outside allowlist",
+					"path", c.Request().URL.Path,
+					"remote_ip", remoteIP,
+				)
+				return c.JSON(http.StatusForbidden, jsonres.Error(
+					"FORBIDDEN", "Webhook source not allowed", nil,
+				))
+			}
+
+			token := c.Request().Header.Get("x-callback-token")
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(callbackToken)) != 1 {
+				logger.Warn("Rejected webhook with invalid callback token",
+					"path", c.Request().URL.Path,
+					"remote_ip", remoteIP,
+				)
+				return c.JSON(http.StatusUnauthorized, jsonres.Error(
+					"UNAUTHORIZED", "Invalid callback token", nil,
+				))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// ClientIPExtractor decides where c.RealIP() comes from. Without trusted
+// proxies it is the connecting address and forwarding headers are ignored, so
+// a client cannot claim another address. With them, X-Forwarded-For is
+// followed back through the listed IPs or CIDR ranges only.
+func ClientIPExtractor(trustedProxies []string) echo.IPExtractor {
+	proxyNets := parseNets(trustedProxies, "trusted proxy")
+	if len(proxyNets) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range proxyNets {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// parseNets parses IPs and CIDR ranges, a plain IP is a range of one
+func parseNets(entries []string, what string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Warn("Ignoring invalid "+what+" entry", "entry", entry, "error", err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets
+}
+
+func ipAllowed(remoteIP string, allowedNets []*net.IPNet) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
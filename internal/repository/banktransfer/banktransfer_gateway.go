@@ -0,0 +1,104 @@
+package banktransfer
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+)
+
+type BankTransferConfig struct {
+	BankName          string
+	BankAccountNumber string
+	BankAccountName   string
+}
+
+// BankTransferGateway is a payment gateway for stores that take plain bank
+// transfers. Nothing leaves the process: the customer gets transfer
+// instructions and an admin confirms the payment once the money arrives, so
+// the payments table is the only record of the invoice state.
+type BankTransferGateway struct {
+	bankTransferConfig BankTransferConfig
+}
+
+func NewBankTransferGateway(cfg BankTransferConfig) *BankTransferGateway {
+	return &BankTransferGateway{
+		cfg,
+	}
+}
+
+func (g BankTransferGateway) Name() string {
+	return "bank_transfer"
+}
+
+func (g BankTransferGateway) CreateInvoice(ctx context.Context, invoice domain.InvoiceRequest) (domain.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return domain.Invoice{
+		ID:            invoice.ExternalID,
+		ExternalID:    invoice.ExternalID,
+		Status:        "PENDING",
+		Amount:        invoice.Amount,
+		PaymentMethod: "BANK_TRANSFER",
+		Instructions: fmt.Sprintf("Transfer %s to %s account %s (%s) and write %s in the transfer note",
+			invoice.Amount, g.bankTransferConfig.BankName, g.bankTransferConfig.BankAccountNumber, g.bankTransferConfig.BankAccountName, invoice.ExternalID),
+		ExpiryDate: time.Now().Add(invoice.Duration),
+	}, nil
+}
+
+// GetInvoice always reports PENDING, a transfer is only PAID once an admin confirms it
+func (g BankTransferGateway) GetInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return domain.Invoice{
+		ID:            invoiceID,
+		ExternalID:    invoiceID,
+		Status:        "PENDING",
+		PaymentMethod: "BANK_TRANSFER",
+	}, nil
+}
+
+func (g BankTransferGateway) ExpireInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return domain.Invoice{
+		ID:            invoiceID,
+		ExternalID:    invoiceID,
+		Status:        "EXPIRED",
+		PaymentMethod: "BANK_TRANSFER",
+	}, nil
+}
+
+// Refund records nothing remotely, the money has to be transferred back by hand
+func (g BankTransferGateway) Refund(ctx context.Context, refund domain.RefundRequest) (domain.Refund, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Refund{}, err
+	}
+
+	return domain.Refund{
+		ID:          refund.ReferenceID,
+		InvoiceID:   refund.InvoiceID,
+		ReferenceID: refund.ReferenceID,
+		Status:      "PENDING",
+		Amount:      refund.Amount,
+	}, nil
+}
+
+// GetRefund is always PENDING, an admin confirms the refund once the money is back
+func (g BankTransferGateway) GetRefund(ctx context.Context, refundID string) (domain.Refund, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Refund{}, err
+	}
+
+	return domain.Refund{
+		ID:          refundID,
+		ReferenceID: refundID,
+		Status:      "PENDING",
+	}, nil
+}
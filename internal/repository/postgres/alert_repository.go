@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AlertRepository struct {
+	DB *gorm.DB
+}
+
+func NewAlertRepository(db *gorm.DB) *AlertRepository {
+	return &AlertRepository{
+		DB: db,
+	}
+}
+
+// FindLowStock returns products at or below their reorder threshold
+func (r *AlertRepository) FindLowStock(ctx context.Context) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var products []domain.Product
+	err := dbWithContext(ctx, r.DB).
+		Where("reorder_threshold IS NOT NULL AND quantity <= reorder_threshold").
+		Order("id").
+		Find(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find low stock products: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *AlertRepository) FindOpen(ctx context.Context) ([]domain.StockAlert, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var alerts []domain.StockAlert
+	err := dbWithContext(ctx, r.DB).Where("resolved_at IS NULL").Order("id").Find(&alerts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open stock alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// FindAll returns a page of alerts, newest first, and how many there are in
+// total. openOnly leaves resolved alerts out.
+func (r *AlertRepository) FindAll(ctx context.Context, openOnly bool, offset, limit int) ([]domain.StockAlert, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	query := dbWithContext(ctx, r.DB).Model(&domain.StockAlert{})
+	if openOnly {
+		query = query.Where("resolved_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock alerts: %w", err)
+	}
+
+	var alerts []domain.StockAlert
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&alerts).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find stock alerts: %w", err)
+	}
+
+	return alerts, total, nil
+}
+
+func (r *AlertRepository) Create(ctx context.Context, alert *domain.StockAlert) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(alert).Error; err != nil {
+		return fmt.Errorf("failed to create stock alert: %w", err)
+	}
+
+	return nil
+}
+
+// Resolve closes an open alert, the item is reported again if the
+// condition comes back
+func (r *AlertRepository) Resolve(ctx context.Context, id uint64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.StockAlert{}).
+		Where("id = ? AND resolved_at IS NULL", id).
+		Update("resolved_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("failed to resolve stock alert: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("stock alert not found")
+	}
+
+	return nil
+}
+
+func (r *AlertRepository) MarkNotified(ctx context.Context, ids []uint64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := dbWithContext(ctx, r.DB).Model(&domain.StockAlert{}).
+		Where("id IN ?", ids).
+		Update("notified_at", at).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark stock alerts notified: %w", err)
+	}
+
+	return nil
+}
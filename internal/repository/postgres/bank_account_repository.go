@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+)
+
+type BankAccountRepository struct {
+	DB *gorm.DB
+}
+
+func NewBankAccountRepository(db *gorm.DB) *BankAccountRepository {
+	return &BankAccountRepository{
+		DB: db,
+	}
+}
+
+func (r *BankAccountRepository) Create(ctx context.Context, account domain.BankAccount) (domain.BankAccount, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BankAccount{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(&account).Error; err != nil {
+		return domain.BankAccount{}, fmt.Errorf("failed to create bank account: %w", err)
+	}
+
+	return account, nil
+}
+
+func (r *BankAccountRepository) FindByUserID(ctx context.Context, userID uint) ([]domain.BankAccount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var accounts []domain.BankAccount
+	err := dbWithContext(ctx, r.DB).Where("user_id = ?", userID).Order("created_at, id").Find(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find bank accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// FindByID only finds the account when it belongs to userID
+func (r *BankAccountRepository) FindByID(ctx context.Context, id uint64, userID uint) (domain.BankAccount, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.BankAccount{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var account domain.BankAccount
+	err := dbWithContext(ctx, r.DB).Where("id = ? AND user_id = ?", id, userID).First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.BankAccount{}, errors.New("bank account not found")
+		}
+		return domain.BankAccount{}, fmt.Errorf("failed to find bank account: %w", err)
+	}
+
+	return account, nil
+}
+
+// Delete soft deletes the account, withdrawals already made to it keep pointing at it
+func (r *BankAccountRepository) Delete(ctx context.Context, id uint64, userID uint) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Where("id = ? AND user_id = ?", id, userID).Delete(&domain.BankAccount{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete bank account: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("bank account not found")
+	}
+
+	return nil
+}
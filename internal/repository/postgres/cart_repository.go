@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+)
+
+type CartRepository struct {
+	DB *gorm.DB
+}
+
+func NewCartRepository(db *gorm.DB) *CartRepository {
+	return &CartRepository{
+		DB: db,
+	}
+}
+
+func (r *CartRepository) FindByUserID(ctx context.Context, userID uint) ([]domain.CartItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var items []domain.CartItem
+	err := dbWithContext(ctx, r.DB).Where("user_id = ?", userID).Order("id").Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cart items: %w", err)
+	}
+
+	return items, nil
+}
+
+func (r *CartRepository) FindItem(ctx context.Context, userID uint, productID uint64) (domain.CartItem, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.CartItem{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var item domain.CartItem
+	err := dbWithContext(ctx, r.DB).Where("user_id = ? AND product_id = ?", userID, productID).First(&item).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.CartItem{}, errors.New("cart item not found")
+		}
+		return domain.CartItem{}, fmt.Errorf("failed to find cart item: %w", err)
+	}
+
+	return item, nil
+}
+
+func (r *CartRepository) Create(ctx context.Context, item *domain.CartItem) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(item).Error; err != nil {
+		return fmt.Errorf("failed to create cart item: %w", err)
+	}
+
+	return nil
+}
+
+func (r *CartRepository) Update(ctx context.Context, item *domain.CartItem) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.CartItem{}).
+		Where("user_id = ? AND product_id = ?", item.UserID, item.ProductID).
+		Updates(map[string]interface{}{
+			"quantity":   item.Quantity,
+			"updated_at": item.UpdatedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update cart item: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("cart item not found")
+	}
+
+	return nil
+}
+
+func (r *CartRepository) Delete(ctx context.Context, userID uint, productID uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Where("user_id = ? AND product_id = ?", userID, productID).Delete(&domain.CartItem{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete cart item: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("cart item not found")
+	}
+
+	return nil
+}
+
+func (r *CartRepository) Clear(ctx context.Context, userID uint) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Where("user_id = ?", userID).Delete(&domain.CartItem{}).Error; err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+
+	return nil
+}
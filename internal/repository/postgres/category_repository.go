@@ -7,6 +7,7 @@ import (
 	"myGreenMarket/domain"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CategoryRepository struct {
@@ -24,7 +25,7 @@ func (r *CategoryRepository) Create(ctx context.Context, category *domain.Catego
 		return fmt.Errorf("context error: %w", err)
 	}
 
-	if err := r.DB.WithContext(ctx).Create(category).Error; err != nil {
+	if err := dbWithContext(ctx, r.DB).Create(category).Error; err != nil {
 		return fmt.Errorf("failed to create category: %w", err)
 	}
 
@@ -38,10 +39,10 @@ func (r *CategoryRepository) FindByID(ctx context.Context, id uint64) (domain.Ca
 
 	var category domain.Category
 
-	err := r.DB.WithContext(ctx).Where("category_id = ?", id).First(&category).Error
+	err := dbWithContext(ctx, r.DB).Where("category_id = ?", id).First(&category).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return domain.Category{}, errors.New("category not found")
+			return domain.Category{}, domain.ErrCategoryNotFound
 		}
 		return domain.Category{}, fmt.Errorf("failed to find category: %w", err)
 	}
@@ -49,13 +50,51 @@ func (r *CategoryRepository) FindByID(ctx context.Context, id uint64) (domain.Ca
 	return category, nil
 }
 
+// FindByName finds the category with exactly this name
+func (r *CategoryRepository) FindByName(ctx context.Context, name string) (domain.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Category{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var category domain.Category
+
+	err := dbWithContext(ctx, r.DB).Where("product_category = ?", name).Order("category_id").First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Category{}, domain.ErrCategoryNotFound
+		}
+		return domain.Category{}, fmt.Errorf("failed to find category: %w", err)
+	}
+
+	return category, nil
+}
+
+func (r *CategoryRepository) FindBySlug(ctx context.Context, slug string) (domain.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Category{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var category domain.Category
+
+	err := dbWithContext(ctx, r.DB).Where("slug = ?", slug).First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Category{}, domain.ErrCategoryNotFound
+		}
+		return domain.Category{}, fmt.Errorf("failed to find category: %w", err)
+	}
+
+	return category, nil
+}
+
+// FindAll returns every category by name, flat, the service builds the tree
 func (r *CategoryRepository) FindAll(ctx context.Context) ([]domain.Category, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context error: %w", err)
 	}
 
 	var categories []domain.Category
-	err := r.DB.WithContext(ctx).Find(&categories).Error
+	err := dbWithContext(ctx, r.DB).Order("product_category, category_id").Find(&categories).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to find categories: %w", err)
 	}
@@ -63,39 +102,157 @@ func (r *CategoryRepository) FindAll(ctx context.Context) ([]domain.Category, er
 	return categories, nil
 }
 
-func (r *CategoryRepository) Update(ctx context.Context, category *domain.Category) error {
+// CountProducts returns how many products each category has directly,
+// categories without products are left out
+func (r *CategoryRepository) CountProducts(ctx context.Context) (map[uint64]int64, error) {
 	if err := ctx.Err(); err != nil {
-		return fmt.Errorf("context error: %w", err)
+		return nil, fmt.Errorf("context error: %w", err)
 	}
 
-	// Update product_category field
-	updateData := map[string]interface{}{
-		"product_category": category.ProductCategory,
+	var rows []struct {
+		CategoryID uint64
+		Count      int64
 	}
-
-	result := r.DB.WithContext(ctx).Model(&domain.Category{}).Where("category_id = ?", category.CategoryID).Updates(updateData)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update category: %w", result.Error)
+	err := dbWithContext(ctx, r.DB).Model(&domain.Product{}).
+		Select("category_id, COUNT(*) AS count").
+		Where("category_id IS NOT NULL").
+		Group("category_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count products per category: %w", err)
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("category not found")
+
+	counts := make(map[uint64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.CategoryID] = row.Count
 	}
 
-	return nil
+	return counts, nil
 }
 
-func (r *CategoryRepository) Delete(ctx context.Context, id uint64) error {
+// Update saves the category's name, slug and parent. A rename is carried to
+// the products in the category and to the markdown rules and promotions that
+// named it, so none of them lose the category.
+func (r *CategoryRepository) Update(ctx context.Context, category *domain.Category) error {
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("context error: %w", err)
 	}
 
-	result := r.DB.WithContext(ctx).Where("category_id = ?", id).Delete(&domain.Category{})
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete category: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("category not found")
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var current domain.Category
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("category_id = ?", category.CategoryID).
+			First(&current).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrCategoryNotFound
+			}
+			return fmt.Errorf("failed to find category: %w", err)
+		}
+
+		updateData := map[string]interface{}{
+			"product_category": category.ProductCategory,
+			"slug":             category.Slug,
+			"parent_id":        category.ParentID,
+		}
+		if err := tx.Model(&domain.Category{}).Where("category_id = ?", category.CategoryID).Updates(updateData).Error; err != nil {
+			return fmt.Errorf("failed to update category: %w", err)
+		}
+
+		if current.ProductCategory == category.ProductCategory {
+			return nil
+		}
+
+		err = tx.Model(&domain.Product{}).
+			Where("category_id = ?", category.CategoryID).
+			Update("product_category", category.ProductCategory).Error
+		if err != nil {
+			return fmt.Errorf("failed to rename category of products: %w", err)
+		}
+
+		// Another category may still go by the old name, rules naming it are
+		// then left alone
+		var sameName int64
+		err = tx.Model(&domain.Category{}).
+			Where("product_category = ? AND category_id <> ?", current.ProductCategory, category.CategoryID).
+			Count(&sameName).Error
+		if err != nil {
+			return fmt.Errorf("failed to find categories: %w", err)
+		}
+		if sameName > 0 {
+			return nil
+		}
+
+		for _, model := range []interface{}{&domain.MarkdownRule{}, &domain.Promotion{}} {
+			err := tx.Model(model).
+				Where("product_category = ?", current.ProductCategory).
+				Update("product_category", category.ProductCategory).Error
+			if err != nil {
+				return fmt.Errorf("failed to rename category of rules: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete removes a category without subcategories. Its products are moved to
+// reassignTo first, without one a category with products is not deleted and
+// domain.ErrCategoryInUse is returned.
+func (r *CategoryRepository) Delete(ctx context.Context, id uint64, reassignTo *uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
 	}
 
-	return nil
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var category domain.Category
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("category_id = ?", id).First(&category).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrCategoryNotFound
+			}
+			return fmt.Errorf("failed to find category: %w", err)
+		}
+
+		var children int64
+		if err := tx.Model(&domain.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return fmt.Errorf("failed to count subcategories: %w", err)
+		}
+		if children > 0 {
+			return errors.New("category has subcategories")
+		}
+
+		if reassignTo != nil {
+			var target domain.Category
+			err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("category_id = ?", *reassignTo).First(&target).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("reassign category not found")
+				}
+				return fmt.Errorf("failed to find category: %w", err)
+			}
+
+			err = tx.Model(&domain.Product{}).Where("category_id = ?", id).Updates(map[string]interface{}{
+				"category_id":      target.CategoryID,
+				"product_category": target.ProductCategory,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to reassign products: %w", err)
+			}
+		} else {
+			var products int64
+			if err := tx.Model(&domain.Product{}).Where("category_id = ?", id).Count(&products).Error; err != nil {
+				return fmt.Errorf("failed to count products: %w", err)
+			}
+			if products > 0 {
+				return domain.ErrCategoryInUse
+			}
+		}
+
+		if err := tx.Where("category_id = ?", id).Delete(&domain.Category{}).Error; err != nil {
+			return fmt.Errorf("failed to delete category: %w", err)
+		}
+
+		return nil
+	})
 }
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InventoryMovementRepository struct {
+	DB *gorm.DB
+}
+
+func NewInventoryMovementRepository(db *gorm.DB) *InventoryMovementRepository {
+	return &InventoryMovementRepository{
+		DB: db,
+	}
+}
+
+// FindByProductID returns a page of the product's movements, newest first,
+// and how many there are in total
+func (r *InventoryMovementRepository) FindByProductID(ctx context.Context, productID uint64, offset, limit int) ([]domain.InventoryMovement, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	query := dbWithContext(ctx, r.DB).Model(&domain.InventoryMovement{}).Where("product_id = ?", productID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count inventory movements: %w", err)
+	}
+
+	var movements []domain.InventoryMovement
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&movements).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find inventory movements: %w", err)
+	}
+
+	return movements, total, nil
+}
+
+// recordMovement writes a movement like move for quantity of the product.
+// It is called in the same transaction as the stock change it records.
+func recordMovement(tx *gorm.DB, move domain.InventoryMovement, productID int, quantity float64, batchID *uint64) error {
+	movement := move
+	movement.ID = 0
+	movement.ProductID = uint64(productID)
+	movement.Quantity = quantity
+	if batchID != nil {
+		id := *batchID
+		movement.BatchID = &id
+	}
+	movement.CreatedAt = time.Now()
+
+	if err := tx.Create(&movement).Error; err != nil {
+		return fmt.Errorf("failed to record inventory movement: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MarkdownRepository struct {
+	DB *gorm.DB
+}
+
+func NewMarkdownRepository(db *gorm.DB) *MarkdownRepository {
+	return &MarkdownRepository{
+		DB: db,
+	}
+}
+
+func (r *MarkdownRepository) CreateRule(ctx context.Context, rule *domain.MarkdownRule) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(rule).Error; err != nil {
+		return fmt.Errorf("failed to create markdown rule: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MarkdownRepository) FindRules(ctx context.Context) ([]domain.MarkdownRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var rules []domain.MarkdownRule
+	err := dbWithContext(ctx, r.DB).Order("days_left DESC, id").Find(&rules).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find markdown rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (r *MarkdownRepository) DeleteRule(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Where("id = ?", id).Delete(&domain.MarkdownRule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete markdown rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("markdown rule not found")
+	}
+
+	return nil
+}
+
+func (r *MarkdownRepository) FindMarkdownCandidates(ctx context.Context) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var products []domain.Product
+	err := dbWithContext(ctx, r.DB).
+		Preload("Batches", "written_off_at IS NULL").
+		Where("markdown_rule_id IS NOT NULL OR EXISTS (SELECT 1 FROM stock_batches b WHERE b.product_id = products.id AND b.written_off_at IS NULL)").
+		Order("id").
+		Find(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find markdown candidates: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *MarkdownRepository) SetMarkdown(ctx context.Context, productID uint64, outcome domain.MarkdownOutcome) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"is_green_tag":     outcome.IsGreenTag,
+		"sale_price":       outcome.SalePrice,
+		"discount":         outcome.Discount,
+		"markdown_rule_id": outcome.RuleID,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to set markdown: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrProductNotFound
+	}
+
+	return nil
+}
+
+// WriteOff closes the batch and takes what was left of it off sale. A batch
+// that was already closed is left alone, so a retried run writes off once.
+func (r *MarkdownRepository) WriteOff(ctx context.Context, batchID uint64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var batch domain.StockBatch
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND written_off_at IS NULL", batchID).
+			First(&batch).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return fmt.Errorf("failed to find stock batch: %w", err)
+		}
+
+		err = tx.Model(&domain.StockBatch{}).Where("id = ?", batch.ID).Updates(map[string]interface{}{
+			"written_off_at":       at,
+			"written_off_quantity": gorm.Expr("written_off_quantity + ?", batch.Remaining),
+			"remaining":            0,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to write off stock batch: %w", err)
+		}
+		if batch.Remaining <= 0 {
+			return nil
+		}
+
+		err = tx.Model(&domain.Product{}).
+			Where("id = ?", batch.ProductID).
+			Update("quantity", gorm.Expr("GREATEST(quantity - ?, 0)", batch.Remaining)).Error
+		if err != nil {
+			return fmt.Errorf("failed to write off stock: %w", err)
+		}
+
+		return recordMovement(tx, domain.InventoryMovement{
+			Reason: domain.MovementReasonWriteOff,
+			Actor:  "system",
+			Note:   "batch expired",
+		}, int(batch.ProductID), -batch.Remaining, &batch.ID)
+	})
+}
@@ -3,9 +3,12 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 	"myGreenMarket/domain"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrdersRepository struct {
@@ -18,9 +21,21 @@ func NewOrdersRepository(db *gorm.DB) *OrdersRepository {
 	}
 }
 
-func (r *OrdersRepository) CreateOrder(data domain.Orders) (domain.Orders, error) {
-	ctx := context.Background()
-	err := r.DB.WithContext(ctx).Create(&data).Error
+func (r *OrdersRepository) CreateOrder(ctx context.Context, data domain.Orders) (domain.Orders, error) {
+	err := dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		// Header and line items are created together by gorm's association save
+		if err := tx.Create(&data).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&domain.OrderStatusHistory{
+			OrderID:   data.ID,
+			ToStatus:  data.OrderStatus,
+			Actor:     fmt.Sprintf("user:%d", data.UserID),
+			Reason:    "order created",
+			CreatedAt: data.CreatedAt,
+		}).Error
+	})
 	if err != nil {
 		return domain.Orders{}, err
 	}
@@ -28,10 +43,9 @@ func (r *OrdersRepository) CreateOrder(data domain.Orders) (domain.Orders, error
 	return data, nil
 }
 
-func (r *OrdersRepository) GetAllOrders(user_id int) ([]domain.Orders, error) {
-	ctx := context.Background()
+func (r *OrdersRepository) GetAllOrders(ctx context.Context, user_id int) ([]domain.Orders, error) {
 	var orders []domain.Orders
-	err := r.DB.WithContext(ctx).Where("user_id=?", user_id).Find(&orders).Error
+	err := dbWithContext(ctx, r.DB).Preload("Items").Where("user_id=?", user_id).Find(&orders).Error
 	if err != nil {
 		return nil, err
 	}
@@ -39,10 +53,9 @@ func (r *OrdersRepository) GetAllOrders(user_id int) ([]domain.Orders, error) {
 	return orders, nil
 }
 
-func (r *OrdersRepository) GetOrder(order_id, user_id int) (domain.Orders, error) {
-	ctx := context.Background()
+func (r *OrdersRepository) GetOrder(ctx context.Context, order_id, user_id int) (domain.Orders, error) {
 	var order domain.Orders
-	err := r.DB.WithContext(ctx).Where("id=?", order_id).Where("user_id=?", user_id).First(&order).Error
+	err := dbWithContext(ctx, r.DB).Preload("Items").Where("id=?", order_id).Where("user_id=?", user_id).First(&order).Error
 	if err != nil {
 		return domain.Orders{}, err
 	}
@@ -50,10 +63,10 @@ func (r *OrdersRepository) GetOrder(order_id, user_id int) (domain.Orders, error
 	return order, nil
 }
 
-func (r *OrdersRepository) GetOrderStatus(status string, user_id int) (domain.Orders, error) {
-	ctx := context.Background()
+// LockOrder is GetOrder with the order row locked until the transaction ends
+func (r *OrdersRepository) LockOrder(ctx context.Context, order_id, user_id int) (domain.Orders, error) {
 	var order domain.Orders
-	err := r.DB.WithContext(ctx).Where("order_status=?", status).Where("user_id=?", user_id).First(&order).Error
+	err := dbWithContext(ctx, r.DB).Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").Where("id=?", order_id).Where("user_id=?", user_id).First(&order).Error
 	if err != nil {
 		return domain.Orders{}, err
 	}
@@ -61,9 +74,30 @@ func (r *OrdersRepository) GetOrderStatus(status string, user_id int) (domain.Or
 	return order, nil
 }
 
-func (r *OrdersRepository) UpdateOrder(data domain.Orders) error {
-	ctx := context.Background()
-	row := r.DB.WithContext(ctx).Where("id=?", data.ID).Updates(&data)
+func (r *OrdersRepository) GetOrderByID(ctx context.Context, order_id int) (domain.Orders, error) {
+	var order domain.Orders
+	err := dbWithContext(ctx, r.DB).Preload("Items").Where("id=?", order_id).First(&order).Error
+	if err != nil {
+		return domain.Orders{}, err
+	}
+
+	return order, nil
+}
+
+func (r *OrdersRepository) GetOrderStatus(ctx context.Context, status string, user_id int) (domain.Orders, error) {
+	var order domain.Orders
+	err := dbWithContext(ctx, r.DB).Preload("Items").Where("order_status=?", status).Where("user_id=?", user_id).First(&order).Error
+	if err != nil {
+		return domain.Orders{}, err
+	}
+
+	return order, nil
+}
+
+func (r *OrdersRepository) UpdateOrder(ctx context.Context, data domain.Orders) error {
+	// Only the header is updated here, line items go through UpdateOrderItem
+	// and the status only changes through UpdateOrderStatus
+	row := dbWithContext(ctx, r.DB).Omit(clause.Associations, "order_status").Where("id=?", data.ID).Updates(&data)
 	if row.RowsAffected == 0 {
 		return errors.New("order_id not found")
 	}
@@ -74,11 +108,10 @@ func (r *OrdersRepository) UpdateOrder(data domain.Orders) error {
 	return nil
 }
 
-func (r *OrdersRepository) DeleteOrder(order_id, user_id int) error {
-	ctx := context.Background()
-	row := r.DB.WithContext(ctx).Where("id=?", order_id).Where("user_id=?", user_id).Delete(&domain.Orders{})
+func (r *OrdersRepository) UpdateOrderItem(ctx context.Context, data domain.OrderItem) error {
+	row := dbWithContext(ctx, r.DB).Where("id=?", data.ID).Where("order_id=?", data.OrderID).Updates(&data)
 	if row.RowsAffected == 0 {
-		return errors.New("order_id not found")
+		return errors.New("order item not found")
 	}
 	if err := row.Error; err != nil {
 		return err
@@ -86,3 +119,51 @@ func (r *OrdersRepository) DeleteOrder(order_id, user_id int) error {
 
 	return nil
 }
+
+// UpdateOrderStatus saves the new order status together with its history
+// entry. The update only applies while the order is still in the history's
+// from status, so two concurrent status changes cannot both win.
+func (r *OrdersRepository) UpdateOrderStatus(ctx context.Context, data domain.Orders, history domain.OrderStatusHistory) error {
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		row := tx.Model(&domain.Orders{}).Where("id=?", data.ID).Where("order_status=?", history.FromStatus).Updates(map[string]interface{}{
+			"order_status":   data.OrderStatus,
+			"payment_method": data.PaymentMethod,
+			"updated_at":     data.UpdatedAt,
+		})
+		if err := row.Error; err != nil {
+			return err
+		}
+		if row.RowsAffected == 0 {
+			return fmt.Errorf("order %d not found or no longer %s", data.ID, history.FromStatus)
+		}
+
+		return tx.Create(&history).Error
+	})
+}
+
+// GetStaleOrders returns orders in the given status that have not changed since before, oldest first
+func (r *OrdersRepository) GetStaleOrders(ctx context.Context, status domain.OrderStatus, before time.Time, limit int) ([]domain.Orders, error) {
+	var orders []domain.Orders
+	err := dbWithContext(ctx, r.DB).
+		Preload("Items").
+		Where("order_status=?", status).
+		Where("updated_at < ?", before).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *OrdersRepository) GetStatusHistory(ctx context.Context, order_id int) ([]domain.OrderStatusHistory, error) {
+	var history []domain.OrderStatusHistory
+	err := dbWithContext(ctx, r.DB).Where("order_id=?", order_id).Order("created_at, id").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"myGreenMarket/domain"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentsRepository struct {
@@ -18,9 +20,8 @@ func NewPaymentsRepository(db *gorm.DB) *PaymentsRepository {
 	}
 }
 
-func (r *PaymentsRepository) CreatePayment(data domain.Payments) (domain.Payments, error) {
-	ctx := context.Background()
-	err := r.DB.WithContext(ctx).Create(&data).Error
+func (r *PaymentsRepository) CreatePayment(ctx context.Context, data domain.Payments) (domain.Payments, error) {
+	err := dbWithContext(ctx, r.DB).Create(&data).Error
 	if err != nil {
 		return domain.Payments{}, err
 	}
@@ -28,10 +29,9 @@ func (r *PaymentsRepository) CreatePayment(data domain.Payments) (domain.Payment
 	return data, nil
 }
 
-func (r *PaymentsRepository) GetAllPayments(user_id int) ([]domain.Payments, error) {
-	ctx := context.Background()
+func (r *PaymentsRepository) GetAllPayments(ctx context.Context, user_id int) ([]domain.Payments, error) {
 	var payments []domain.Payments
-	err := r.DB.WithContext(ctx).Where("user_id=?", user_id).Find(&payments).Error
+	err := dbWithContext(ctx, r.DB).Where("user_id=?", user_id).Find(&payments).Error
 	if err != nil {
 		return nil, err
 	}
@@ -39,10 +39,9 @@ func (r *PaymentsRepository) GetAllPayments(user_id int) ([]domain.Payments, err
 	return payments, nil
 }
 
-func (r *PaymentsRepository) GetPayment(payment_id, user_id int) (domain.Payments, error) {
-	ctx := context.Background()
+func (r *PaymentsRepository) GetPayment(ctx context.Context, payment_id, user_id int) (domain.Payments, error) {
 	var payment domain.Payments
-	err := r.DB.WithContext(ctx).Where("payments.id=?", payment_id).Where("user_id=?", user_id).First(&payment).Error
+	err := dbWithContext(ctx, r.DB).Where("payments.id=?", payment_id).Where("user_id=?", user_id).First(&payment).Error
 	if err != nil {
 		return domain.Payments{}, err
 	}
@@ -50,9 +49,94 @@ func (r *PaymentsRepository) GetPayment(payment_id, user_id int) (domain.Payment
 	return payment, nil
 }
 
-func (r *PaymentsRepository) UpdatePayment(data domain.Payments) error {
-	ctx := context.Background()
-	row := r.DB.WithContext(ctx).Where("id=?", data.ID).Updates(data)
+func (r *PaymentsRepository) GetPaymentByID(ctx context.Context, payment_id int) (domain.Payments, error) {
+	var payment domain.Payments
+	err := dbWithContext(ctx, r.DB).Where("payments.id=?", payment_id).First(&payment).Error
+	if err != nil {
+		return domain.Payments{}, err
+	}
+
+	return payment, nil
+}
+
+func (r *PaymentsRepository) GetPaymentsByOrderID(ctx context.Context, order_id int) ([]domain.Payments, error) {
+	var payments []domain.Payments
+	err := dbWithContext(ctx, r.DB).Where("order_id=?", order_id).Order("created_at, id").Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// LockPaymentByID reads the payment with FOR UPDATE, settling a payment holds
+// this lock so a webhook and a reconciliation cannot both apply it
+func (r *PaymentsRepository) LockPaymentByID(ctx context.Context, payment_id int) (domain.Payments, error) {
+	var payment domain.Payments
+	err := dbWithContext(ctx, r.DB).Clauses(clause.Locking{Strength: "UPDATE"}).Where("payments.id=?", payment_id).First(&payment).Error
+	if err != nil {
+		return domain.Payments{}, err
+	}
+
+	return payment, nil
+}
+
+// GetPendingPayments returns PENDING order and top up payments created before
+// the given time, oldest first. Refunds have no invoice to check.
+func (r *PaymentsRepository) GetPendingPayments(ctx context.Context, before time.Time, limit int) ([]domain.Payments, error) {
+	var payments []domain.Payments
+	err := dbWithContext(ctx, r.DB).
+		Where("payment_status=?", "PENDING").
+		Where("payment_type IN ?", []string{"ORDER", "TOPUP"}).
+		Where("created_at < ?", before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// GetPendingRefunds returns PENDING refunds created before the given time, oldest first
+func (r *PaymentsRepository) GetPendingRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Payments, error) {
+	var payments []domain.Payments
+	err := dbWithContext(ctx, r.DB).
+		Where("payment_status=?", "PENDING").
+		Where("payment_type=?", "REFUND").
+		Where("created_at < ?", before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// GetOverduePayments returns PENDING order and top up payments whose invoice
+// expired before now. Payments without a stored expiry count as overdue once created before
+// legacyBefore.
+func (r *PaymentsRepository) GetOverduePayments(ctx context.Context, now, legacyBefore time.Time, limit int) ([]domain.Payments, error) {
+	var payments []domain.Payments
+	err := dbWithContext(ctx, r.DB).
+		Where("payment_status=?", "PENDING").
+		Where("payment_type IN ?", []string{"ORDER", "TOPUP"}).
+		Where("(invoice_expires_at IS NOT NULL AND invoice_expires_at < ?) OR (invoice_expires_at IS NULL AND created_at < ?)", now, legacyBefore).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (r *PaymentsRepository) UpdatePayment(ctx context.Context, data domain.Payments) error {
+	row := dbWithContext(ctx, r.DB).Where("id=?", data.ID).Updates(data)
 	if err := row.Error; err != nil {
 		return err
 	}
@@ -64,9 +148,8 @@ func (r *PaymentsRepository) UpdatePayment(data domain.Payments) error {
 	return nil
 }
 
-func (r *PaymentsRepository) DeletePayment(payment_id int) error {
-	ctx := context.Background()
-	row := r.DB.WithContext(ctx).Where("id=?", payment_id).Delete(&domain.Payments{})
+func (r *PaymentsRepository) DeletePayment(ctx context.Context, payment_id int) error {
+	row := dbWithContext(ctx, r.DB).Where("id=?", payment_id).Delete(&domain.Payments{})
 
 	if err := row.Error; err != nil {
 		return err
@@ -79,10 +162,9 @@ func (r *PaymentsRepository) DeletePayment(payment_id int) error {
 	return nil
 }
 
-func (r *PaymentsRepository) GetPaymentByOrderID(order_id int) (domain.Payments, error) {
-	ctx := context.Background()
+func (r *PaymentsRepository) GetPaymentByOrderID(ctx context.Context, order_id int) (domain.Payments, error) {
 	var payment domain.Payments
-	err := r.DB.WithContext(ctx).Where("order_id=?", order_id).First(&payment).Error
+	err := dbWithContext(ctx, r.DB).Where("order_id=?", order_id).First(&payment).Error
 	if err != nil {
 		return domain.Payments{}, err
 	}
@@ -7,6 +7,7 @@ import (
 	"myGreenMarket/domain"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepository struct {
@@ -19,16 +20,26 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	}
 }
 
-func (r *ProductRepository) Create(ctx context.Context, product *domain.Product) error {
+// Create saves the product, its starting quantity is recorded as a restock
+func (r *ProductRepository) Create(ctx context.Context, product *domain.Product, actor string) error {
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("context error: %w", err)
 	}
 
-	if err := r.DB.WithContext(ctx).Create(product).Error; err != nil {
-		return fmt.Errorf("failed to create product: %w", err)
-	}
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return fmt.Errorf("failed to create product: %w", err)
+		}
+		if product.Quantity == 0 {
+			return nil
+		}
 
-	return nil
+		return recordMovement(tx, domain.InventoryMovement{
+			Reason: domain.MovementReasonRestock,
+			Actor:  actor,
+			Note:   "starting stock",
+		}, int(product.ID), product.Quantity, nil)
+	})
 }
 
 func (r *ProductRepository) FindByID(ctx context.Context, id uint64) (domain.Product, error) {
@@ -38,7 +49,7 @@ func (r *ProductRepository) FindByID(ctx context.Context, id uint64) (domain.Pro
 
 	var product domain.Product
 
-	err := r.DB.WithContext(ctx).First(&product, id).Error
+	err := dbWithContext(ctx, r.DB).First(&product, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.Product{}, errors.New("product not found")
@@ -49,18 +60,86 @@ func (r *ProductRepository) FindByID(ctx context.Context, id uint64) (domain.Pro
 	return product, nil
 }
 
-func (r *ProductRepository) FindAll(ctx context.Context) ([]domain.Product, error) {
+// effectivePrice is what a product is on sale for, see domain.ProductQuery
+const effectivePrice = "CASE WHEN products.sale_price > 0 THEN products.sale_price ELSE products.normal_price END"
+
+// earliestExpiry is when the product's first open batch with stock left expires
+const earliestExpiry = "(SELECT MIN(b.expires_at) FROM stock_batches b WHERE b.product_id = products.id AND b.written_off_at IS NULL AND b.remaining > 0)"
+
+// FindAll returns the page of products the query asks for and how many
+// products match it in total
+func (r *ProductRepository) FindAll(ctx context.Context, query domain.ProductQuery) ([]domain.Product, int64, error) {
 	if err := ctx.Err(); err != nil {
-		return nil, fmt.Errorf("context error: %w", err)
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	db := dbWithContext(ctx, r.DB).Model(&domain.Product{})
+	if query.Search != "" {
+		db = db.Where("products.search_vector @@ plainto_tsquery('simple', ?)", query.Search)
+	}
+	if query.Category != "" {
+		db = db.Where("products.product_category = ?", query.Category)
+	}
+	if query.CategoryID != nil {
+		db = db.Where(`products.category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT category_id FROM categories WHERE category_id = ?
+				UNION ALL
+				SELECT c.category_id FROM categories c JOIN subtree s ON c.parent_id = s.category_id
+			)
+			SELECT category_id FROM subtree)`, *query.CategoryID)
+	}
+	if query.GreenTagOnly {
+		db = db.Where("products.is_green_tag = ?", true)
+	}
+	if query.MinPrice != nil {
+		db = db.Where(effectivePrice+" >= ?", *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		db = db.Where(effectivePrice+" <= ?", *query.MaxPrice)
+	}
+	if query.MinDiscount > 0 {
+		db = db.Where("products.discount >= ?", query.MinDiscount)
+	}
+	if query.InStockOnly {
+		db = db.Where("products.quantity > 0")
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count products: %w", err)
 	}
 
+	switch query.Sort {
+	case domain.ProductSortPriceAsc:
+		db = db.Order(effectivePrice + " ASC")
+	case domain.ProductSortPriceDesc:
+		db = db.Order(effectivePrice + " DESC")
+	case domain.ProductSortDiscount:
+		db = db.Order("products.discount DESC")
+	case domain.ProductSortExpiry:
+		db = db.Order(earliestExpiry + " ASC NULLS LAST")
+	case domain.ProductSortNewest:
+		db = db.Order("products.created_at DESC")
+	default:
+		if query.Search != "" {
+			db = db.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:  "ts_rank(products.search_vector, plainto_tsquery('simple', ?)) DESC",
+				Vars: []interface{}{query.Search},
+			}})
+		} else {
+			db = db.Order("products.created_at DESC")
+		}
+	}
+
+	// id breaks ties, so a product never shows on two pages
 	var products []domain.Product
-	err := r.DB.WithContext(ctx).Find(&products).Error
+	err := db.Order("products.id DESC").Offset(query.Offset).Limit(query.Limit).Find(&products).Error
 	if err != nil {
-		return nil, fmt.Errorf("failed to find Products: %w", err)
+		return nil, 0, fmt.Errorf("failed to find Products: %w", err)
 	}
 
-	return products, nil
+	return products, total, nil
 }
 
 func (r *ProductRepository) Update(ctx context.Context, product *domain.Product) error {
@@ -68,21 +147,22 @@ func (r *ProductRepository) Update(ctx context.Context, product *domain.Product)
 		return fmt.Errorf("context error: %w", err)
 	}
 
-	// Update semua field yang bisa diubah
+	// Update semua field yang bisa diubah, stok hanya lewat stock adjustment
 	updateData := map[string]interface{}{
-		"product_id":       product.ProductID,
-		"product_skuid":    product.ProductSKUID,
-		"is_green_tag":     product.IsGreenTag,
-		"product_name":     product.ProductName,
-		"product_category": product.ProductCategory,
-		"unit":             product.Unit,
-		"normal_price":     product.NormalPrice,
-		"sale_price":       product.SalePrice,
-		"discount":         product.Discount,
-		"quantity":         product.Quantity,
-	}
-
-	result := r.DB.WithContext(ctx).Model(&domain.Product{}).Where("id = ?", product.ID).Updates(updateData)
+		"product_id":        product.ProductID,
+		"product_skuid":     product.ProductSKUID,
+		"is_green_tag":      product.IsGreenTag,
+		"product_name":      product.ProductName,
+		"product_category":  product.ProductCategory,
+		"category_id":       product.CategoryID,
+		"unit":              product.Unit,
+		"normal_price":      product.NormalPrice,
+		"sale_price":        product.SalePrice,
+		"discount":          product.Discount,
+		"reorder_threshold": product.ReorderThreshold,
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.Product{}).Where("id = ?", product.ID).Updates(updateData)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update product: %w", result.Error)
 	}
@@ -98,7 +178,7 @@ func (r *ProductRepository) Delete(ctx context.Context, id uint64) error {
 		return fmt.Errorf("context error: %w", err)
 	}
 
-	result := r.DB.WithContext(ctx).Delete(&domain.Product{}, id)
+	result := dbWithContext(ctx, r.DB).Delete(&domain.Product{}, id)
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete product: %w", result.Error)
 	}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PromotionRepository struct {
+	DB *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) *PromotionRepository {
+	return &PromotionRepository{
+		DB: db,
+	}
+}
+
+func (r *PromotionRepository) Create(ctx context.Context, promotion *domain.Promotion) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(promotion).Error; err != nil {
+		return fmt.Errorf("failed to create promotion: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PromotionRepository) FindAll(ctx context.Context) ([]domain.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var promotions []domain.Promotion
+	err := dbWithContext(ctx, r.DB).Order("starts_at DESC, id DESC").Find(&promotions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// FindActive returns the promotions running at the given time
+func (r *PromotionRepository) FindActive(ctx context.Context, at time.Time) ([]domain.Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var promotions []domain.Promotion
+	err := dbWithContext(ctx, r.DB).
+		Where("starts_at <= ?", at).
+		Where("ends_at IS NULL OR ends_at > ?", at).
+		Find(&promotions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+func (r *PromotionRepository) Delete(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Where("id = ?", id).Delete(&domain.Promotion{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete promotion: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("promotion not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/domain"
+
+	"gorm.io/gorm"
+)
+
+type ReconciliationRepository struct {
+	DB *gorm.DB
+}
+
+func NewReconciliationRepository(db *gorm.DB) *ReconciliationRepository {
+	return &ReconciliationRepository{
+		DB: db,
+	}
+}
+
+func (r *ReconciliationRepository) Create(ctx context.Context, report domain.ReconciliationReport) (domain.ReconciliationReport, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.ReconciliationReport{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Create(&report).Error; err != nil {
+		return domain.ReconciliationReport{}, fmt.Errorf("failed to create reconciliation report: %w", err)
+	}
+
+	return report, nil
+}
+
+func (r *ReconciliationRepository) FindAll(ctx context.Context, limit, offset int) ([]domain.ReconciliationReport, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	query := dbWithContext(ctx, r.DB).Model(&domain.ReconciliationReport{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count reconciliation reports: %w", err)
+	}
+
+	var reports []domain.ReconciliationReport
+	err := query.Order("started_at DESC, id DESC").Limit(limit).Offset(offset).Find(&reports).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find reconciliation reports: %w", err)
+	}
+
+	return reports, total, nil
+}
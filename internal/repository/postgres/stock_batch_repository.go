@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockBatchRepository struct {
+	DB *gorm.DB
+}
+
+func NewStockBatchRepository(db *gorm.DB) *StockBatchRepository {
+	return &StockBatchRepository{
+		DB: db,
+	}
+}
+
+// Receive records the batch with all of it remaining and adds its quantity
+// to products.quantity
+func (r *StockBatchRepository) Receive(ctx context.Context, batch *domain.StockBatch, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	batch.Remaining = batch.Quantity
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return fmt.Errorf("failed to create stock batch: %w", err)
+		}
+
+		if err := addStock(tx, int(batch.ProductID), batch.Quantity); err != nil {
+			return err
+		}
+
+		return recordMovement(tx, domain.InventoryMovement{
+			Reason: domain.MovementReasonRestock,
+			Actor:  actor,
+		}, int(batch.ProductID), batch.Quantity, &batch.ID)
+	})
+}
+
+func (r *StockBatchRepository) FindOpenByProductID(ctx context.Context, productID uint64) ([]domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var batches []domain.StockBatch
+	err := dbWithContext(ctx, r.DB).
+		Where("product_id = ? AND written_off_at IS NULL", productID).
+		Order("expires_at, id").
+		Find(&batches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock batches: %w", err)
+	}
+
+	return batches, nil
+}
+
+// Adjust corrects the expiry or cost of a batch of the product
+func (r *StockBatchRepository) Adjust(ctx context.Context, productID, batchID uint64, adjustment domain.BatchAdjustment) (domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.StockBatch{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var batch domain.StockBatch
+	err := dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND product_id = ?", batchID, productID).
+			First(&batch).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("stock batch not found")
+			}
+			return fmt.Errorf("failed to find stock batch: %w", err)
+		}
+		if batch.WrittenOffAt != nil {
+			return errors.New("stock batch has been written off")
+		}
+
+		updates := map[string]interface{}{}
+		if adjustment.ExpiresAt != nil {
+			updates["expires_at"] = *adjustment.ExpiresAt
+			batch.ExpiresAt = *adjustment.ExpiresAt
+		}
+		if adjustment.CostPrice != nil {
+			updates["cost_price"] = *adjustment.CostPrice
+			batch.CostPrice = *adjustment.CostPrice
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&domain.StockBatch{}).Where("id = ?", batch.ID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to adjust stock batch: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return domain.StockBatch{}, err
+	}
+
+	return batch, nil
+}
+
+// FindExpiring returns open batches with stock left that expire before the
+// given time, soonest first
+func (r *StockBatchRepository) FindExpiring(ctx context.Context, before time.Time) ([]domain.StockBatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var batches []domain.StockBatch
+	err := dbWithContext(ctx, r.DB).
+		Where("written_off_at IS NULL AND remaining > 0 AND expires_at < ?", before).
+		Order("expires_at, id").
+		Find(&batches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expiring stock batches: %w", err)
+	}
+
+	return batches, nil
+}
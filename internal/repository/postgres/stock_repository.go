@@ -0,0 +1,513 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"myGreenMarket/domain"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockRepository struct {
+	DB *gorm.DB
+}
+
+func NewStockRepository(db *gorm.DB) *StockRepository {
+	return &StockRepository{
+		DB: db,
+	}
+}
+
+// Reserve takes the quantity of every line out of products.quantity and
+// records a reservation for it. Either all lines are reserved or none are.
+func (r *StockRepository) Reserve(ctx context.Context, orderID int, items []domain.OrderItem, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	// Lock products in a stable order so concurrent checkouts cannot deadlock
+	lines := make([]domain.OrderItem, len(items))
+	copy(lines, items)
+	sort.Slice(lines, func(i, j int) bool { return lines[i].ProductID < lines[j].ProductID })
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, line := range lines {
+			allocations, err := takeStock(tx, line.ProductID, float64(line.Quantity), domain.InventoryMovement{
+				Reason:  domain.MovementReasonSale,
+				Actor:   actor,
+				OrderID: &orderID,
+			})
+			if err != nil {
+				return err
+			}
+
+			reservation := domain.StockReservation{
+				OrderID:   orderID,
+				ProductID: line.ProductID,
+				Quantity:  line.Quantity,
+				Status:    domain.ReservationStatusReserved,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := tx.Create(&reservation).Error; err != nil {
+				return fmt.Errorf("failed to create stock reservation: %w", err)
+			}
+			if err := saveAllocations(tx, reservation.ID, allocations); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Adjust changes the reserved quantity of one order line, taking or returning
+// only the difference
+func (r *StockRepository) Adjust(ctx context.Context, orderID, productID, quantity int, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var reservation domain.StockReservation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND product_id = ? AND status = ?", orderID, productID, domain.ReservationStatusReserved).
+			First(&reservation).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrNoActiveReservation
+			}
+			return fmt.Errorf("failed to find stock reservation: %w", err)
+		}
+
+		delta := quantity - reservation.Quantity
+		switch {
+		case delta > 0:
+			allocations, err := takeStock(tx, productID, float64(delta), domain.InventoryMovement{
+				Reason:  domain.MovementReasonSale,
+				Actor:   actor,
+				OrderID: &orderID,
+			})
+			if err != nil {
+				return err
+			}
+			if err := saveAllocations(tx, reservation.ID, allocations); err != nil {
+				return err
+			}
+		case delta < 0:
+			err := returnReserved(tx, reservation, float64(-delta), domain.InventoryMovement{
+				Reason:  domain.MovementReasonRelease,
+				Actor:   actor,
+				OrderID: &orderID,
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		return tx.Model(&domain.StockReservation{}).Where("id = ?", reservation.ID).Updates(map[string]interface{}{
+			"quantity":   quantity,
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+// Commit marks the order's reservations as sold. Committing an order that was
+// already committed is a no-op.
+func (r *StockRepository) Commit(ctx context.Context, orderID int) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.StockReservation{}).
+		Where("order_id = ? AND status = ?", orderID, domain.ReservationStatusReserved).
+		Updates(map[string]interface{}{
+			"status":     domain.ReservationStatusCommitted,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to commit stock reservation: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var committed int64
+	err := dbWithContext(ctx, r.DB).Model(&domain.StockReservation{}).
+		Where("order_id = ? AND status = ?", orderID, domain.ReservationStatusCommitted).
+		Count(&committed).Error
+	if err != nil {
+		return fmt.Errorf("failed to check stock reservation: %w", err)
+	}
+	if committed == 0 {
+		return domain.ErrNoActiveReservation
+	}
+
+	return nil
+}
+
+// Release puts the quantity of the order's open reservations back on sale.
+// Releasing twice is safe, only RESERVED rows are touched.
+func (r *StockRepository) Release(ctx context.Context, orderID int, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var reservations []domain.StockReservation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND status = ?", orderID, domain.ReservationStatusReserved).
+			Order("product_id").
+			Find(&reservations).Error
+		if err != nil {
+			return fmt.Errorf("failed to find stock reservations: %w", err)
+		}
+
+		now := time.Now()
+		for _, reservation := range reservations {
+			err := returnReserved(tx, reservation, float64(reservation.Quantity), domain.InventoryMovement{
+				Reason:  domain.MovementReasonRelease,
+				Actor:   actor,
+				OrderID: &orderID,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&domain.StockReservation{}).Where("id = ?", reservation.ID).Updates(map[string]interface{}{
+				"status":     domain.ReservationStatusReleased,
+				"updated_at": now,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to release stock reservation: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Restock returns refunded quantity to products.quantity, and to the batches
+// the order's units were sold from. Reservations keep their quantity, the
+// sale they turned into stays on record.
+func (r *StockRepository) Restock(ctx context.Context, orderID int, items []domain.OrderItem, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	lines := make([]domain.OrderItem, len(items))
+	copy(lines, items)
+	sort.Slice(lines, func(i, j int) bool { return lines[i].ProductID < lines[j].ProductID })
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		for _, line := range lines {
+			var allocations []domain.StockAllocation
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Joins("JOIN stock_reservations ON stock_reservations.id = stock_reservation_batches.reservation_id").
+				Where("stock_reservations.order_id = ? AND stock_reservations.product_id = ? AND stock_reservations.status = ?",
+					orderID, line.ProductID, domain.ReservationStatusCommitted).
+				Order("stock_reservation_batches.id").
+				Find(&allocations).Error
+			if err != nil {
+				return fmt.Errorf("failed to find stock allocations: %w", err)
+			}
+
+			err = returnStock(tx, line.ProductID, float64(line.Quantity), allocations, domain.InventoryMovement{
+				Reason:  domain.MovementReasonReturn,
+				Actor:   actor,
+				OrderID: &orderID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// AdjustStock records a manual stock change, see domain.StockAdjustment, and
+// returns the product with its new quantity
+func (r *StockRepository) AdjustStock(ctx context.Context, adjustment domain.StockAdjustment, actor string) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, fmt.Errorf("context error: %w", err)
+	}
+
+	productID := int(adjustment.ProductID)
+	move := domain.InventoryMovement{
+		Reason: adjustment.Reason,
+		Actor:  actor,
+		Note:   adjustment.Note,
+	}
+
+	var product domain.Product
+	err := dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		switch {
+		case adjustment.BatchID != nil:
+			if err := adjustBatchStock(tx, productID, *adjustment.BatchID, adjustment.Quantity, move); err != nil {
+				return err
+			}
+		case adjustment.Quantity < 0:
+			if _, err := takeStock(tx, productID, -adjustment.Quantity, move); err != nil {
+				return err
+			}
+		default:
+			if err := returnStock(tx, productID, adjustment.Quantity, nil, move); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("id = ?", productID).First(&product).Error
+	})
+	if err != nil {
+		return domain.Product{}, err
+	}
+
+	return product, nil
+}
+
+// takeStock takes quantity off products.quantity, first from the open batches
+// that expire soonest and then from stock that predates batches. Expired
+// batches are never sold from. Checking and taking happen under row locks, so
+// two buyers can never both take the last unit. Every part taken is recorded
+// as a movement like move.
+func takeStock(tx *gorm.DB, productID int, quantity float64, move domain.InventoryMovement) ([]domain.StockAllocation, error) {
+	var product domain.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quantity").Where("id = ?", productID).First(&product).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrProductNotFound
+		}
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	var batches []domain.StockBatch
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND written_off_at IS NULL AND remaining > 0", productID).
+		Order("expires_at, id").
+		Find(&batches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock batches: %w", err)
+	}
+
+	allocations, untracked, err := allocateStock(product.Quantity, batches, quantity, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, allocation := range allocations {
+		err := tx.Model(&domain.StockBatch{}).Where("id = ?", allocation.BatchID).
+			Update("remaining", gorm.Expr("remaining - ?", allocation.Quantity)).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve batch stock: %w", err)
+		}
+		if err := recordMovement(tx, move, productID, -allocation.Quantity, &allocation.BatchID); err != nil {
+			return nil, err
+		}
+	}
+	if untracked > 0 {
+		if err := recordMovement(tx, move, productID, -untracked, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Model(&domain.Product{}).Where("id = ?", productID).
+		Update("quantity", gorm.Expr("quantity - ?", quantity)).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	return allocations, nil
+}
+
+// allocateStock works out where quantity is taken from: the open batches in
+// the given order, soonest expiry first, then stock that predates batches,
+// which is returned as untracked. onHand is products.quantity, it still counts
+// expired batches that were not written off yet.
+func allocateStock(onHand float64, batches []domain.StockBatch, quantity float64, now time.Time) ([]domain.StockAllocation, float64, error) {
+	available := onHand
+	for _, batch := range batches {
+		if batch.IsExpired(now) {
+			available -= batch.Remaining
+		}
+	}
+	if available < quantity {
+		return nil, 0, domain.ErrInsufficientStock
+	}
+
+	var allocations []domain.StockAllocation
+	need := quantity
+	for _, batch := range batches {
+		if need <= 0 {
+			break
+		}
+		if batch.IsExpired(now) || batch.Remaining <= 0 {
+			continue
+		}
+
+		take := math.Min(need, batch.Remaining)
+		allocations = append(allocations, domain.StockAllocation{BatchID: batch.ID, Quantity: take})
+		need -= take
+	}
+
+	return allocations, need, nil
+}
+
+// returnStock puts quantity back on products.quantity, refilling the given
+// allocations newest first. Units from a batch that has since been written
+// off are written off with it instead of going back on sale. Allocations
+// shrink by what they gave back. Every part returned is recorded as a
+// movement like move.
+func returnStock(tx *gorm.DB, productID int, quantity float64, allocations []domain.StockAllocation, move domain.InventoryMovement) error {
+	onSale := quantity
+	for i := len(allocations) - 1; i >= 0 && quantity > 0; i-- {
+		allocation := allocations[i]
+		back := math.Min(quantity, allocation.Quantity)
+		if back <= 0 {
+			continue
+		}
+
+		result := tx.Model(&domain.StockBatch{}).Where("id = ? AND written_off_at IS NULL", allocation.BatchID).
+			Update("remaining", gorm.Expr("remaining + ?", back))
+		if result.Error != nil {
+			return fmt.Errorf("failed to return batch stock: %w", result.Error)
+		}
+		if err := recordMovement(tx, move, productID, back, &allocation.BatchID); err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			err := tx.Model(&domain.StockBatch{}).Where("id = ?", allocation.BatchID).
+				Update("written_off_quantity", gorm.Expr("written_off_quantity + ?", back)).Error
+			if err != nil {
+				return fmt.Errorf("failed to write off returned stock: %w", err)
+			}
+			writeOff := move
+			writeOff.Reason = domain.MovementReasonWriteOff
+			writeOff.Note = "batch already written off"
+			if err := recordMovement(tx, writeOff, productID, -back, &allocation.BatchID); err != nil {
+				return err
+			}
+			onSale -= back
+		}
+
+		if err := tx.Model(&domain.StockAllocation{}).Where("id = ?", allocation.ID).
+			Update("quantity", gorm.Expr("quantity - ?", back)).Error; err != nil {
+			return fmt.Errorf("failed to update stock allocation: %w", err)
+		}
+		quantity -= back
+	}
+	if quantity > 0 {
+		if err := recordMovement(tx, move, productID, quantity, nil); err != nil {
+			return err
+		}
+	}
+
+	return addStock(tx, productID, onSale)
+}
+
+// addStock puts quantity on products.quantity. A product coming back in
+// stock has its back-in-stock subscriptions queued for notification.
+func addStock(tx *gorm.DB, productID int, quantity float64) error {
+	var product domain.Product
+	result := tx.Model(&product).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "quantity"}}}).
+		Where("id = ?", productID).
+		Update("quantity", gorm.Expr("quantity + ?", quantity))
+	if result.Error != nil {
+		return fmt.Errorf("failed to add stock: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrProductNotFound
+	}
+
+	if product.Quantity > 0 && product.Quantity-quantity <= 0 {
+		return markRestocked(tx, productID)
+	}
+
+	return nil
+}
+
+// adjustBatchStock moves quantity in or out of one open batch of the product
+func adjustBatchStock(tx *gorm.DB, productID int, batchID uint64, quantity float64, move domain.InventoryMovement) error {
+	var batch domain.StockBatch
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND product_id = ?", batchID, productID).
+		First(&batch).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("stock batch not found")
+		}
+		return fmt.Errorf("failed to find stock batch: %w", err)
+	}
+	if batch.WrittenOffAt != nil {
+		return errors.New("stock batch has been written off")
+	}
+	if quantity > 0 && batch.IsExpired(time.Now()) {
+		return errors.New("stock batch has expired")
+	}
+	if batch.Remaining+quantity < 0 {
+		return domain.ErrInsufficientStock
+	}
+
+	err = tx.Model(&domain.StockBatch{}).Where("id = ?", batch.ID).
+		Update("remaining", gorm.Expr("remaining + ?", quantity)).Error
+	if err != nil {
+		return fmt.Errorf("failed to adjust batch stock: %w", err)
+	}
+
+	if quantity > 0 {
+		if err := addStock(tx, productID, quantity); err != nil {
+			return err
+		}
+	} else {
+		result := tx.Model(&domain.Product{}).
+			Where("id = ? AND quantity + ? >= 0", productID, quantity).
+			Update("quantity", gorm.Expr("quantity + ?", quantity))
+		if result.Error != nil {
+			return fmt.Errorf("failed to adjust stock: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrInsufficientStock
+		}
+	}
+
+	return recordMovement(tx, move, productID, quantity, &batch.ID)
+}
+
+// returnReserved gives quantity of an open reservation back, to the batches
+// it was taken from
+func returnReserved(tx *gorm.DB, reservation domain.StockReservation, quantity float64, move domain.InventoryMovement) error {
+	var allocations []domain.StockAllocation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("reservation_id = ?", reservation.ID).
+		Order("id").
+		Find(&allocations).Error
+	if err != nil {
+		return fmt.Errorf("failed to find stock allocations: %w", err)
+	}
+
+	return returnStock(tx, reservation.ProductID, quantity, allocations, move)
+}
+
+func saveAllocations(tx *gorm.DB, reservationID int, allocations []domain.StockAllocation) error {
+	if len(allocations) == 0 {
+		return nil
+	}
+
+	for i := range allocations {
+		allocations[i].ReservationID = reservationID
+	}
+	if err := tx.Create(&allocations).Error; err != nil {
+		return fmt.Errorf("failed to save stock allocations: %w", err)
+	}
+
+	return nil
+}
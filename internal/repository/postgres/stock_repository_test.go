@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"errors"
+	"myGreenMarket/domain"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAllocateStock(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	batch := func(id uint64, remaining float64, expiresIn time.Duration) domain.StockBatch {
+		return domain.StockBatch{ID: id, Remaining: remaining, ExpiresAt: now.Add(expiresIn)}
+	}
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name          string
+		onHand        float64
+		batches       []domain.StockBatch
+		quantity      float64
+		want          []domain.StockAllocation
+		wantUntracked float64
+		wantErr       error
+	}{
+		{
+			name:          "no batches",
+			onHand:        10,
+			quantity:      4,
+			wantUntracked: 4,
+		},
+		{
+			name:     "soonest expiry first",
+			onHand:   10,
+			batches:  []domain.StockBatch{batch(1, 3, day), batch(2, 7, 5*day)},
+			quantity: 5,
+			want: []domain.StockAllocation{
+				{BatchID: 1, Quantity: 3},
+				{BatchID: 2, Quantity: 2},
+			},
+		},
+		{
+			name:          "then stock without a batch",
+			onHand:        10,
+			batches:       []domain.StockBatch{batch(1, 3, day)},
+			quantity:      5,
+			want:          []domain.StockAllocation{{BatchID: 1, Quantity: 3}},
+			wantUntracked: 2,
+		},
+		{
+			name:     "expired batch is skipped",
+			onHand:   10,
+			batches:  []domain.StockBatch{batch(1, 4, -time.Hour), batch(2, 6, day)},
+			quantity: 5,
+			want:     []domain.StockAllocation{{BatchID: 2, Quantity: 5}},
+		},
+		{
+			name:     "expired stock does not count as available",
+			onHand:   10,
+			batches:  []domain.StockBatch{batch(1, 4, -time.Hour), batch(2, 6, day)},
+			quantity: 7,
+			wantErr:  domain.ErrInsufficientStock,
+		},
+		{
+			name:     "batch expiring right now is expired",
+			onHand:   2,
+			batches:  []domain.StockBatch{batch(1, 2, 0)},
+			quantity: 1,
+			wantErr:  domain.ErrInsufficientStock,
+		},
+		{
+			name:     "fractional quantities",
+			onHand:   2.5,
+			batches:  []domain.StockBatch{batch(1, 0.75, day), batch(2, 1.75, 2*day)},
+			quantity: 1.25,
+			want: []domain.StockAllocation{
+				{BatchID: 1, Quantity: 0.75},
+				{BatchID: 2, Quantity: 0.5},
+			},
+		},
+		{
+			name:     "exactly what is on hand",
+			onHand:   3,
+			batches:  []domain.StockBatch{batch(1, 3, day)},
+			quantity: 3,
+			want:     []domain.StockAllocation{{BatchID: 1, Quantity: 3}},
+		},
+		{
+			name:     "more than on hand",
+			onHand:   3,
+			quantity: 4,
+			wantErr:  domain.ErrInsufficientStock,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, untracked, err := allocateStock(tt.onHand, tt.batches, tt.quantity, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("allocateStock() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("allocateStock() error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %+v, want %+v", got, tt.want)
+			}
+			if untracked != tt.wantUntracked {
+				t.Errorf("untracked = %v, want %v", untracked, tt.wantUntracked)
+			}
+		})
+	}
+}
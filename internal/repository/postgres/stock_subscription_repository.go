@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type StockSubscriptionRepository struct {
+	DB *gorm.DB
+}
+
+func NewStockSubscriptionRepository(db *gorm.DB) *StockSubscriptionRepository {
+	return &StockSubscriptionRepository{
+		DB: db,
+	}
+}
+
+// Create saves the subscription, or returns the customer's waiting one for
+// the product when there already is one
+func (r *StockSubscriptionRepository) Create(ctx context.Context, subscription *domain.StockSubscription) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	return dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("product_id = ? AND user_id = ? AND notified_at IS NULL", subscription.ProductID, subscription.UserID).
+			First(subscription).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to find stock subscription: %w", err)
+		}
+
+		if err := tx.Create(subscription).Error; err != nil {
+			return fmt.Errorf("failed to create stock subscription: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// FindDue returns up to limit subscriptions whose product came back in stock
+// and whose customer has not been told yet, longest waiting first, with their
+// user and product loaded. Products sold out again before their customers
+// were told are left until they are back.
+func (r *StockSubscriptionRepository) FindDue(ctx context.Context, limit int) ([]domain.StockSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var subscriptions []domain.StockSubscription
+	err := dbWithContext(ctx, r.DB).
+		Preload("User").
+		Preload("Product").
+		Joins("JOIN products ON products.id = stock_subscriptions.product_id AND products.quantity > 0").
+		Where("stock_subscriptions.restocked_at IS NOT NULL AND stock_subscriptions.notified_at IS NULL").
+		Order("stock_subscriptions.restocked_at, stock_subscriptions.id").
+		Limit(limit).
+		Find(&subscriptions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due stock subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (r *StockSubscriptionRepository) MarkNotified(ctx context.Context, id uint64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	err := dbWithContext(ctx, r.DB).Model(&domain.StockSubscription{}).
+		Where("id = ?", id).
+		Update("notified_at", at).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark stock subscription notified: %w", err)
+	}
+
+	return nil
+}
+
+// markRestocked queues the product's waiting subscriptions for notification.
+// It is called in the same transaction as the stock change that brought the
+// product back, subscriptions already queued keep their place.
+func markRestocked(tx *gorm.DB, productID int) error {
+	err := tx.Model(&domain.StockSubscription{}).
+		Where("product_id = ? AND restocked_at IS NULL AND notified_at IS NULL", productID).
+		Update("restocked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to queue stock subscriptions: %w", err)
+	}
+
+	return nil
+}
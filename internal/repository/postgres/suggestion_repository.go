@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/domain"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// suggestThreshold is how alike a name has to be to the query, in pg_trgm
+// word similarity, to be suggested. pg_trgm's default of 0.6 misses one
+// letter typos in short words such as "bayem" for "bayam".
+const suggestThreshold = 0.3
+
+type SuggestionRepository struct {
+	DB *gorm.DB
+}
+
+func NewSuggestionRepository(db *gorm.DB) *SuggestionRepository {
+	return &SuggestionRepository{
+		DB: db,
+	}
+}
+
+// Suggest returns up to limit product and category names starting with or
+// resembling q, best match first. Highlighted is left for the caller.
+func (r *SuggestionRepository) Suggest(ctx context.Context, q string, limit int) ([]domain.Suggestion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	args := map[string]interface{}{
+		"q":      q,
+		"prefix": likeEscaper.Replace(q) + "%",
+		"limit":  limit,
+	}
+
+	var suggestions []domain.Suggestion
+	err := dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		// SET LOCAL only lasts until the transaction ends
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %v", suggestThreshold)).Error; err != nil {
+			return err
+		}
+
+		return tx.Raw(`
+			SELECT kind, id, text, score FROM (
+				SELECT 'product' AS kind, id, product_name AS text,
+					CASE WHEN product_name ILIKE @prefix THEN 1 ELSE word_similarity(@q, product_name) END AS score
+				FROM products
+				WHERE product_name ILIKE @prefix OR @q <% product_name
+				UNION ALL
+				SELECT 'category' AS kind, category_id AS id, product_category AS text,
+					CASE WHEN product_category ILIKE @prefix THEN 1 ELSE word_similarity(@q, product_category) END AS score
+				FROM categories
+				WHERE product_category ILIKE @prefix OR @q <% product_category
+			) matches
+			ORDER BY score DESC, length(text), text
+			LIMIT @limit`, args).Scan(&suggestions).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// RecordMiss counts a query that found nothing
+func (r *SuggestionRepository) RecordMiss(ctx context.Context, q string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	err := dbWithContext(ctx, r.DB).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "query"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":        gorm.Expr("search_misses.count + 1"),
+			"last_seen_at": at,
+		}),
+	}).Create(&domain.SearchMiss{
+		Query:       q,
+		Count:       1,
+		FirstSeenAt: at,
+		LastSeenAt:  at,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record search miss: %w", err)
+	}
+
+	return nil
+}
+
+// FindMisses returns a page of missed queries, most asked first, and how
+// many there are in total
+func (r *SuggestionRepository) FindMisses(ctx context.Context, offset, limit int) ([]domain.SearchMiss, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	var total int64
+	if err := dbWithContext(ctx, r.DB).Model(&domain.SearchMiss{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search misses: %w", err)
+	}
+
+	var misses []domain.SearchMiss
+	err := dbWithContext(ctx, r.DB).
+		Order("count DESC, last_seen_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&misses).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find search misses: %w", err)
+	}
+
+	return misses, total, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -20,7 +20,7 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
-	if err := r.DB.WithContext(ctx).Create(&user).Error; err != nil {
+	if err := dbWithContext(ctx, r.DB).Create(&user).Error; err != nil {
 		return err
 	}
 
@@ -30,7 +30,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 func (r *UserRepository) FindByID(ctx context.Context, id uint) (domain.User, error) {
 	var user domain.User
 
-	err := r.DB.WithContext(ctx).First(&user, id).Error
+	err := dbWithContext(ctx, r.DB).First(&user, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.User{}, errors.New("user not found")
@@ -44,7 +44,7 @@ func (r *UserRepository) FindByID(ctx context.Context, id uint) (domain.User, er
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (domain.User, error) {
 	var user domain.User
 
-	err := r.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	err := dbWithContext(ctx, r.DB).Where("email = ?", email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.User{}, errors.New("user not found")
@@ -58,7 +58,7 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (domain.
 func (r *UserRepository) FindAll(ctx context.Context) ([]domain.User, error) {
 	var users []domain.User
 
-	if err := r.DB.WithContext(ctx).Find(&users).Error; err != nil {
+	if err := dbWithContext(ctx, r.DB).Find(&users).Error; err != nil {
 		return nil, err
 	}
 
@@ -67,7 +67,7 @@ func (r *UserRepository) FindAll(ctx context.Context) ([]domain.User, error) {
 
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 	var existingUser domain.User
-	if err := r.DB.WithContext(ctx).First(&existingUser, user.ID).Error; err != nil {
+	if err := dbWithContext(ctx, r.DB).First(&existingUser, user.ID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("user not found")
 		}
@@ -76,7 +76,8 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 
 	user.UpdatedAt = time.Now()
 
-	if err := r.DB.WithContext(ctx).Save(&user).Error; err != nil {
+	// The wallet balance is owned by the wallet ledger, see WalletRepository.Post
+	if err := dbWithContext(ctx, r.DB).Omit("wallet").Save(&user).Error; err != nil {
 		return err
 	}
 
@@ -84,7 +85,7 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 }
 
 func (r *UserRepository) Delete(ctx context.Context, id uint) error {
-	result := r.DB.WithContext(ctx).Delete(&domain.User{}, id)
+	result := dbWithContext(ctx, r.DB).Delete(&domain.User{}, id)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -97,7 +98,7 @@ func (r *UserRepository) Delete(ctx context.Context, id uint) error {
 }
 
 func (r *UserRepository) UpdateEmailVerification(ctx context.Context, id uint, isVerified bool) error {
-	result := r.DB.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("is_verified", isVerified)
+	result := dbWithContext(ctx, r.DB).Model(&domain.User{}).Where("id = ?", id).Update("is_verified", isVerified)
 
 	if result.Error != nil {
 		return result.Error
@@ -109,3 +110,15 @@ func (r *UserRepository) UpdateEmailVerification(ctx context.Context, id uint, i
 
 	return nil
 }
+
+// FindByRole returns the users with the role, compared case-insensitively
+// like AdminOnly does
+func (r *UserRepository) FindByRole(ctx context.Context, role string) ([]domain.User, error) {
+	var users []domain.User
+
+	if err := dbWithContext(ctx, r.DB).Where("UPPER(role) = UPPER(?)", role).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WalletRepository struct {
+	DB *gorm.DB
+}
+
+func NewWalletRepository(db *gorm.DB) *WalletRepository {
+	return &WalletRepository{
+		DB: db,
+	}
+}
+
+// Post moves money in or out of a customer's wallet. The cached users.wallet
+// balance is changed with a conditional update so concurrent debits can never
+// take it below zero, and both ledger legs are written in the same transaction.
+func (r *WalletRepository) Post(ctx context.Context, posting domain.WalletPosting) (domain.WalletLedgerEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.WalletLedgerEntry{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if !posting.Amount.IsPositive() {
+		return domain.WalletLedgerEntry{}, errors.New("amount must be greater than 0")
+	}
+
+	var contraDirection string
+	switch posting.Direction {
+	case domain.WalletDirectionCredit:
+		contraDirection = domain.WalletDirectionDebit
+	case domain.WalletDirectionDebit:
+		contraDirection = domain.WalletDirectionCredit
+	default:
+		return domain.WalletLedgerEntry{}, fmt.Errorf("unknown wallet direction %s", posting.Direction)
+	}
+
+	var entry domain.WalletLedgerEntry
+	err := dbWithContext(ctx, r.DB).Transaction(func(tx *gorm.DB) error {
+		var result *gorm.DB
+		if posting.Direction == domain.WalletDirectionDebit {
+			result = tx.Model(&domain.User{}).
+				Where("id = ? AND wallet >= ?", posting.UserID, posting.Amount).
+				Update("wallet", gorm.Expr("wallet - ?", posting.Amount))
+		} else {
+			result = tx.Model(&domain.User{}).
+				Where("id = ?", posting.UserID).
+				Update("wallet", gorm.Expr("wallet + ?", posting.Amount))
+		}
+		if result.Error != nil {
+			return fmt.Errorf("failed to update wallet balance: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			if posting.Direction == domain.WalletDirectionDebit {
+				return domain.ErrInsufficientBalance
+			}
+			return errors.New("user not found")
+		}
+
+		var balance domain.Money
+		if err := tx.Model(&domain.User{}).Where("id = ?", posting.UserID).Select("wallet").Row().Scan(&balance); err != nil {
+			return fmt.Errorf("failed to read wallet balance: %w", err)
+		}
+
+		transactionID, err := newTransactionID()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		userID := posting.UserID
+		entry = domain.WalletLedgerEntry{
+			TransactionID: transactionID,
+			Account:       fmt.Sprintf("user:%d", posting.UserID),
+			UserID:        &userID,
+			Direction:     posting.Direction,
+			EntryType:     posting.EntryType,
+			Amount:        posting.Amount,
+			BalanceAfter:  &balance,
+			Reference:     posting.Reference,
+			Description:   posting.Description,
+			CreatedBy:     posting.CreatedBy,
+			CreatedAt:     now,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("failed to create ledger entry: %w", err)
+		}
+
+		contra := domain.WalletLedgerEntry{
+			TransactionID: transactionID,
+			Account:       posting.ContraAccount,
+			Direction:     contraDirection,
+			EntryType:     posting.EntryType,
+			Amount:        posting.Amount,
+			Reference:     posting.Reference,
+			Description:   posting.Description,
+			CreatedBy:     posting.CreatedBy,
+			CreatedAt:     now,
+		}
+		if err := tx.Create(&contra).Error; err != nil {
+			return fmt.Errorf("failed to create ledger entry: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return domain.WalletLedgerEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// Transfer writes a DEBIT on the from account and a CREDIT on the to account
+func (r *WalletRepository) Transfer(ctx context.Context, transfer domain.LedgerTransfer) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	if !transfer.Amount.IsPositive() {
+		return errors.New("amount must be greater than 0")
+	}
+
+	transactionID, err := newTransactionID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	legs := []domain.WalletLedgerEntry{
+		{
+			TransactionID: transactionID,
+			Account:       transfer.FromAccount,
+			Direction:     domain.WalletDirectionDebit,
+			EntryType:     transfer.EntryType,
+			Amount:        transfer.Amount,
+			Reference:     transfer.Reference,
+			Description:   transfer.Description,
+			CreatedBy:     transfer.CreatedBy,
+			CreatedAt:     now,
+		},
+		{
+			TransactionID: transactionID,
+			Account:       transfer.ToAccount,
+			Direction:     domain.WalletDirectionCredit,
+			EntryType:     transfer.EntryType,
+			Amount:        transfer.Amount,
+			Reference:     transfer.Reference,
+			Description:   transfer.Description,
+			CreatedBy:     transfer.CreatedBy,
+			CreatedAt:     now,
+		},
+	}
+	if err := dbWithContext(ctx, r.DB).Create(&legs).Error; err != nil {
+		return fmt.Errorf("failed to create ledger entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *WalletRepository) FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.WalletLedgerEntry, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	account := fmt.Sprintf("user:%d", userID)
+
+	var total int64
+	if err := dbWithContext(ctx, r.DB).Model(&domain.WalletLedgerEntry{}).Where("account = ?", account).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count ledger entries: %w", err)
+	}
+
+	var entries []domain.WalletLedgerEntry
+	err := dbWithContext(ctx, r.DB).
+		Where("account = ?", account).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&entries).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find ledger entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+func newTransactionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate transaction id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
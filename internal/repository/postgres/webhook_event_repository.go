@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookEventRepository struct {
+	DB *gorm.DB
+}
+
+func NewWebhookEventRepository(db *gorm.DB) *WebhookEventRepository {
+	return &WebhookEventRepository{
+		DB: db,
+	}
+}
+
+// Record stores the event unless the same event was already received, and
+// returns the stored row either way
+func (r *WebhookEventRepository) Record(ctx context.Context, event domain.WebhookEvent) (domain.WebhookEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.WebhookEvent{}, fmt.Errorf("context error: %w", err)
+	}
+
+	err := dbWithContext(ctx, r.DB).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "provider"}, {Name: "event_id"}, {Name: "event_status"}},
+			DoNothing: true,
+		}).
+		Create(&event).Error
+	if err != nil {
+		return domain.WebhookEvent{}, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+
+	var stored domain.WebhookEvent
+	err = dbWithContext(ctx, r.DB).
+		Where("provider = ? AND event_id = ? AND event_status = ?", event.Provider, event.EventID, event.EventStatus).
+		First(&stored).Error
+	if err != nil {
+		return domain.WebhookEvent{}, fmt.Errorf("failed to find webhook event: %w", err)
+	}
+
+	return stored, nil
+}
+
+func (r *WebhookEventRepository) FindByID(ctx context.Context, id uint64) (domain.WebhookEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.WebhookEvent{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var event domain.WebhookEvent
+	err := dbWithContext(ctx, r.DB).First(&event, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.WebhookEvent{}, errors.New("webhook event not found")
+		}
+		return domain.WebhookEvent{}, fmt.Errorf("failed to find webhook event: %w", err)
+	}
+
+	return event, nil
+}
+
+// LockByID loads the event with a row lock so concurrent deliveries of the
+// same event are processed one after the other. Must run in a transaction.
+func (r *WebhookEventRepository) LockByID(ctx context.Context, id uint64) (domain.WebhookEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.WebhookEvent{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var event domain.WebhookEvent
+	err := dbWithContext(ctx, r.DB).Clauses(clause.Locking{Strength: "UPDATE"}).First(&event, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.WebhookEvent{}, errors.New("webhook event not found")
+		}
+		return domain.WebhookEvent{}, fmt.Errorf("failed to lock webhook event: %w", err)
+	}
+
+	return event, nil
+}
+
+func (r *WebhookEventRepository) FindByStatus(ctx context.Context, status string, limit, offset int) ([]domain.WebhookEvent, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	query := dbWithContext(ctx, r.DB).Model(&domain.WebhookEvent{})
+	if status != "" {
+		query = query.Where("processing_status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook events: %w", err)
+	}
+
+	var events []domain.WebhookEvent
+	err := query.Order("received_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find webhook events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+func (r *WebhookEventRepository) MarkProcessed(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	now := time.Now()
+	result := dbWithContext(ctx, r.DB).Model(&domain.WebhookEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"processing_status": domain.WebhookEventProcessed,
+		"attempts":          gorm.Expr("attempts + 1"),
+		"last_error":        "",
+		"processed_at":      &now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook event: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("webhook event not found")
+	}
+
+	return nil
+}
+
+func (r *WebhookEventRepository) MarkFailed(ctx context.Context, id uint64, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	result := dbWithContext(ctx, r.DB).Model(&domain.WebhookEvent{}).
+		Where("id = ? AND processing_status <> ?", id, domain.WebhookEventProcessed).
+		Updates(map[string]interface{}{
+			"processing_status": domain.WebhookEventFailed,
+			"attempts":          gorm.Expr("attempts + 1"),
+			"last_error":        reason,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook event: %w", result.Error)
+	}
+
+	return nil
+}
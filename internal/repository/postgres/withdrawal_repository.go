@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WithdrawalRepository struct {
+	DB *gorm.DB
+}
+
+func NewWithdrawalRepository(db *gorm.DB) *WithdrawalRepository {
+	return &WithdrawalRepository{
+		DB: db,
+	}
+}
+
+func (r *WithdrawalRepository) Create(ctx context.Context, withdrawal domain.Withdrawal) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	if err := dbWithContext(ctx, r.DB).Omit("BankAccount").Create(&withdrawal).Error; err != nil {
+		return domain.Withdrawal{}, fmt.Errorf("failed to create withdrawal: %w", err)
+	}
+
+	return withdrawal, nil
+}
+
+func (r *WithdrawalRepository) Update(ctx context.Context, withdrawal domain.Withdrawal) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context error: %w", err)
+	}
+
+	withdrawal.UpdatedAt = time.Now()
+	err := dbWithContext(ctx, r.DB).Model(&domain.Withdrawal{}).Where("id = ?", withdrawal.ID).Updates(map[string]interface{}{
+		"status":          withdrawal.Status,
+		"gateway":         withdrawal.Gateway,
+		"disbursement_id": withdrawal.DisbursementID,
+		"failure_reason":  withdrawal.FailureReason,
+		"approved_by":     withdrawal.ApprovedBy,
+		"updated_at":      withdrawal.UpdatedAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update withdrawal: %w", err)
+	}
+
+	return nil
+}
+
+func (r *WithdrawalRepository) FindByID(ctx context.Context, id uint64) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var withdrawal domain.Withdrawal
+	err := r.withBankAccount(dbWithContext(ctx, r.DB)).First(&withdrawal, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Withdrawal{}, errors.New("withdrawal not found")
+		}
+		return domain.Withdrawal{}, fmt.Errorf("failed to find withdrawal: %w", err)
+	}
+
+	return withdrawal, nil
+}
+
+// LockByID loads the withdrawal with FOR UPDATE, every status change holds
+// this lock so an approval and a gateway callback cannot both apply. Must run
+// in a transaction.
+func (r *WithdrawalRepository) LockByID(ctx context.Context, id uint64) (domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Withdrawal{}, fmt.Errorf("context error: %w", err)
+	}
+
+	var withdrawal domain.Withdrawal
+	err := dbWithContext(ctx, r.DB).Clauses(clause.Locking{Strength: "UPDATE"}).First(&withdrawal, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Withdrawal{}, errors.New("withdrawal not found")
+		}
+		return domain.Withdrawal{}, fmt.Errorf("failed to lock withdrawal: %w", err)
+	}
+
+	return withdrawal, nil
+}
+
+func (r *WithdrawalRepository) FindByUserID(ctx context.Context, userID uint, limit, offset int) ([]domain.Withdrawal, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	return r.find(dbWithContext(ctx, r.DB).Model(&domain.Withdrawal{}).Where("user_id = ?", userID), limit, offset)
+}
+
+// FindByStatus lists withdrawals of every user, an empty status lists all of them
+func (r *WithdrawalRepository) FindByStatus(ctx context.Context, status string, limit, offset int) ([]domain.Withdrawal, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("context error: %w", err)
+	}
+
+	query := dbWithContext(ctx, r.DB).Model(&domain.Withdrawal{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	return r.find(query, limit, offset)
+}
+
+// GetStaleWithdrawals returns withdrawals in status that have not changed since before, oldest first
+func (r *WithdrawalRepository) GetStaleWithdrawals(ctx context.Context, status string, before time.Time, limit int) ([]domain.Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context error: %w", err)
+	}
+
+	var withdrawals []domain.Withdrawal
+	err := r.withBankAccount(dbWithContext(ctx, r.DB)).
+		Where("status = ? AND updated_at < ?", status, before).
+		Order("updated_at, id").
+		Limit(limit).
+		Find(&withdrawals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stale withdrawals: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+func (r *WithdrawalRepository) find(query *gorm.DB, limit, offset int) ([]domain.Withdrawal, int64, error) {
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count withdrawals: %w", err)
+	}
+
+	var withdrawals []domain.Withdrawal
+	err := r.withBankAccount(query).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&withdrawals).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find withdrawals: %w", err)
+	}
+
+	return withdrawals, total, nil
+}
+
+// withBankAccount preloads the bank account, including ones deleted since
+func (r *WithdrawalRepository) withBankAccount(query *gorm.DB) *gorm.DB {
+	return query.Preload("BankAccount", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	})
+}
@@ -0,0 +1,82 @@
+package stubdisbursement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"strings"
+	"sync"
+)
+
+// FailingAccountPrefix makes the stub fail every payout to an account number
+// starting with it, so the reversal path can be exercised locally
+const FailingAccountPrefix = "000"
+
+// StubDisbursementGateway is a disbursement gateway for local runs and tests.
+// Nothing leaves the process: payouts complete straight away and are kept in
+// memory until the server stops.
+type StubDisbursementGateway struct {
+	mu            sync.Mutex
+	disbursements map[string]domain.Disbursement
+}
+
+func NewStubDisbursementGateway() *StubDisbursementGateway {
+	return &StubDisbursementGateway{
+		disbursements: make(map[string]domain.Disbursement),
+	}
+}
+
+func (g *StubDisbursementGateway) Name() string {
+	return "stub"
+}
+
+// CreateDisbursement returns the stored payout when the external id was
+// already sent, like an idempotent gateway would
+func (g *StubDisbursementGateway) CreateDisbursement(ctx context.Context, disbursement domain.DisbursementRequest) (domain.Disbursement, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Disbursement{}, err
+	}
+	if !disbursement.Amount.IsPositive() {
+		return domain.Disbursement{}, fmt.Errorf("%w: amount must be greater than 0", domain.ErrDisbursementRejected)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, existing := range g.disbursements {
+		if existing.ExternalID == disbursement.ExternalID {
+			return existing, nil
+		}
+	}
+
+	created := domain.Disbursement{
+		ID:         fmt.Sprintf("stub-disb-%d", len(g.disbursements)+1),
+		ExternalID: disbursement.ExternalID,
+		Status:     "COMPLETED",
+		Amount:     disbursement.Amount,
+	}
+	if strings.HasPrefix(disbursement.AccountNumber, FailingAccountPrefix) {
+		created.Status = "FAILED"
+		created.FailureCode = "INVALID_DESTINATION"
+	}
+	g.disbursements[created.ID] = created
+
+	return created, nil
+}
+
+func (g *StubDisbursementGateway) GetDisbursement(ctx context.Context, disbursementID string) (domain.Disbursement, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Disbursement{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	disbursement, ok := g.disbursements[disbursementID]
+	if !ok {
+		return domain.Disbursement{}, errors.New("disbursement not found")
+	}
+
+	return disbursement, nil
+}
@@ -0,0 +1,76 @@
+package xendit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGreenMarket/domain"
+	"net/http"
+	"net/url"
+)
+
+type (
+	createDisbursementRequest struct {
+		ExternalID        string       `json:"external_id"`
+		Amount            domain.Money `json:"amount"`
+		BankCode          string       `json:"bank_code"`
+		AccountHolderName string       `json:"account_holder_name"`
+		AccountNumber     string       `json:"account_number"`
+		Description       string       `json:"description"`
+	}
+
+	disbursementResponse struct {
+		ID          string       `json:"id"`
+		ExternalID  string       `json:"external_id"`
+		Amount      domain.Money `json:"amount"`
+		Status      string       `json:"status"`
+		FailureCode string       `json:"failure_code"`
+	}
+)
+
+// CreateDisbursement sends the external id as the idempotency key, so a
+// retried payout is only sent once. A 4xx answer means Xendit refused the
+// payout and is reported as domain.ErrDisbursementRejected.
+func (r *XenditRepository) CreateDisbursement(ctx context.Context, disbursement domain.DisbursementRequest) (domain.Disbursement, error) {
+	payload := createDisbursementRequest{
+		ExternalID:        disbursement.ExternalID,
+		Amount:            disbursement.Amount.Round(),
+		BankCode:          disbursement.BankCode,
+		AccountHolderName: disbursement.AccountHolderName,
+		AccountNumber:     disbursement.AccountNumber,
+		Description:       disbursement.Description,
+	}
+	headers := map[string]string{"X-IDEMPOTENCY-KEY": disbursement.ExternalID}
+
+	var res disbursementResponse
+	err := r.do(ctx, http.MethodPost, r.apiURL("/disbursements"), payload, headers, disbursement.ExternalID != "", &res)
+	if err != nil {
+		var xenditErr *XenditError
+		if errors.As(err, &xenditErr) && !xenditErr.retryable() {
+			return domain.Disbursement{}, fmt.Errorf("%w: %w", domain.ErrDisbursementRejected, err)
+		}
+		return domain.Disbursement{}, err
+	}
+
+	return toDisbursement(res), nil
+}
+
+func (r *XenditRepository) GetDisbursement(ctx context.Context, disbursementID string) (domain.Disbursement, error) {
+	var res disbursementResponse
+	err := r.do(ctx, http.MethodGet, r.apiURL("/disbursements/"+url.PathEscape(disbursementID)), nil, nil, true, &res)
+	if err != nil {
+		return domain.Disbursement{}, err
+	}
+
+	return toDisbursement(res), nil
+}
+
+func toDisbursement(res disbursementResponse) domain.Disbursement {
+	return domain.Disbursement{
+		ID:          res.ID,
+		ExternalID:  res.ExternalID,
+		Status:      res.Status,
+		Amount:      res.Amount,
+		FailureCode: res.FailureCode,
+	}
+}
@@ -1,12 +1,17 @@
 package xendit
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"myGreenMarket/domain"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 type XenditConfig struct {
@@ -14,84 +19,331 @@ type XenditConfig struct {
 	XenditUrl          string
 	SuccessRedirectUrl string
 	FailureRedirectUrl string
+	// Timeout bounds a single HTTP attempt, defaults to 15 seconds
+	Timeout time.Duration
+	// MaxRetries is how many times an idempotent call is retried
+	MaxRetries int
 }
 
 type XenditRepository struct {
 	xenditConfig XenditConfig
+	client       *http.Client
 }
 
 func NewXenditRepository(cfg XenditConfig) *XenditRepository {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 15 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+
 	return &XenditRepository{
-		cfg,
-	}
-}
-
-func (r XenditRepository) XenditInvoiceUrl(purpose, username, email, name, category string, userId, productID, quantity, paymentId int, amount, price float64) (string, error) {
-
-	url := r.xenditConfig.XenditUrl
-	method := "POST"
-	var description string
-	var duration int64
-	switch purpose {
-	case "TRANSFER":
-		description = fmt.Sprintf("payment order %.2f", amount)
-		duration = 3600
-	case "TOPUP":
-		description = fmt.Sprintf("top up wallet %.2f", amount)
-		duration = 86400
-	}
-
-	payload := strings.NewReader(fmt.Sprintf(`{
-		"external_id": "%d|%d|%d|%s",
-		"amount": %.2f,
-		"description": "%s",
-		"invoice_duration": %d,
-		"customer": {
-			"email": "%s"
-		},
-		"success_redirect_url": "%s",
-		"failure_redirect_url": "%s",
-		"currency": "IDR",
-		"items": [
-			{
-			"name": "%s",
-			"quantity": %d,
-			"price": %.2f,
-			"category": "%s"
+		xenditConfig: cfg,
+		client:       &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// XenditError is the error body Xendit returns with every non-2xx response
+type XenditError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  string `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *XenditError) Error() string {
+	return fmt.Sprintf("xendit %d %s: %s", e.StatusCode, e.ErrorCode, e.Message)
+}
+
+// Unwrap lets callers match a missing invoice with errors.Is(err, domain.ErrInvoiceNotFound)
+func (e *XenditError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound || e.ErrorCode == "INVOICE_NOT_FOUND_ERROR" {
+		return domain.ErrInvoiceNotFound
+	}
+
+	return nil
+}
+
+// retryable reports whether a later attempt of the same call may succeed
+func (e *XenditError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+type (
+	createInvoiceRequest struct {
+		ExternalID         string          `json:"external_id"`
+		Amount             domain.Money    `json:"amount"`
+		Description        string          `json:"description"`
+		InvoiceDuration    int64           `json:"invoice_duration"`
+		Customer           domain.Customer `json:"customer"`
+		SuccessRedirectURL string          `json:"success_redirect_url,omitempty"`
+		FailureRedirectURL string          `json:"failure_redirect_url,omitempty"`
+		Currency           string          `json:"currency"`
+		Items              []domain.Item   `json:"items"`
+		Metadata           invoiceMetadata `json:"metadata"`
+	}
+
+	invoiceMetadata struct {
+		Store string `json:"store"`
+	}
+
+	createRefundRequest struct {
+		InvoiceID   string       `json:"invoice_id"`
+		ReferenceID string       `json:"reference_id"`
+		Amount      domain.Money `json:"amount"`
+		Reason      string       `json:"reason"`
+	}
+
+	refundResponse struct {
+		ID          string       `json:"id"`
+		InvoiceID   string       `json:"invoice_id"`
+		ReferenceID string       `json:"reference_id"`
+		Status      string       `json:"status"`
+		Amount      domain.Money `json:"amount"`
+	}
+)
+
+func (r *XenditRepository) Name() string {
+	return "xendit"
+}
+
+// CreateXenditInvoice opens an invoice and returns it exactly as Xendit sent it.
+// It is never retried, Xendit would open a second invoice for the same payment.
+// IDR invoices are in whole rupiah, other amounts are refused rather than
+// rounded, the invoice would not match the payment.
+func (r *XenditRepository) CreateXenditInvoice(ctx context.Context, invoice domain.InvoiceRequest) (domain.XenditResponse, error) {
+	if !invoice.Amount.IsWhole() {
+		return domain.XenditResponse{}, fmt.Errorf("invoice amount %s is not a whole rupiah amount", invoice.Amount)
+	}
+	for _, item := range invoice.Items {
+		if !item.Price.IsWhole() {
+			return domain.XenditResponse{}, fmt.Errorf("price %s of %s is not a whole rupiah amount", item.Price, item.Name)
+		}
+	}
+
+	payload := createInvoiceRequest{
+		ExternalID:         invoice.ExternalID,
+		Amount:             invoice.Amount,
+		Description:        invoice.Description,
+		InvoiceDuration:    int64(invoice.Duration.Seconds()),
+		Customer:           domain.Customer{Email: invoice.PayerEmail},
+		SuccessRedirectURL: r.xenditConfig.SuccessRedirectUrl,
+		FailureRedirectURL: r.xenditConfig.FailureRedirectUrl,
+		Currency:           "IDR",
+		Items:              invoice.Items,
+		Metadata:           invoiceMetadata{Store: "MyGreenMarket"},
+	}
+
+	var xenditResponse domain.XenditResponse
+	err := r.do(ctx, http.MethodPost, r.xenditConfig.XenditUrl, payload, nil, false, &xenditResponse)
+	if err != nil {
+		return domain.XenditResponse{}, err
+	}
+
+	return xenditResponse, nil
+}
+
+func (r *XenditRepository) GetXenditInvoice(ctx context.Context, invoiceID string) (domain.XenditResponse, error) {
+	var xenditResponse domain.XenditResponse
+	err := r.do(ctx, http.MethodGet, r.apiURL("/v2/invoices/"+url.PathEscape(invoiceID)), nil, nil, true, &xenditResponse)
+	if err != nil {
+		return domain.XenditResponse{}, err
+	}
+
+	return xenditResponse, nil
+}
+
+// ExpireXenditInvoice is safe to retry, expiring an invoice twice leaves it expired
+func (r *XenditRepository) ExpireXenditInvoice(ctx context.Context, invoiceID string) (domain.XenditResponse, error) {
+	var xenditResponse domain.XenditResponse
+	err := r.do(ctx, http.MethodPost, r.apiURL("/invoices/"+url.PathEscape(invoiceID)+"/expire!"), nil, nil, true, &xenditResponse)
+	if err != nil {
+		return domain.XenditResponse{}, err
+	}
+
+	return xenditResponse, nil
+}
+
+func (r *XenditRepository) CreateInvoice(ctx context.Context, invoice domain.InvoiceRequest) (domain.Invoice, error) {
+	res, err := r.CreateXenditInvoice(ctx, invoice)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return toInvoice(res), nil
+}
+
+func (r *XenditRepository) GetInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error) {
+	res, err := r.GetXenditInvoice(ctx, invoiceID)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return toInvoice(res), nil
+}
+
+func (r *XenditRepository) ExpireInvoice(ctx context.Context, invoiceID string) (domain.Invoice, error) {
+	res, err := r.ExpireXenditInvoice(ctx, invoiceID)
+	if err != nil {
+		return domain.Invoice{}, err
+	}
+
+	return toInvoice(res), nil
+}
+
+// Refund sends the reference id as the idempotency key, so a retried refund
+// is only paid out once. A refund Xendit refuses outright is reported as
+// domain.ErrRefundRejected.
+func (r *XenditRepository) Refund(ctx context.Context, refund domain.RefundRequest) (domain.Refund, error) {
+	payload := createRefundRequest{
+		InvoiceID:   refund.InvoiceID,
+		ReferenceID: refund.ReferenceID,
+		Amount:      refund.Amount.Round(),
+		Reason:      refund.Reason,
+	}
+	headers := map[string]string{"Idempotency-key": refund.ReferenceID}
+
+	var res refundResponse
+	err := r.do(ctx, http.MethodPost, r.apiURL("/refunds"), payload, headers, refund.ReferenceID != "", &res)
+	if err != nil {
+		var xenditErr *XenditError
+		if errors.As(err, &xenditErr) && !xenditErr.retryable() {
+			return domain.Refund{}, fmt.Errorf("%w: %w", domain.ErrRefundRejected, err)
+		}
+		return domain.Refund{}, err
+	}
+
+	return toRefund(res), nil
+}
+
+func (r *XenditRepository) GetRefund(ctx context.Context, refundID string) (domain.Refund, error) {
+	var res refundResponse
+	err := r.do(ctx, http.MethodGet, r.apiURL("/refunds/"+url.PathEscape(refundID)), nil, nil, true, &res)
+	if err != nil {
+		return domain.Refund{}, err
+	}
+
+	return toRefund(res), nil
+}
+
+// do sends one API call and decodes the response into out. Calls marked
+// idempotent are retried with backoff on network errors, 429 and 5xx.
+func (r *XenditRepository) do(ctx context.Context, method, endpoint string, payload interface{}, headers map[string]string, idempotent bool, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += r.xenditConfig.MaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(200*(1<<(attempt-1))) * time.Millisecond
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
 			}
-		],
-		"metadata": {
-			"store": "MyGreenMarket"
 		}
-	}      `, paymentId, userId, productID, purpose, amount, description, duration, email, r.xenditConfig.SuccessRedirectUrl, r.xenditConfig.FailureRedirectUrl, name, quantity, price, category))
 
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, payload)
+		err = r.send(ctx, method, endpoint, body, headers, out)
+		if err == nil {
+			return nil
+		}
+
+		var xenditErr *XenditError
+		if errors.As(err, &xenditErr) && !xenditErr.retryable() {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
 
+	return err
+}
+
+func (r *XenditRepository) send(ctx context.Context, method, endpoint string, body []byte, headers map[string]string, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
 	if err != nil {
-		return "", err
+		return err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	// req.Header.Add("Authorization", fmt.Sprintf("Basic %s", r.xenditApi))
+	req.Header.Set("Content-Type", "application/json")
 	req.SetBasicAuth(r.xenditConfig.XenditApi, "")
-	req.Header.Add("Cookie", "__cf_bm=_y6J2eEmO2_wiPddsvXgUQS24DJdIlPIDViHq8aEa4c-1762356798.765628-1.0.1.1-5F1zRs5pVcS07hwmvinbN239JL7gVaEm_IE0ocMvmLg79mWOrcvcuVYPjuaMQLDGI49MIp3ACXcwfnbcgXrH6kN_MYkpd6p7autz.xSS8E9aKC.eqVUKb09MH69j_udx")
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
 
-	res, err := client.Do(req)
+	res, err := r.client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		xenditErr := &XenditError{StatusCode: res.StatusCode}
+		if err := json.Unmarshal(resBody, xenditErr); err != nil || xenditErr.Message == "" {
+			xenditErr.Message = string(resBody)
+		}
+		return xenditErr
+	}
+
+	if err := json.Unmarshal(resBody, out); err != nil {
+		return fmt.Errorf("decode xendit response: %w", err)
 	}
 
-	var xenditReponse domain.XenditResponse
-	err = json.Unmarshal(body, &xenditReponse)
+	return nil
+}
+
+// apiURL builds an endpoint URL next to the configured invoice URL. Whatever
+// comes before /v2/invoices is kept, the simulator serves the API under /fake.
+func (r *XenditRepository) apiURL(path string) string {
+	base, err := url.Parse(r.xenditConfig.XenditUrl)
 	if err != nil {
-		return "", err
+		return r.xenditConfig.XenditUrl + path
 	}
 
-	return xenditReponse.InvoiceURL, nil
+	prefix := strings.TrimSuffix(strings.TrimRight(base.Path, "/"), "/v2/invoices")
+
+	return base.Scheme + "://" + base.Host + prefix + path
+}
+
+func toRefund(res refundResponse) domain.Refund {
+	return domain.Refund{
+		ID:          res.ID,
+		InvoiceID:   res.InvoiceID,
+		ReferenceID: res.ReferenceID,
+		Status:      res.Status,
+		Amount:      res.Amount,
+	}
+}
+
+func toInvoice(res domain.XenditResponse) domain.Invoice {
+	return domain.Invoice{
+		ID:            res.ID,
+		ExternalID:    res.ExternalID,
+		Status:        res.Status,
+		Amount:        res.Amount,
+		PaymentMethod: res.PaymentMethod,
+		InvoiceURL:    res.InvoiceURL,
+		ExpiryDate:    res.ExpiryDate,
+	}
 }
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	AlertHandler struct {
+		alertService AlertService
+		timeout      time.Duration
+	}
+
+	AlertService interface {
+		GetAlerts(ctx context.Context, openOnly bool, page, limit int) ([]domain.StockAlert, int64, error)
+	}
+)
+
+func NewAlertHandler(alertService AlertService) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+		timeout:      10 * time.Second,
+	}
+}
+
+// GetAlerts is the admin alert feed, ?status=all includes resolved alerts
+func (h *AlertHandler) GetAlerts(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	openOnly := c.QueryParam("status") != "all"
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	alerts, total, err := h.alertService.GetAlerts(ctx, openOnly, page, limit)
+	if err != nil {
+		logger.Error("Failed to get stock alerts", err)
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"alerts": alerts,
+		"total":  total,
+	}))
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	CartHandler struct {
+		validate    *validator.Validate
+		cartService CartService
+		timeout     time.Duration
+	}
+
+	CartService interface {
+		GetCart(ctx context.Context, userID uint) (domain.Cart, error)
+		AddItem(ctx context.Context, userID uint, productID uint64, quantity int) (domain.Cart, error)
+		UpdateItem(ctx context.Context, userID uint, productID uint64, quantity int) (domain.Cart, error)
+		RemoveItem(ctx context.Context, userID uint, productID uint64) (domain.Cart, error)
+	}
+
+	CartItemInput struct {
+		ProductID uint64 `json:"product_id" validate:"required"`
+		Quantity  int    `json:"quantity" validate:"required,gt=0"`
+	}
+
+	CartUpdateInput struct {
+		Quantity int `json:"quantity" validate:"required,gt=0"`
+	}
+)
+
+func NewCartHandler(cartService CartService) *CartHandler {
+	return &CartHandler{
+		validate:    validator.New(),
+		cartService: cartService,
+		timeout:     10 * time.Second,
+	}
+}
+
+func (h *CartHandler) GetCart(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	cart, err := h.cartService.GetCart(ctx, user_id)
+	if err != nil {
+		logger.Error("Failed to get cart", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(cart))
+}
+
+func (h *CartHandler) AddItem(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	var request CartItemInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation cart item validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	cart, err := h.cartService.AddItem(ctx, user_id, request.ProductID, request.Quantity)
+	if err != nil {
+		logger.Error("Failed to add cart item", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(cart))
+}
+
+func (h *CartHandler) UpdateItem(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	var request CartUpdateInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation cart item validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	cart, err := h.cartService.UpdateItem(ctx, user_id, productID, request.Quantity)
+	if err != nil {
+		logger.Error("Failed to update cart item", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(cart))
+}
+
+func (h *CartHandler) RemoveItem(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	cart, err := h.cartService.RemoveItem(ctx, user_id, productID)
+	if err != nil {
+		logger.Error("Failed to remove cart item", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(cart))
+}
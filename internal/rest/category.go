@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"errors"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/logger"
 	"net/http"
@@ -13,11 +14,11 @@ import (
 )
 
 type CategoryService interface {
-	GetAllCategories(ctx context.Context) ([]domain.Category, error)
+	GetAllCategories(ctx context.Context) ([]domain.CategoryNode, error)
 	GetCategoryByID(ctx context.Context, id uint64) (domain.Category, error)
 	CreateCategory(ctx context.Context, category *domain.Category) (*domain.Category, error)
 	UpdateCategory(ctx context.Context, category *domain.Category) (*domain.Category, error)
-	DeleteCategory(ctx context.Context, id uint64) error
+	DeleteCategory(ctx context.Context, id uint64, reassignTo *uint64) error
 }
 
 type CategoryHandler struct {
@@ -34,12 +35,37 @@ func NewCategoryHandler(categoryService CategoryService) *CategoryHandler {
 	}
 }
 
+// CreateCategoryRequest nests the category under ParentID when given, Slug
+// defaults to one made from the name
 type CreateCategoryRequest struct {
-	ProductCategory string `json:"product_category" validate:"required"`
+	ProductCategory string  `json:"product_category" validate:"required"`
+	ParentID        *uint64 `json:"parent_id" validate:"omitempty,gt=0"`
+	Slug            string  `json:"slug" validate:"omitempty,max=100"`
 }
 
+// UpdateCategoryRequest moves the category to the top level without a
+// ParentID, and keeps its slug without a Slug
 type UpdateCategoryRequest struct {
-	ProductCategory string `json:"product_category" validate:"required"`
+	ProductCategory string  `json:"product_category" validate:"required"`
+	ParentID        *uint64 `json:"parent_id" validate:"omitempty,gt=0"`
+	Slug            string  `json:"slug" validate:"omitempty,max=100"`
+}
+
+// categoryRequestError tells whether a create or update was refused for
+// what the admin asked for, and with which status
+func categoryRequestError(err error) (int, bool) {
+	switch err.Error() {
+	case "category ID is required",
+		"product category is required",
+		"category slug must contain letters or digits",
+		"category cannot be nested under itself",
+		"parent category not found":
+		return http.StatusBadRequest, true
+	case "category slug already exists":
+		return http.StatusConflict, true
+	}
+
+	return 0, false
 }
 
 func (h *CategoryHandler) GetAllCategories(c echo.Context) error {
@@ -52,6 +78,7 @@ func (h *CategoryHandler) GetAllCategories(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
 	}
 
+	// Each category counts the products of its subcategories too
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message":    "successfully get all categories",
 		"categories": categories,
@@ -74,7 +101,7 @@ func (h *CategoryHandler) GetCategoryByID(c echo.Context) error {
 	if err != nil {
 		logger.Error("Failed to find category", err)
 		// Check if category not found
-		if err.Error() == "category not found" || err.Error() == "invalid category id" {
+		if errors.Is(err, domain.ErrCategoryNotFound) || err.Error() == "invalid category id" {
 			return c.JSON(http.StatusNotFound, ResponseError{Message: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
@@ -104,14 +131,16 @@ func (h *CategoryHandler) CreateCategory(c echo.Context) error {
 
 	category := &domain.Category{
 		ProductCategory: req.ProductCategory,
+		ParentID:        req.ParentID,
+		Slug:            req.Slug,
 	}
 
 	newCategory, err := h.categoryService.CreateCategory(ctx, category)
 	if err != nil {
 		logger.Error("Failed to create category", err)
 		// Check if it's a validation error
-		if err.Error() == "product category is required" {
-			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+		if status, ok := categoryRequestError(err); ok {
+			return c.JSON(status, ResponseError{Message: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
 	}
@@ -148,18 +177,20 @@ func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 	category := &domain.Category{
 		CategoryID:      categoryID,
 		ProductCategory: req.ProductCategory,
+		ParentID:        req.ParentID,
+		Slug:            req.Slug,
 	}
 
 	updatedCategory, err := h.categoryService.UpdateCategory(ctx, category)
 	if err != nil {
 		logger.Error("Failed to update category", err)
 		// Check if category not found
-		if err.Error() == "category not found" {
+		if errors.Is(err, domain.ErrCategoryNotFound) {
 			return c.JSON(http.StatusNotFound, ResponseError{Message: err.Error()})
 		}
 		// Check if it's a validation error
-		if err.Error() == "category ID is required" || err.Error() == "product category is required" {
-			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+		if status, ok := categoryRequestError(err); ok {
+			return c.JSON(status, ResponseError{Message: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
 	}
@@ -170,6 +201,9 @@ func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 	})
 }
 
+// DeleteCategory deletes a category. One that still has products is only
+// deleted with a reassign_to query parameter naming the category to move
+// them to.
 func (h *CategoryHandler) DeleteCategory(c echo.Context) error {
 	categoryIDStr := c.Param("id")
 
@@ -179,16 +213,35 @@ func (h *CategoryHandler) DeleteCategory(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid category id"})
 	}
 
+	var reassignTo *uint64
+	if raw := c.QueryParam("reassign_to"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || id == 0 {
+			logger.Error("Invalid reassign_to", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid reassign_to"})
+		}
+		reassignTo = &id
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
 	defer cancel()
 
-	err = h.categoryService.DeleteCategory(ctx, categoryID)
+	err = h.categoryService.DeleteCategory(ctx, categoryID, reassignTo)
 	if err != nil {
 		logger.Error("Failed to delete category", err)
 		// Check if category not found
-		if err.Error() == "category not found" || err.Error() == "invalid category id" {
+		if errors.Is(err, domain.ErrCategoryNotFound) || err.Error() == "invalid category id" {
 			return c.JSON(http.StatusNotFound, ResponseError{Message: err.Error()})
 		}
+		if errors.Is(err, domain.ErrCategoryInUse) {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error() + ", pass reassign_to to move them to another category"})
+		}
+		if err.Error() == "category has subcategories" {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+		}
+		if err.Error() == "reassign category not found" || err.Error() == "cannot reassign products to the deleted category" {
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
 	}
 
@@ -0,0 +1,246 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	InventoryHandler struct {
+		validate         *validator.Validate
+		inventoryService InventoryService
+		timeout          time.Duration
+	}
+
+	InventoryService interface {
+		ReceiveBatch(ctx context.Context, adminID uint, batch domain.StockBatch) (domain.StockBatch, error)
+		GetBatches(ctx context.Context, productID uint64) ([]domain.StockBatch, error)
+		AdjustBatch(ctx context.Context, productID, batchID uint64, adjustment domain.BatchAdjustment) (domain.StockBatch, error)
+		GetExpiringStock(ctx context.Context, days int) ([]domain.ExpiringStock, error)
+		AdjustStock(ctx context.Context, adminID uint, adjustment domain.StockAdjustment) (domain.Product, error)
+		GetMovements(ctx context.Context, productID uint64, page, limit int) ([]domain.InventoryMovement, int64, error)
+	}
+
+	StockBatchInput struct {
+		Quantity   float64      `json:"quantity" validate:"required,gt=0"`
+		CostPrice  domain.Money `json:"cost_price" validate:"gte=0"`
+		ReceivedAt time.Time    `json:"received_at"`
+		ExpiresAt  time.Time    `json:"expires_at" validate:"required"`
+	}
+
+	BatchAdjustmentInput struct {
+		CostPrice *domain.Money `json:"cost_price" validate:"omitempty,gte=0"`
+		ExpiresAt *time.Time    `json:"expires_at"`
+	}
+
+	// StockAdjustmentInput changes stock by Quantity, negative removes stock
+	StockAdjustmentInput struct {
+		Quantity float64 `json:"quantity" validate:"required"`
+		Reason   string  `json:"reason" validate:"required,oneof=RESTOCK WRITE_OFF RETURN CORRECTION"`
+		BatchID  *uint64 `json:"batch_id"`
+		Note     string  `json:"note"`
+	}
+)
+
+// defaultExpiringDays is the window of the expiring stock report when none is asked for
+const defaultExpiringDays = 3
+
+func NewInventoryHandler(inventoryService InventoryService) *InventoryHandler {
+	return &InventoryHandler{
+		validate:         newValidator(),
+		inventoryService: inventoryService,
+		timeout:          10 * time.Second,
+	}
+}
+
+func (h *InventoryHandler) ReceiveBatch(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	var request StockBatchInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation stock batch validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	batch, err := h.inventoryService.ReceiveBatch(ctx, admin_id, domain.StockBatch{
+		ProductID:  productID,
+		Quantity:   request.Quantity,
+		CostPrice:  request.CostPrice,
+		ReceivedAt: request.ReceivedAt,
+		ExpiresAt:  request.ExpiresAt,
+	})
+	if err != nil {
+		logger.Error("Failed to receive stock batch", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(batch))
+}
+
+func (h *InventoryHandler) GetBatches(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	batches, err := h.inventoryService.GetBatches(ctx, productID)
+	if err != nil {
+		logger.Error("Failed to get stock batches", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(batches))
+}
+
+func (h *InventoryHandler) AdjustBatch(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	batchID, err := strconv.ParseUint(c.Param("batch_id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid stock batch id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid stock batch id"})
+	}
+
+	var request BatchAdjustmentInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation stock batch adjustment validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	batch, err := h.inventoryService.AdjustBatch(ctx, productID, batchID, domain.BatchAdjustment{
+		CostPrice: request.CostPrice,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		logger.Error("Failed to adjust stock batch", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(batch))
+}
+
+func (h *InventoryHandler) GetExpiringStock(c echo.Context) error {
+	days := defaultExpiringDays
+	if raw := c.QueryParam("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			logger.Error("Invalid days", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid days"})
+		}
+		days = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	report, err := h.inventoryService.GetExpiringStock(ctx, days)
+	if err != nil {
+		logger.Error("Failed to get expiring stock", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(report))
+}
+
+func (h *InventoryHandler) AdjustStock(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	var request StockAdjustmentInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation stock adjustment validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	product, err := h.inventoryService.AdjustStock(ctx, admin_id, domain.StockAdjustment{
+		ProductID: productID,
+		BatchID:   request.BatchID,
+		Quantity:  request.Quantity,
+		Reason:    domain.MovementReason(request.Reason),
+		Note:      request.Note,
+	})
+	if err != nil {
+		logger.Error("Failed to adjust stock", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(product))
+}
+
+func (h *InventoryHandler) GetMovements(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	movements, total, err := h.inventoryService.GetMovements(ctx, productID, page, limit)
+	if err != nil {
+		logger.Error("Failed to get inventory movements", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"movements": movements,
+		"total":     total,
+	}))
+}
@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	MarkdownHandler struct {
+		validate        *validator.Validate
+		markdownService MarkdownService
+		timeout         time.Duration
+	}
+
+	MarkdownService interface {
+		PreviewMarkdowns(ctx context.Context) ([]domain.MarkdownOutcome, error)
+		CreateRule(ctx context.Context, rule domain.MarkdownRule) (domain.MarkdownRule, error)
+		GetRules(ctx context.Context) ([]domain.MarkdownRule, error)
+		DeleteRule(ctx context.Context, id uint64) error
+	}
+
+	MarkdownRuleInput struct {
+		DaysLeft        int     `json:"days_left" validate:"gte=0"`
+		DiscountPercent float64 `json:"discount_percent" validate:"required,gt=0,lte=100"`
+		ProductCategory string  `json:"product_category"`
+	}
+)
+
+func NewMarkdownHandler(markdownService MarkdownService) *MarkdownHandler {
+	return &MarkdownHandler{
+		validate:        validator.New(),
+		markdownService: markdownService,
+		timeout:         10 * time.Second,
+	}
+}
+
+func (h *MarkdownHandler) PreviewMarkdowns(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	outcomes, err := h.markdownService.PreviewMarkdowns(ctx)
+	if err != nil {
+		logger.Error("Failed to preview markdowns", err)
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(outcomes))
+}
+
+func (h *MarkdownHandler) CreateRule(c echo.Context) error {
+	var request MarkdownRuleInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation markdown rule validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	rule, err := h.markdownService.CreateRule(ctx, domain.MarkdownRule{
+		DaysLeft:        request.DaysLeft,
+		DiscountPercent: request.DiscountPercent,
+		ProductCategory: request.ProductCategory,
+	})
+	if err != nil {
+		logger.Error("Failed to create markdown rule", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(rule))
+}
+
+func (h *MarkdownHandler) GetRules(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	rules, err := h.markdownService.GetRules(ctx)
+	if err != nil {
+		logger.Error("Failed to get markdown rules", err)
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(rules))
+}
+
+func (h *MarkdownHandler) DeleteRule(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid markdown rule id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid markdown rule id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	if err := h.markdownService.DeleteRule(ctx, id); err != nil {
+		logger.Error("Failed to delete markdown rule", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK("Markdown rule deleted successfully"))
+}
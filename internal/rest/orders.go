@@ -1,10 +1,12 @@
 package rest
 
 import (
+	"errors"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/logger"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/AMFarhan21/fres"
 	"github.com/go-playground/validator/v10"
@@ -22,17 +24,30 @@ type (
 		GetAllOrders(user_id int) ([]domain.Orders, error)
 		GetOrder(order_id, user_id int) (domain.Orders, error)
 		GetOrderStatus(status string, user_id int) (domain.Orders, error)
-		UpdateOrder(data domain.Orders) error
-		DeleteOrder(order_id, user_id int) error
+		Checkout(user_id int) (domain.Orders, error)
+		UpdateOrder(order_id, user_id int, item domain.OrderItem) error
+		CancelOrder(order_id, user_id int) error
+		UpdateOrderStatus(order_id int, status domain.OrderStatus, admin_id int, reason string) (domain.Orders, error)
+		GetOrderHistory(order_id, user_id int) ([]domain.OrderStatusHistory, error)
 	}
 
 	OrdersInput struct {
+		Items []OrderItemInput `json:"items" validate:"required,min=1,dive"`
+	}
+
+	OrderItemInput struct {
 		ProductID int `json:"product_id" validate:"required"`
-		Quantity  int `json:"quantity" validate:"required"`
+		Quantity  int `json:"quantity" validate:"required,gt=0"`
 	}
 
 	UpdateInput struct {
-		Quantity int `json:"quantity" validate:"required"`
+		ProductID int `json:"product_id" validate:"required"`
+		Quantity  int `json:"quantity" validate:"required,gt=0"`
+	}
+
+	OrderStatusInput struct {
+		Status string `json:"status" validate:"required"`
+		Reason string `json:"reason"`
 	}
 )
 
@@ -58,10 +73,17 @@ func (h *OrdersHandler) CreateOrderItem(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 	}
 
+	items := make([]domain.OrderItem, 0, len(request.Items))
+	for _, item := range request.Items {
+		items = append(items, domain.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
 	orderItem, err := h.ordersService.CreateOrder(domain.Orders{
-		UserID:    int(user_id),
-		ProductID: request.ProductID,
-		Quantity:  request.Quantity,
+		UserID: int(user_id),
+		Items:  items,
 	})
 	if err != nil {
 		logger.Error("Failed to create order items", err)
@@ -71,6 +93,18 @@ func (h *OrdersHandler) CreateOrderItem(c echo.Context) error {
 	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(orderItem))
 }
 
+func (h *OrdersHandler) Checkout(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	order, err := h.ordersService.Checkout(int(user_id))
+	if err != nil {
+		logger.Error("Failed to checkout cart", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(order))
+}
+
 func (h *OrdersHandler) GetAllOrders(c echo.Context) error {
 	user_id := c.Get("user_id").(uint)
 	orders, err := h.ordersService.GetAllOrders(int(user_id))
@@ -114,10 +148,9 @@ func (h *OrdersHandler) UpdateOrder(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 	}
 
-	err := h.ordersService.UpdateOrder(domain.Orders{
-		ID:       order_id,
-		UserID:   int(user_id),
-		Quantity: request.Quantity,
+	err := h.ordersService.UpdateOrder(order_id, int(user_id), domain.OrderItem{
+		ProductID: request.ProductID,
+		Quantity:  request.Quantity,
 	})
 	if err != nil {
 		logger.Error("Failed to update order", err)
@@ -127,15 +160,63 @@ func (h *OrdersHandler) UpdateOrder(c echo.Context) error {
 	return c.JSON(http.StatusOK, fres.Response.StatusOK("Order updated successfully"))
 }
 
-func (h *OrdersHandler) DeleteOrder(c echo.Context) error {
+func (h *OrdersHandler) CancelOrder(c echo.Context) error {
+	id := c.Param("id")
+	order_id, _ := strconv.Atoi(id)
+	user_id := c.Get("user_id").(uint)
+	err := h.ordersService.CancelOrder(order_id, int(user_id))
+	if err != nil {
+		logger.Error("Failed to cancel order", err)
+		var transitionErr *domain.InvalidTransitionError
+		if errors.As(err, &transitionErr) {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK("Order cancelled successfully"))
+}
+
+func (h *OrdersHandler) UpdateOrderStatus(c echo.Context) error {
+	id := c.Param("id")
+	order_id, _ := strconv.Atoi(id)
+	admin_id := c.Get("user_id").(uint)
+
+	var request OrderStatusInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation order status validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	order, err := h.ordersService.UpdateOrderStatus(order_id, domain.OrderStatus(strings.ToUpper(request.Status)), int(admin_id), request.Reason)
+	if err != nil {
+		logger.Error("Failed to update order status", err)
+		var transitionErr *domain.InvalidTransitionError
+		if errors.As(err, &transitionErr) {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(order))
+}
+
+func (h *OrdersHandler) GetOrderHistory(c echo.Context) error {
 	id := c.Param("id")
 	order_id, _ := strconv.Atoi(id)
 	user_id := c.Get("user_id").(uint)
-	err := h.ordersService.DeleteOrder(order_id, int(user_id))
+
+	history, err := h.ordersService.GetOrderHistory(order_id, int(user_id))
 	if err != nil {
-		logger.Error("Failed to delete order", err)
+		logger.Error("Failed to get order history", err)
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, fres.Response.StatusOK("Order deleted successfully"))
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(history))
 }
@@ -1,10 +1,13 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/logger"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/AMFarhan21/fres"
 	"github.com/go-playground/validator/v10"
@@ -19,26 +22,47 @@ type (
 
 	PaymentsService interface {
 		CreatePayment(data domain.Payments, isWallet bool, user_id uint) (domain.PaymentWithLink, error)
+		CreateSplitPayment(order_id int, user_id uint) (domain.PaymentWithLink, error)
 		GetAllPayments(user_id int) ([]domain.Payments, error)
 		GetPayment(payment_id, user_id int) (domain.Payments, error)
-		ReceivePaymentWebhook(request WebhookRequest) error
+		ReceivePaymentWebhook(request WebhookRequest, payload []byte) error
+		ListWebhookEvents(status string, page, limit int) ([]domain.WebhookEvent, int64, error)
+		ReplayWebhookEvent(id uint64) error
+		ConfirmPayment(payment_id int, admin_id uint) (domain.Payments, error)
+		ReconcilePayments(admin_id uint, olderThan time.Duration) (domain.ReconciliationReport, error)
+		ListReconciliationReports(page, limit int) ([]domain.ReconciliationReport, int64, error)
+		RefundOrder(refund domain.OrderRefund, isAdmin bool) (domain.Payments, error)
 		DeletePayment(payment_id int) error
-		TopUp(user_id uint, amount float64) (domain.TopUp, error)
+		TopUp(user_id uint, amount domain.Money) (domain.TopUp, error)
 	}
 
 	PaymentsInput struct {
 		OrderID  int   `json:"order_id" validate:"required"`
-		IsWallet *bool `json:"is_wallet" validate:"required"`
+		IsWallet *bool `json:"is_wallet" validate:"required_without=Split"`
+		// Split uses the wallet balance first and a gateway invoice for the rest
+		Split bool `json:"split"`
+	}
+
+	RefundInput struct {
+		OrderID  int                 `json:"order_id" validate:"required"`
+		Items    []domain.RefundLine `json:"items" validate:"dive"`
+		ToWallet bool                `json:"to_wallet"`
+		Reason   string              `json:"reason"`
+	}
+
+	AdminRefundInput struct {
+		RefundInput
+		Restock bool `json:"restock"`
 	}
 
 	TopUpInput struct {
-		Amount float64 `json:"amount" validate:"required"`
+		Amount domain.Money `json:"amount" validate:"required,gt=0,rupiah"`
 	}
 )
 
 func NewPaymentsHandler(paymentsService PaymentsService) *PaymentsHandler {
 	return &PaymentsHandler{
-		validate:        validator.New(),
+		validate:        newValidator(),
 		paymentsService: paymentsService,
 	}
 }
@@ -58,10 +82,16 @@ func (h *PaymentsHandler) CreatePayment(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 	}
 
-	payment, err := h.paymentsService.CreatePayment(domain.Payments{
-		UserID:  int(user_id),
-		OrderID: &request.OrderID,
-	}, *request.IsWallet, user_id)
+	var payment domain.PaymentWithLink
+	var err error
+	if request.Split {
+		payment, err = h.paymentsService.CreateSplitPayment(request.OrderID, user_id)
+	} else {
+		payment, err = h.paymentsService.CreatePayment(domain.Payments{
+			UserID:  int(user_id),
+			OrderID: &request.OrderID,
+		}, *request.IsWallet, user_id)
+	}
 	if err != nil {
 		logger.Error("Failed to create order items", err)
 		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
@@ -121,6 +151,128 @@ func (h *PaymentsHandler) TopUp(c echo.Context) error {
 	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(res))
 }
 
+func (h *PaymentsHandler) ConfirmPayment(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	payment_id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("Invalid payment id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid payment id"})
+	}
+
+	payment, err := h.paymentsService.ConfirmPayment(payment_id, admin_id)
+	if err != nil {
+		logger.Error("Failed to confirm payment", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(payment))
+}
+
+// ReconcilePayments checks every PENDING payment against the gateway now.
+// older_than_minutes limits it to payments at least that old.
+func (h *PaymentsHandler) ReconcilePayments(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	minutes, _ := strconv.Atoi(c.QueryParam("older_than_minutes"))
+	if minutes < 0 {
+		minutes = 0
+	}
+
+	report, err := h.paymentsService.ReconcilePayments(admin_id, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		logger.Error("Failed to reconcile payments", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(report))
+}
+
+func (h *PaymentsHandler) ListReconciliationReports(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	reports, total, err := h.paymentsService.ListReconciliationReports(page, limit)
+	if err != nil {
+		logger.Error("Failed to list reconciliation reports", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"reports": reports,
+		"total":   total,
+	}))
+}
+
+func (h *PaymentsHandler) RefundOrder(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	var request RefundInput
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validate refund request", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	refund, err := h.paymentsService.RefundOrder(domain.OrderRefund{
+		OrderID:  request.OrderID,
+		UserID:   int(user_id),
+		Actor:    fmt.Sprintf("user:%d", user_id),
+		Lines:    request.Items,
+		ToWallet: request.ToWallet,
+		Reason:   request.Reason,
+	}, false)
+	if err != nil {
+		return refundError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(refund))
+}
+
+func (h *PaymentsHandler) AdminRefundOrder(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	var request AdminRefundInput
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validate refund request", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	refund, err := h.paymentsService.RefundOrder(domain.OrderRefund{
+		OrderID:  request.OrderID,
+		Actor:    fmt.Sprintf("admin:%d", admin_id),
+		Lines:    request.Items,
+		ToWallet: request.ToWallet,
+		Restock:  request.Restock,
+		Reason:   request.Reason,
+	}, true)
+	if err != nil {
+		return refundError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(refund))
+}
+
+func refundError(c echo.Context, err error) error {
+	logger.Error("Failed to refund order", err)
+
+	var transitionErr *domain.InvalidTransitionError
+	if errors.As(err, &transitionErr) {
+		return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+}
+
 func (h *PaymentsHandler) PaidResponse(c echo.Context) error {
 	return c.JSON(http.StatusOK, fres.Response.StatusOK("Your payment was successfull!"))
 }
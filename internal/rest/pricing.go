@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	PricingHandler struct {
+		validate       *validator.Validate
+		pricingService PricingService
+		timeout        time.Duration
+	}
+
+	PricingService interface {
+		Quote(ctx context.Context, items []domain.CartItem) (domain.PriceQuote, error)
+		QuoteCart(ctx context.Context, userID uint) (domain.PriceQuote, error)
+		CreatePromotion(ctx context.Context, promotion domain.Promotion) (domain.Promotion, error)
+		GetPromotions(ctx context.Context) ([]domain.Promotion, error)
+		DeletePromotion(ctx context.Context, id uint64) error
+	}
+
+	// PricePreviewInput prices the given items, without items it prices the
+	// user's cart
+	PricePreviewInput struct {
+		Items []CartItemInput `json:"items" validate:"dive"`
+	}
+
+	PromotionInput struct {
+		Name            string     `json:"name" validate:"required"`
+		ProductID       *uint64    `json:"product_id"`
+		ProductCategory string     `json:"product_category"`
+		DiscountPercent float64    `json:"discount_percent" validate:"required,gt=0,lte=100"`
+		StartsAt        time.Time  `json:"starts_at"`
+		EndsAt          *time.Time `json:"ends_at"`
+	}
+)
+
+func NewPricingHandler(pricingService PricingService) *PricingHandler {
+	return &PricingHandler{
+		validate:       newValidator(),
+		pricingService: pricingService,
+		timeout:        10 * time.Second,
+	}
+}
+
+func (h *PricingHandler) Preview(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	var request PricePreviewInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation price preview validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	var (
+		quote domain.PriceQuote
+		err   error
+	)
+	if len(request.Items) == 0 {
+		quote, err = h.pricingService.QuoteCart(ctx, user_id)
+	} else {
+		items := make([]domain.CartItem, 0, len(request.Items))
+		for _, item := range request.Items {
+			items = append(items, domain.CartItem{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+			})
+		}
+		quote, err = h.pricingService.Quote(ctx, items)
+	}
+	if err != nil {
+		logger.Error("Failed to preview prices", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(quote))
+}
+
+func (h *PricingHandler) CreatePromotion(c echo.Context) error {
+	var request PromotionInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation promotion validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	promotion, err := h.pricingService.CreatePromotion(ctx, domain.Promotion{
+		Name:            request.Name,
+		ProductID:       request.ProductID,
+		ProductCategory: request.ProductCategory,
+		DiscountPercent: request.DiscountPercent,
+		StartsAt:        request.StartsAt,
+		EndsAt:          request.EndsAt,
+	})
+	if err != nil {
+		logger.Error("Failed to create promotion", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(promotion))
+}
+
+func (h *PricingHandler) GetPromotions(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	promotions, err := h.pricingService.GetPromotions(ctx)
+	if err != nil {
+		logger.Error("Failed to get promotions", err)
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(promotions))
+}
+
+func (h *PricingHandler) DeletePromotion(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid promotion id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid promotion id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	if err := h.pricingService.DeletePromotion(ctx, id); err != nil {
+		logger.Error("Failed to delete promotion", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK("Promotion deleted successfully"))
+}
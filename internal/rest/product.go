@@ -2,9 +2,11 @@ package rest
 
 import (
 	"context"
+	"errors"
 	"myGreenMarket/domain"
 	"myGreenMarket/pkg/logger"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -13,9 +15,9 @@ import (
 )
 
 type ProductService interface {
-	GetAllProducts(ctx context.Context) ([]domain.Product, error)
+	GetAllProducts(ctx context.Context, query domain.ProductQuery, page, limit int) (domain.ProductPage, error)
 	GetProductByID(ctx context.Context, id uint) (*domain.Product, error)
-	CreateProduct(ctx context.Context, product *domain.Product) (*domain.Product, error)
+	CreateProduct(ctx context.Context, product *domain.Product, adminID uint) (*domain.Product, error)
 	UpdateProduct(ctx context.Context, product *domain.Product) (*domain.Product, error)
 	DeleteProduct(ctx context.Context, id uint64) error
 }
@@ -29,53 +31,129 @@ type ProductHandler struct {
 func NewProductHandler(productService ProductService) *ProductHandler {
 	return &ProductHandler{
 		productService: productService,
-		validator:      validator.New(),
+		validator:      newValidator(),
 		timeout:        10 * time.Second,
 	}
 }
 
 type CreateProductRequest struct {
-	ProductID       uint64  `json:"product_id"`
-	ProductSKUID    uint64  `json:"product_skuid"`
-	IsGreenTag      bool    `json:"is_green_tag"`
-	ProductName     string  `json:"product_name" validate:"required"`
-	ProductCategory string  `json:"product_category" validate:"required"`
-	Unit            string  `json:"unit" validate:"required"`
-	NormalPrice     float64 `json:"normal_price" validate:"required,gt=0"`
-	SalePrice       float64 `json:"sale_price" validate:"gte=0"`
-	Discount        float64 `json:"discount" validate:"gte=0,lte=100"`
-	Quantity        float64 `json:"quantity" validate:"required,gte=0"`
+	ProductID       uint64       `json:"product_id"`
+	ProductSKUID    uint64       `json:"product_skuid"`
+	IsGreenTag      bool         `json:"is_green_tag"`
+	ProductName     string       `json:"product_name" validate:"required"`
+	ProductCategory string       `json:"product_category" validate:"required_without=CategoryID"`
+	CategoryID      *uint64      `json:"category_id" validate:"omitempty,gt=0"`
+	Unit            string       `json:"unit" validate:"required"`
+	NormalPrice     domain.Money `json:"normal_price" validate:"required,gt=0,rupiah"`
+	SalePrice       domain.Money `json:"sale_price" validate:"gte=0,rupiah"`
+	Discount        float64      `json:"discount" validate:"gte=0,lte=100"`
+	Quantity        float64      `json:"quantity" validate:"required,gte=0"`
+	// ReorderThreshold is optional, without it the product gets no low-stock alerts
+	ReorderThreshold *float64 `json:"reorder_threshold" validate:"omitempty,gte=0"`
 }
 
+// UpdateProductRequest has no quantity, stock changes through a stock
+// adjustment. Without a category the product keeps its own.
 type UpdateProductRequest struct {
-	ProductID       uint64  `json:"product_id"`
-	ProductSKUID    uint64  `json:"product_skuid"`
-	IsGreenTag      bool    `json:"is_green_tag"`
-	ProductName     string  `json:"product_name" validate:"required"`
-	ProductCategory string  `json:"product_category" validate:"required"`
-	Unit            string  `json:"unit" validate:"required"`
-	NormalPrice     float64 `json:"normal_price" validate:"required,gt=0"`
-	SalePrice       float64 `json:"sale_price" validate:"gte=0"`
-	Discount        float64 `json:"discount" validate:"gte=0,lte=100"`
-	Quantity        float64 `json:"quantity" validate:"required,gte=0"`
+	ProductID        uint64       `json:"product_id"`
+	ProductSKUID     uint64       `json:"product_skuid"`
+	IsGreenTag       bool         `json:"is_green_tag"`
+	ProductName      string       `json:"product_name" validate:"required"`
+	ProductCategory  string       `json:"product_category"`
+	CategoryID       *uint64      `json:"category_id" validate:"omitempty,gt=0"`
+	Unit             string       `json:"unit" validate:"required"`
+	NormalPrice      domain.Money `json:"normal_price" validate:"required,gt=0,rupiah"`
+	SalePrice        domain.Money `json:"sale_price" validate:"gte=0,rupiah"`
+	Discount         float64      `json:"discount" validate:"gte=0,lte=100"`
+	ReorderThreshold *float64     `json:"reorder_threshold" validate:"omitempty,gte=0"`
 }
 
+// GetAllProducts lists products a page at a time. It takes q, category,
+// category_id, green_tag, min_price, max_price, min_discount, in_stock, sort,
+// page and limit query parameters, see domain.ProductQuery.
 func (h *ProductHandler) GetAllProducts(c echo.Context) error {
+	query := domain.ProductQuery{
+		Search:       c.QueryParam("q"),
+		Category:     c.QueryParam("category"),
+		GreenTagOnly: c.QueryParam("green_tag") == "true",
+		InStockOnly:  c.QueryParam("in_stock") == "true",
+		Sort:         domain.ProductSort(c.QueryParam("sort")),
+	}
+	if raw := c.QueryParam("category_id"); raw != "" {
+		categoryID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			logger.Error("Invalid category_id", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid category_id"})
+		}
+		query.CategoryID = &categoryID
+	}
+	if raw := c.QueryParam("min_price"); raw != "" {
+		minPrice, err := domain.ParseMoney(raw)
+		if err != nil {
+			logger.Error("Invalid min_price", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid min_price"})
+		}
+		query.MinPrice = &minPrice
+	}
+	if raw := c.QueryParam("max_price"); raw != "" {
+		maxPrice, err := domain.ParseMoney(raw)
+		if err != nil {
+			logger.Error("Invalid max_price", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid max_price"})
+		}
+		query.MaxPrice = &maxPrice
+	}
+	if raw := c.QueryParam("min_discount"); raw != "" {
+		minDiscount, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			logger.Error("Invalid min_discount", err)
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid min_discount"})
+		}
+		query.MinDiscount = minDiscount
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
 	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
 	defer cancel()
 
-	products, err := h.productService.GetAllProducts(ctx)
+	result, err := h.productService.GetAllProducts(ctx, query, page, limit)
 	if err != nil {
 		logger.Error("Failed to find all Product", err)
+		if errors.Is(err, domain.ErrInvalidProductQuery) {
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
 	}
 
+	var next, prev interface{}
+	if result.HasNext() {
+		next = pageLink(c.Request().URL, result.Page+1, result.Limit)
+	}
+	if result.Page > 1 {
+		prev = pageLink(c.Request().URL, result.Page-1, result.Limit)
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message":  "successfully get all products",
-		"products": products,
+		"products": result.Products,
+		"total":    result.Total,
+		"page":     result.Page,
+		"limit":    result.Limit,
+		"next":     next,
+		"prev":     prev,
 	})
 }
 
+// pageLink is the request URL with its page and limit swapped for the given ones
+func pageLink(requestURL *url.URL, page, limit int) string {
+	params := requestURL.Query()
+	params.Set("page", strconv.Itoa(page))
+	params.Set("limit", strconv.Itoa(limit))
+
+	return requestURL.Path + "?" + params.Encode()
+}
+
 func (h *ProductHandler) GetProductByID(c echo.Context) error {
 	productIdStr := c.Param("id")
 
@@ -103,6 +181,8 @@ func (h *ProductHandler) GetProductByID(c echo.Context) error {
 }
 
 func (h *ProductHandler) CreateProduct(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
 	var req CreateProductRequest
 
 	if err := c.Bind(&req); err != nil {
@@ -119,27 +199,31 @@ func (h *ProductHandler) CreateProduct(c echo.Context) error {
 	defer cancel()
 
 	product := &domain.Product{
-		ProductID:       req.ProductID,
-		ProductSKUID:    req.ProductSKUID,
-		IsGreenTag:      req.IsGreenTag,
-		ProductName:     req.ProductName,
-		ProductCategory: req.ProductCategory,
-		Unit:            req.Unit,
-		NormalPrice:     req.NormalPrice,
-		SalePrice:       req.SalePrice,
-		Discount:        req.Discount,
-		Quantity:        req.Quantity,
-	}
-
-	newProduct, err := h.productService.CreateProduct(ctx, product)
+		ProductID:        req.ProductID,
+		ProductSKUID:     req.ProductSKUID,
+		IsGreenTag:       req.IsGreenTag,
+		ProductName:      req.ProductName,
+		ProductCategory:  req.ProductCategory,
+		CategoryID:       req.CategoryID,
+		Unit:             req.Unit,
+		NormalPrice:      req.NormalPrice,
+		SalePrice:        req.SalePrice,
+		Discount:         req.Discount,
+		Quantity:         req.Quantity,
+		ReorderThreshold: req.ReorderThreshold,
+	}
+
+	newProduct, err := h.productService.CreateProduct(ctx, product, admin_id)
 	if err != nil {
 		logger.Error("Failed to create Product", err)
 		// Check if it's a validation error
 		if err.Error() == "product name is required" ||
 			err.Error() == "product category is required" ||
+			err.Error() == "product category not found" ||
 			err.Error() == "unit is required" ||
 			err.Error() == "normal price must be greater than 0" ||
-			err.Error() == "quantity cannot be negative" {
+			err.Error() == "quantity cannot be negative" ||
+			err.Error() == "reorder threshold cannot be negative" {
 			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
@@ -175,17 +259,18 @@ func (h *ProductHandler) UpdateProduct(c echo.Context) error {
 	defer cancel()
 
 	product := &domain.Product{
-		ID:              ProductId,
-		ProductID:       req.ProductID,
-		ProductSKUID:    req.ProductSKUID,
-		IsGreenTag:      req.IsGreenTag,
-		ProductName:     req.ProductName,
-		ProductCategory: req.ProductCategory,
-		Unit:            req.Unit,
-		NormalPrice:     req.NormalPrice,
-		SalePrice:       req.SalePrice,
-		Discount:        req.Discount,
-		Quantity:        req.Quantity,
+		ID:               ProductId,
+		ProductID:        req.ProductID,
+		ProductSKUID:     req.ProductSKUID,
+		IsGreenTag:       req.IsGreenTag,
+		ProductName:      req.ProductName,
+		ProductCategory:  req.ProductCategory,
+		CategoryID:       req.CategoryID,
+		Unit:             req.Unit,
+		NormalPrice:      req.NormalPrice,
+		SalePrice:        req.SalePrice,
+		Discount:         req.Discount,
+		ReorderThreshold: req.ReorderThreshold,
 	}
 
 	updateProduct, err := h.productService.UpdateProduct(ctx, product)
@@ -198,8 +283,9 @@ func (h *ProductHandler) UpdateProduct(c echo.Context) error {
 		// Check if it's a validation error
 		if err.Error() == "product ID is required" ||
 			err.Error() == "product name is required" ||
+			err.Error() == "product category not found" ||
 			err.Error() == "normal price must be greater than 0" ||
-			err.Error() == "quantity cannot be negative" {
+			err.Error() == "reorder threshold cannot be negative" {
 			return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
 		}
 		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
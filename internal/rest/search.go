@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	SearchHandler struct {
+		searchService SearchService
+		timeout       time.Duration
+	}
+
+	SearchService interface {
+		Suggest(ctx context.Context, q string) ([]domain.Suggestion, error)
+		GetMisses(ctx context.Context, page, limit int) ([]domain.SearchMiss, int64, error)
+	}
+)
+
+func NewSearchHandler(searchService SearchService) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+		timeout:       10 * time.Second,
+	}
+}
+
+func (h *SearchHandler) Suggest(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	suggestions, err := h.searchService.Suggest(ctx, c.QueryParam("q"))
+	if err != nil {
+		logger.Error("Failed to suggest products", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(suggestions))
+}
+
+func (h *SearchHandler) GetMisses(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	misses, total, err := h.searchService.GetMisses(ctx, page, limit)
+	if err != nil {
+		logger.Error("Failed to get search misses", err)
+		return c.JSON(http.StatusInternalServerError, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"misses": misses,
+		"total":  total,
+	}))
+}
@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"context"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	SubscriptionHandler struct {
+		subscriptionService SubscriptionService
+		timeout             time.Duration
+	}
+
+	SubscriptionService interface {
+		Subscribe(ctx context.Context, userID uint, productID uint64) (domain.StockSubscription, error)
+	}
+)
+
+func NewSubscriptionHandler(subscriptionService SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+		timeout:             10 * time.Second,
+	}
+}
+
+func (h *SubscriptionHandler) NotifyMe(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid product id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid product id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	subscription, err := h.subscriptionService.Subscribe(ctx, user_id, productID)
+	if err != nil {
+		logger.Error("Failed to subscribe to product", err)
+		if err.Error() == "product not found" {
+			return c.JSON(http.StatusNotFound, ResponseError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(subscription))
+}
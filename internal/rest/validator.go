@@ -0,0 +1,26 @@
+package rest
+
+import (
+	"myGreenMarket/domain"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// newValidator returns a validator that checks domain.Money fields by their
+// minor units, so tags like required and gt=0 work on amounts. The rupiah tag
+// rejects amounts with sen, gateways only invoice and pay out whole rupiah.
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		if money, ok := field.Interface().(domain.Money); ok {
+			return money.Minor()
+		}
+		return nil
+	}, domain.Money{})
+	validate.RegisterValidation("rupiah", func(fl validator.FieldLevel) bool {
+		return domain.NewMoney(fl.Field().Int()).IsWhole()
+	})
+
+	return validate
+}
@@ -0,0 +1,339 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AMFarhan21/fres"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	WalletHandler struct {
+		validate      *validator.Validate
+		walletService WalletService
+		timeout       time.Duration
+	}
+
+	WalletService interface {
+		GetTransactions(ctx context.Context, userID uint, page, limit int) (domain.WalletStatement, error)
+		Adjust(ctx context.Context, adminID, userID uint, amount domain.Money, description string) (domain.WalletLedgerEntry, error)
+		AddBankAccount(ctx context.Context, account domain.BankAccount) (domain.BankAccount, error)
+		GetBankAccounts(ctx context.Context, userID uint) ([]domain.BankAccount, error)
+		DeleteBankAccount(ctx context.Context, userID uint, id uint64) error
+		RequestWithdrawal(ctx context.Context, userID uint, bankAccountID uint64, amount domain.Money) (domain.Withdrawal, error)
+		GetWithdrawals(ctx context.Context, userID uint, page, limit int) ([]domain.Withdrawal, int64, error)
+		ListWithdrawals(ctx context.Context, status string, page, limit int) ([]domain.Withdrawal, int64, error)
+		ApproveWithdrawal(ctx context.Context, adminID uint, id uint64) (domain.Withdrawal, error)
+		RejectWithdrawal(ctx context.Context, adminID uint, id uint64, reason string) (domain.Withdrawal, error)
+		ReceiveDisbursementCallback(ctx context.Context, disbursement domain.Disbursement) error
+	}
+
+	WalletAdjustmentInput struct {
+		UserID      uint         `json:"user_id" validate:"required"`
+		Amount      domain.Money `json:"amount" validate:"required,rupiah"`
+		Description string       `json:"description" validate:"required"`
+	}
+
+	BankAccountInput struct {
+		BankCode          string `json:"bank_code" validate:"required"`
+		AccountNumber     string `json:"account_number" validate:"required,numeric"`
+		AccountHolderName string `json:"account_holder_name" validate:"required"`
+	}
+
+	WithdrawalInput struct {
+		BankAccountID uint64       `json:"bank_account_id" validate:"required"`
+		Amount        domain.Money `json:"amount" validate:"required,gt=0,rupiah"`
+	}
+
+	RejectWithdrawalInput struct {
+		Reason string `json:"reason" validate:"required"`
+	}
+
+	// DisbursementWebhookRequest is the body of a Xendit disbursement callback
+	DisbursementWebhookRequest struct {
+		ID          string       `json:"id"`
+		ExternalID  string       `json:"external_id"`
+		Amount      domain.Money `json:"amount"`
+		Status      string       `json:"status"`
+		FailureCode string       `json:"failure_code"`
+	}
+)
+
+func NewWalletHandler(walletService WalletService) *WalletHandler {
+	return &WalletHandler{
+		validate:      newValidator(),
+		walletService: walletService,
+		timeout:       10 * time.Second,
+	}
+}
+
+func (h *WalletHandler) GetTransactions(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	statement, err := h.walletService.GetTransactions(ctx, user_id, page, limit)
+	if err != nil {
+		logger.Error("Failed to get wallet transactions", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(statement))
+}
+
+func (h *WalletHandler) Adjust(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	var request WalletAdjustmentInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation wallet adjustment validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	entry, err := h.walletService.Adjust(ctx, admin_id, request.UserID, request.Amount, request.Description)
+	if err != nil {
+		logger.Error("Failed to adjust wallet", err)
+		if errors.Is(err, domain.ErrInsufficientBalance) {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(entry))
+}
+
+func (h *WalletHandler) AddBankAccount(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	var request BankAccountInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation bank account validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	account, err := h.walletService.AddBankAccount(ctx, domain.BankAccount{
+		UserID:            user_id,
+		BankCode:          request.BankCode,
+		AccountNumber:     request.AccountNumber,
+		AccountHolderName: request.AccountHolderName,
+	})
+	if err != nil {
+		logger.Error("Failed to add bank account", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(account))
+}
+
+func (h *WalletHandler) GetBankAccounts(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	accounts, err := h.walletService.GetBankAccounts(ctx, user_id)
+	if err != nil {
+		logger.Error("Failed to get bank accounts", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(accounts))
+}
+
+func (h *WalletHandler) DeleteBankAccount(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid bank account id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid bank account id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	if err := h.walletService.DeleteBankAccount(ctx, user_id, id); err != nil {
+		logger.Error("Failed to delete bank account", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK("Bank account deleted successfully"))
+}
+
+func (h *WalletHandler) RequestWithdrawal(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+
+	var request WithdrawalInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation withdrawal validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	withdrawal, err := h.walletService.RequestWithdrawal(ctx, user_id, request.BankAccountID, request.Amount)
+	if err != nil {
+		logger.Error("Failed to request withdrawal", err)
+		if errors.Is(err, domain.ErrInsufficientBalance) {
+			return c.JSON(http.StatusConflict, ResponseError{Message: err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, fres.Response.StatusCreated(withdrawal))
+}
+
+func (h *WalletHandler) GetWithdrawals(c echo.Context) error {
+	user_id := c.Get("user_id").(uint)
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	withdrawals, total, err := h.walletService.GetWithdrawals(ctx, user_id, page, limit)
+	if err != nil {
+		logger.Error("Failed to get withdrawals", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"withdrawals": withdrawals,
+		"total":       total,
+	}))
+}
+
+func (h *WalletHandler) ListWithdrawals(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	withdrawals, total, err := h.walletService.ListWithdrawals(ctx, c.QueryParam("status"), page, limit)
+	if err != nil {
+		logger.Error("Failed to list withdrawals", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"withdrawals": withdrawals,
+		"total":       total,
+	}))
+}
+
+func (h *WalletHandler) ApproveWithdrawal(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid withdrawal id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid withdrawal id"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	withdrawal, err := h.walletService.ApproveWithdrawal(ctx, admin_id, id)
+	if err != nil {
+		logger.Error("Failed to approve withdrawal", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(withdrawal))
+}
+
+func (h *WalletHandler) RejectWithdrawal(c echo.Context) error {
+	admin_id := c.Get("user_id").(uint)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid withdrawal id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid withdrawal id"})
+	}
+
+	var request RejectWithdrawalInput
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Invalid request body", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	if err := h.validate.Struct(&request); err != nil {
+		logger.Error("Failed to validation reject withdrawal validation", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	withdrawal, err := h.walletService.RejectWithdrawal(ctx, admin_id, id, request.Reason)
+	if err != nil {
+		logger.Error("Failed to reject withdrawal", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(withdrawal))
+}
+
+// HandleDisbursementWebhook receives payout status callbacks from Xendit
+func (h *WalletHandler) HandleDisbursementWebhook(c echo.Context) error {
+	var request DisbursementWebhookRequest
+
+	if err := c.Bind(&request); err != nil {
+		logger.Error("Failed to bind disbursement webhook", err)
+		return c.JSON(http.StatusBadRequest, fres.Response.StatusBadRequest("Invalid request"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), h.timeout)
+	defer cancel()
+
+	err := h.walletService.ReceiveDisbursementCallback(ctx, domain.Disbursement{
+		ID:          request.ID,
+		ExternalID:  request.ExternalID,
+		Status:      request.Status,
+		Amount:      request.Amount,
+		FailureCode: request.FailureCode,
+	})
+	if err != nil {
+		logger.Error("Failed to update withdrawal status", err)
+		return c.JSON(http.StatusInternalServerError, fres.Response.StatusInternalServerError(http.StatusInternalServerError))
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(http.StatusOK))
+}
@@ -1,8 +1,13 @@
 package rest
 
 import (
+	"encoding/json"
+	"io"
 	"log"
+	"myGreenMarket/domain"
+	"myGreenMarket/pkg/logger"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/AMFarhan21/fres"
@@ -17,24 +22,24 @@ type (
 	}
 
 	WebhookRequest struct {
-		ID                 string    `json:"id"`
-		Items              []Item    `json:"items"`
-		Amount             int64     `json:"amount"`
-		Status             string    `json:"status"`
-		Created            time.Time `json:"created"`
-		IsHigh             bool      `json:"is_high"`
-		Updated            time.Time `json:"updated"`
-		UserID             string    `json:"user_id"`
-		Currency           string    `json:"currency"`
-		Description        string    `json:"description"`
-		ExternalID         string    `json:"external_id"`
-		MerchantName       string    `json:"merchant_name"`
-		PaymentMethod      string    `json:"payment_method"`
-		PaymentChannel     string    `json:"payment_channel"`
-		PaymentDestination string    `json:"payment_destination"`
-		FailureRedirectURL string    `json:"failure_redirect_url"`
-		SuccessRedirectURL string    `json:"success_redirect_url"`
-		Metadata           Meta      `json:"metadata"`
+		ID                 string       `json:"id"`
+		Items              []Item       `json:"items"`
+		Amount             domain.Money `json:"amount"`
+		Status             string       `json:"status"`
+		Created            time.Time    `json:"created"`
+		IsHigh             bool         `json:"is_high"`
+		Updated            time.Time    `json:"updated"`
+		UserID             string       `json:"user_id"`
+		Currency           string       `json:"currency"`
+		Description        string       `json:"description"`
+		ExternalID         string       `json:"external_id"`
+		MerchantName       string       `json:"merchant_name"`
+		PaymentMethod      string       `json:"payment_method"`
+		PaymentChannel     string       `json:"payment_channel"`
+		PaymentDestination string       `json:"payment_destination"`
+		FailureRedirectURL string       `json:"failure_redirect_url"`
+		SuccessRedirectURL string       `json:"success_redirect_url"`
+		Metadata           Meta         `json:"metadata"`
 	}
 
 	Meta struct {
@@ -42,11 +47,11 @@ type (
 	}
 
 	Item struct {
-		Purpose  string `json:"purpose"`
-		Name     string `json:"name"`
-		Price    int64  `json:"price"`
-		Category string `json:"category"`
-		Quantity int64  `json:"quantity"`
+		Purpose  string       `json:"purpose"`
+		Name     string       `json:"name"`
+		Price    domain.Money `json:"price"`
+		Category string       `json:"category"`
+		Quantity int64        `json:"quantity"`
 	}
 )
 
@@ -60,14 +65,21 @@ func NewWebhookController(paymentService PaymentsService) *WebhookController {
 func (ctrl WebhookController) HandleWebhook(c echo.Context) error {
 	var request WebhookRequest
 
-	if err := c.Bind(&request); err != nil {
+	// The raw body is kept so the event can be stored and replayed as received
+	payload, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Println("Failed to read webhook request:", err)
+		return c.JSON(http.StatusBadRequest, fres.Response.StatusBadRequest("Invalid request"))
+	}
+
+	if err := json.Unmarshal(payload, &request); err != nil {
 		log.Println("Failed to bind webhook request:", err)
 		return c.JSON(http.StatusBadRequest, fres.Response.StatusBadRequest("Invalid request"))
 	}
 
 	log.Print("Received webhook from Xendit:", request)
 
-	err := ctrl.paymentService.ReceivePaymentWebhook(request)
+	err = ctrl.paymentService.ReceivePaymentWebhook(request, payload)
 	if err != nil {
 		log.Println("Failed to update payment status:", err.Error())
 		return c.JSON(http.StatusInternalServerError, fres.Response.StatusInternalServerError(http.StatusInternalServerError))
@@ -76,3 +88,34 @@ func (ctrl WebhookController) HandleWebhook(c echo.Context) error {
 	log.Print(request)
 	return c.JSON(http.StatusOK, fres.Response.StatusOK(http.StatusOK))
 }
+
+func (ctrl WebhookController) ListEvents(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	events, total, err := ctrl.paymentService.ListWebhookEvents(c.QueryParam("status"), page, limit)
+	if err != nil {
+		logger.Error("Failed to list webhook events", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK(map[string]interface{}{
+		"events": events,
+		"total":  total,
+	}))
+}
+
+func (ctrl WebhookController) ReplayEvent(c echo.Context) error {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Error("Invalid webhook event id", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid webhook event id"})
+	}
+
+	if err := ctrl.paymentService.ReplayWebhookEvent(eventID); err != nil {
+		logger.Error("Failed to replay webhook event", err)
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, fres.Response.StatusOK("Webhook event replayed successfully"))
+}
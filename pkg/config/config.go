@@ -3,17 +3,23 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	App      AppConfig
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Mailjet  MailjetConfig
-	Xendit   XenditConfig
+	App        AppConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	JWT        JWTConfig
+	Mailjet    MailjetConfig
+	Xendit     XenditConfig
+	Payment    PaymentConfig
+	Withdrawal WithdrawalConfig
+	Scheduler  SchedulerConfig
 }
 
 type MailjetConfig struct {
@@ -30,10 +36,15 @@ type AppConfig struct {
 	Environment             string
 	AppDeploymentUrl        string
 	AppEmailVerificationKey string
+	// FakeGateways mounts the Xendit and Mailjet simulator under /fake, never in production
+	FakeGateways bool
 }
 
 type ServerConfig struct {
 	Port string
+	// TrustedProxies are the load balancers allowed to set X-Forwarded-For,
+	// without them the client IP is the connecting address
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -50,9 +61,48 @@ type JWTConfig struct {
 }
 
 type XenditConfig struct {
-	XenditSecretKey string
-	XenditUrl       string
-	RedirectUrl     string
+	XenditSecretKey   string
+	XenditUrl         string
+	RedirectUrl       string
+	CallbackToken     string
+	WebhookAllowedIPs []string
+	Timeout           time.Duration
+	MaxRetries        int
+}
+
+// PaymentConfig picks the payment gateway, "xendit" or "bank_transfer". The
+// bank fields are what customers paying by bank transfer are told to use.
+type PaymentConfig struct {
+	Gateway           string
+	BankName          string
+	BankAccountNumber string
+	BankAccountName   string
+}
+
+// WithdrawalConfig picks the disbursement gateway, "xendit" or "stub". The stub
+// completes payouts in memory and is refused in production. Withdrawals above
+// ApprovalThreshold wait for an admin, zero sends every withdrawal straight away.
+type WithdrawalConfig struct {
+	Gateway           string
+	ApprovalThreshold int64
+}
+
+// SchedulerConfig sets how often each background job runs, zero turns a job off
+type SchedulerConfig struct {
+	// ReconcileAfter is how old a PENDING payment has to be before it is checked with the gateway
+	ReconcileInterval time.Duration
+	ReconcileAfter    time.Duration
+	// PendingOrderTTL is how long an unpaid PENDING order keeps its reserved stock
+	ExpiryInterval  time.Duration
+	PendingOrderTTL time.Duration
+	// MarkdownInterval is how often expiry markdowns and write-offs are applied
+	MarkdownInterval time.Duration
+	// ExpiringAlertWindow is how close to expiry a batch has to be for a stock alert
+	AlertInterval       time.Duration
+	ExpiringAlertWindow time.Duration
+	// BackInStockSendLimit caps the back in stock emails sent per run, the rest wait for the next run
+	BackInStockInterval  time.Duration
+	BackInStockSendLimit int
 }
 
 func Load() (*Config, error) {
@@ -65,9 +115,12 @@ func Load() (*Config, error) {
 			Environment:             getEnv("APP_ENV", "development"),
 			AppDeploymentUrl:        getEnv("APP_DEPLOYMENT_URL", ""),
 			AppEmailVerificationKey: getEnv("APP_EMAIL_VERIFICATION_KEY", ""),
+			FakeGateways:            getEnv("FAKE_GATEWAYS_ENABLED", "false") == "true",
 		},
 		Server: ServerConfig{
 			Port: getEnv("PORT", "8080"),
+			// Comma separated IPs or CIDR ranges
+			TrustedProxies: getEnvList("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -91,6 +144,33 @@ func Load() (*Config, error) {
 			XenditSecretKey: getEnv("XENDIT_SECRET_KEY", ""),
 			XenditUrl:       getEnv("XENDIT_URL", ""),
 			RedirectUrl:     getEnv("REDIRECT_URL", ""),
+			CallbackToken:   getEnv("XENDIT_CALLBACK_TOKEN", ""),
+			// Comma separated IPs or CIDR ranges, empty allows any source
+			WebhookAllowedIPs: getEnvList("XENDIT_WEBHOOK_ALLOWED_IPS"),
+			Timeout:           time.Duration(getEnvInt("XENDIT_TIMEOUT_SECONDS", 15)) * time.Second,
+			MaxRetries:        getEnvInt("XENDIT_MAX_RETRIES", 2),
+		},
+		Payment: PaymentConfig{
+			Gateway:           getEnv("PAYMENT_GATEWAY", "xendit"),
+			BankName:          getEnv("BANK_TRANSFER_BANK_NAME", ""),
+			BankAccountNumber: getEnv("BANK_TRANSFER_ACCOUNT_NUMBER", ""),
+			BankAccountName:   getEnv("BANK_TRANSFER_ACCOUNT_NAME", ""),
+		},
+		Withdrawal: WithdrawalConfig{
+			Gateway:           getEnv("DISBURSEMENT_GATEWAY", "xendit"),
+			ApprovalThreshold: int64(getEnvInt("WITHDRAWAL_APPROVAL_THRESHOLD", 1000000)),
+		},
+		Scheduler: SchedulerConfig{
+			ReconcileInterval: time.Duration(getEnvInt("RECONCILE_INTERVAL_MINUTES", 15)) * time.Minute,
+			ReconcileAfter:    time.Duration(getEnvInt("RECONCILE_AFTER_MINUTES", 30)) * time.Minute,
+			ExpiryInterval:    time.Duration(getEnvInt("EXPIRY_INTERVAL_MINUTES", 5)) * time.Minute,
+			PendingOrderTTL:   time.Duration(getEnvInt("PENDING_ORDER_TTL_MINUTES", 60)) * time.Minute,
+			MarkdownInterval:  time.Duration(getEnvInt("MARKDOWN_INTERVAL_MINUTES", 60)) * time.Minute,
+			AlertInterval:     time.Duration(getEnvInt("ALERT_INTERVAL_MINUTES", 30)) * time.Minute,
+			// Days, so the default matches the expiring stock report
+			ExpiringAlertWindow:  time.Duration(getEnvInt("ALERT_EXPIRING_DAYS", 3)) * 24 * time.Hour,
+			BackInStockInterval:  time.Duration(getEnvInt("BACK_IN_STOCK_INTERVAL_MINUTES", 1)) * time.Minute,
+			BackInStockSendLimit: getEnvInt("BACK_IN_STOCK_SENDS_PER_RUN", 100),
 		},
 	}
 
@@ -106,6 +186,32 @@ func Load() (*Config, error) {
 		return nil, errors.New("missing app email verification key")
 	}
 
+	switch cfg.Payment.Gateway {
+	case "xendit":
+		if cfg.Xendit.CallbackToken == "" {
+			return nil, errors.New("missing xendit callback token")
+		}
+	case "bank_transfer":
+		if cfg.Payment.BankAccountNumber == "" {
+			return nil, errors.New("missing bank transfer account number")
+		}
+	default:
+		return nil, errors.New("unknown payment gateway " + cfg.Payment.Gateway)
+	}
+
+	switch cfg.Withdrawal.Gateway {
+	case "xendit":
+		if cfg.Xendit.CallbackToken == "" {
+			return nil, errors.New("missing xendit callback token")
+		}
+	case "stub":
+		if cfg.App.Environment == "production" {
+			return nil, errors.New("stub disbursement gateway cannot be used in production")
+		}
+	default:
+		return nil, errors.New("unknown disbursement gateway " + cfg.Withdrawal.Gateway)
+	}
+
 	if cfg.Database.Password == "" {
 		return nil, errors.New("missing database password")
 	}
@@ -120,3 +226,23 @@ func getEnv(key, defaultVal string) string {
 
 	return defaultVal
 }
+
+func getEnvInt(key string, defaultVal int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultVal
+	}
+
+	return val
+}
+
+func getEnvList(key string) []string {
+	var list []string
+	for _, val := range strings.Split(os.Getenv(key), ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			list = append(list, val)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"myGreenMarket/pkg/logger"
+	"sync"
+	"time"
+)
+
+// Job is one run of a background task. It should return soon after ctx is cancelled.
+type Job func(ctx context.Context) error
+
+type task struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Scheduler runs background jobs inside the server process. Each job runs on
+// its own interval and never overlaps itself. Stop cancels running jobs and
+// waits for them, so the server can shut down without cutting a job off
+// half way through a transaction.
+type Scheduler struct {
+	tasks  []task
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers a job. An interval of zero or less disables the job.
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	if interval <= 0 {
+		logger.Info("Scheduled job disabled", "job", name)
+		return
+	}
+
+	s.tasks = append(s.tasks, task{name: name, interval: interval, job: job})
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(ctx, t)
+	}
+	logger.Info("Scheduler started", "jobs", len(s.tasks))
+}
+
+// Stop cancels the jobs and waits until they return or ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler stop: %w", ctx.Err())
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, t task) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.run(ctx, t)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, t task) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Scheduled job panicked", "job", t.name, "panic", r)
+		}
+	}()
+
+	start := time.Now()
+	if err := t.job(ctx); err != nil {
+		logger.Error("Scheduled job failed", "job", t.name, "error", err)
+		return
+	}
+	logger.Debug("Scheduled job finished", "job", t.name, "duration", time.Since(start))
+}